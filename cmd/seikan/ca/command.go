@@ -0,0 +1,110 @@
+package ca
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/ca"
+	"github.com/mdouchement/seikan/internal/keystore"
+	"github.com/mdouchement/seikan/internal/noise"
+	"github.com/spf13/cobra"
+)
+
+// Command manages the certificate authority signing the client public keys.
+func Command() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "ca",
+		Short: "Manage the certificate authority of the clients",
+		Args:  cobra.NoArgs,
+	}
+	c.AddCommand(initCommand())
+	c.AddCommand(signCommand())
+	return c
+}
+
+// initCommand generates a new certificate authority.
+func initCommand() *cobra.Command {
+	var encrypt string
+
+	c := &cobra.Command{
+		Use:   "init",
+		Short: "Generate a new certificate authority",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			a := ca.GenerateAuthority()
+
+			secret := a.Secret
+			if encrypt != "" {
+				passphrase, err := keystore.Passphrase(true)
+				if err != nil {
+					return err
+				}
+
+				secret, err = keystore.Write(encrypt, a.Secret, passphrase)
+				if err != nil {
+					return err
+				}
+			}
+
+			fmt.Println("secret:", secret)
+			fmt.Println("public:", a.Public)
+			return nil
+		},
+	}
+
+	c.Flags().StringVarP(&encrypt, "encrypt", "", "", "Write the secret key to a keystore file encrypted with a passphrase ($"+keystore.EnvPassphrase+" or prompted)")
+	return c
+}
+
+// signCommand signs the public key of a client.
+func signCommand() *cobra.Command {
+	var secret, identifier, public string
+	var validity time.Duration
+	var destinations []string
+
+	c := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign the public key of a client",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			if secret == "" || identifier == "" || public == "" {
+				return errors.New("secret, identifier and public are required")
+			}
+
+			if validity <= 0 {
+				return errors.New("validity must be positive")
+			}
+
+			key, err := keystore.Resolve(secret, func() ([]byte, error) {
+				return keystore.Passphrase(false)
+			})
+			if err != nil {
+				return fmt.Errorf("secret: %w", err)
+			}
+
+			now := time.Now().Truncate(time.Second)
+			certificate, err := ca.Authority{Secret: key}.Sign(ca.Certificate{
+				Identifier:   identifier,
+				Public:       noise.PublicKey(public),
+				NotBefore:    now,
+				NotAfter:     now.Add(validity),
+				Destinations: destinations,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("certificate:", certificate)
+			fmt.Println("not_after:", now.Add(validity).Format(time.RFC3339))
+			return nil
+		},
+	}
+
+	c.Flags().StringVarP(&secret, "secret", "", "", "Secret key of the certificate authority, or its file:, env: or keystore: reference")
+	c.Flags().StringVarP(&identifier, "identifier", "", "", "Identifier of the client")
+	c.Flags().StringVarP(&public, "public", "", "", "Public key of the client")
+	c.Flags().DurationVarP(&validity, "validity", "", 24*time.Hour, "Validity period of the certificate")
+	c.Flags().StringArrayVarP(&destinations, "destination", "", nil, "Destination the client is allowed to bind on the server side, repeatable (all of them when omitted)")
+	return c
+}
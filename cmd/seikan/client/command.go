@@ -28,6 +28,11 @@ func Command() *cobra.Command {
 				return err
 			}
 
+			err = cfg.ResolveSecrets()
+			if err != nil {
+				return err
+			}
+
 			level := slog.LevelInfo
 			if cfg.Log.Level != "" {
 				level, err = logger.ParseSlogLevel(cfg.Log.Level)
@@ -3,21 +3,46 @@ package identity
 import (
 	"fmt"
 
+	"github.com/mdouchement/seikan/internal/keystore"
 	"github.com/mdouchement/seikan/internal/noise"
 	"github.com/spf13/cobra"
 )
 
 // Command generates a new identity.
 func Command() *cobra.Command {
+	var psk bool
+	var encrypt string
+
 	c := &cobra.Command{
 		Use:   "identity",
 		Short: "Generate a new identity",
 		Args:  cobra.NoArgs,
-		Run: func(c *cobra.Command, _ []string) {
+		RunE: func(c *cobra.Command, _ []string) error {
 			i := noise.GenerateIdentity()
-			fmt.Println("secret:", i.Secret)
+
+			secret := i.Secret
+			if encrypt != "" {
+				passphrase, err := keystore.Passphrase(true)
+				if err != nil {
+					return err
+				}
+
+				secret, err = keystore.Write(encrypt, i.Secret, passphrase)
+				if err != nil {
+					return err
+				}
+			}
+
+			fmt.Println("secret:", secret)
 			fmt.Println("public:", i.Public)
+			if psk {
+				fmt.Println("psk:", noise.GeneratePSK())
+			}
+			return nil
 		},
 	}
+
+	c.Flags().BoolVarP(&psk, "psk", "", false, "Generate also a pre-shared key")
+	c.Flags().StringVarP(&encrypt, "encrypt", "", "", "Write the secret key to a keystore file encrypted with a passphrase ($"+keystore.EnvPassphrase+" or prompted)")
 	return c
 }
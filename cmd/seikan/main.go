@@ -5,6 +5,7 @@ import (
 	"log"
 	"runtime"
 
+	"github.com/mdouchement/seikan/cmd/seikan/ca"
 	"github.com/mdouchement/seikan/cmd/seikan/client"
 	"github.com/mdouchement/seikan/cmd/seikan/identity"
 	"github.com/mdouchement/seikan/cmd/seikan/server"
@@ -27,6 +28,7 @@ func main() {
 	c.AddCommand(server.Command())
 	c.AddCommand(client.Command())
 	c.AddCommand(identity.Command())
+	c.AddCommand(ca.Command())
 	c.AddCommand(&cobra.Command{
 		Use:   "version",
 		Short: "Version for Seikan",
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
 	"regexp"
 
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/seikan/internal/config"
 	"github.com/mdouchement/seikan/internal/server"
+	"github.com/mdouchement/seikan/internal/snet"
 	"github.com/spf13/cobra"
 )
 
@@ -27,6 +29,11 @@ func Command() *cobra.Command {
 				return err
 			}
 
+			err = cfg.ResolveSecrets()
+			if err != nil {
+				return err
+			}
+
 			level := slog.LevelInfo
 			if cfg.Log.Level != "" {
 				level, err = logger.ParseSlogLevel(cfg.Log.Level)
@@ -46,10 +53,33 @@ func Command() *cobra.Command {
 				TimestampFormat: "2006-01-02 15:04:05",
 			}))
 
-			s, err := server.New(cfg, logger.WrapSlog(l))
+			log := logger.WrapSlog(l)
+
+			n, err := snet.InheritListeners()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				log.Infof("Inherited %d listeners", n)
+			}
+
+			s, err := server.New(cfg, log)
 			if err != nil {
 				return err
 			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, restartSignals...)
+			defer signal.Stop(signals)
+
+			go func() {
+				for range signals {
+					if err := s.Restart(); err != nil {
+						log.WithError(err).Error("failed to restart")
+					}
+				}
+			}()
+
 			return s.Listen()
 		},
 	}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// restartSignals trigger a zero-downtime restart of the server.
+var restartSignals = []os.Signal{syscall.SIGUSR2}
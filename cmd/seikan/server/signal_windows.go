@@ -0,0 +1,9 @@
+//go:build windows
+
+package server
+
+import "os"
+
+// restartSignals trigger a zero-downtime restart of the server.
+// Restarts are not supported on Windows.
+var restartSignals []os.Signal
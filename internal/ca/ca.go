@@ -0,0 +1,166 @@
+// Package ca implements a small certificate authority signing the static keys of the clients.
+package ca
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mdouchement/seikan/pkg/base58"
+)
+
+// Key and certificate prefixes.
+const (
+	prefixSecret      = "ca-sk-"
+	prefixPublic      = "ca-pk-"
+	prefixCertificate = "cert-"
+)
+
+// signatureContext is prepended to the signed data.
+var signatureContext = []byte("seikan-certificate-v1")
+
+// An Authority is an Ed25519 keypair signing the client certificates.
+type Authority struct {
+	Secret string
+	Public string
+}
+
+// A Certificate binds the public key of a client to its identifier, validity period and allowed destinations.
+type Certificate struct {
+	Identifier string    `cbor:"identifier"`
+	Public     string    `cbor:"public"`
+	NotBefore  time.Time `cbor:"not_before"`
+	NotAfter   time.Time `cbor:"not_after"`
+	// Destinations are the server side addresses the client is allowed to bind, all of them when empty.
+	Destinations []string `cbor:"destinations,omitempty"`
+}
+
+// A signed is the encoded form of a certificate.
+type signed struct {
+	Certificate []byte `cbor:"certificate"` // CBOR encoded Certificate
+	Signature   []byte `cbor:"signature"`
+}
+
+// GenerateAuthority returns a new Authority.
+func GenerateAuthority() Authority {
+	public, secret, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return Authority{
+		Secret: prefixSecret + base58.Encode(secret.Seed()),
+		Public: prefixPublic + base58.Encode(public),
+	}
+}
+
+// Sign returns the given certificate signed by the authority.
+func (a Authority) Sign(c Certificate) (string, error) {
+	seed, err := base58.DecodeString(strings.TrimPrefix(a.Secret, prefixSecret))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return "", errors.New("invalid authority secret key")
+	}
+
+	if c.Identifier == "" || c.Public == "" {
+		return "", errors.New("certificate identifier and public key are required")
+	}
+
+	if !c.NotAfter.After(c.NotBefore) {
+		return "", errors.New("certificate validity period is empty")
+	}
+
+	body, err := cbor.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := cbor.Marshal(signed{
+		Certificate: body,
+		Signature:   ed25519.Sign(ed25519.NewKeyFromSeed(seed), append(slices.Clone(signatureContext), body...)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return prefixCertificate + base58.Encode(payload), nil
+}
+
+// Verify returns the given certificate once its signature by the given authority public key and its validity period at now are checked.
+func Verify(authority, certificate string, now time.Time) (Certificate, error) {
+	public, err := base58.DecodeString(strings.TrimPrefix(authority, prefixPublic))
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return Certificate{}, errors.New("invalid authority public key")
+	}
+
+	s, err := decode(certificate)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	if !ed25519.Verify(public, append(slices.Clone(signatureContext), s.Certificate...), s.Signature) {
+		return Certificate{}, errors.New("certificate: invalid signature")
+	}
+
+	var c Certificate
+	if err = cbor.Unmarshal(s.Certificate, &c); err != nil {
+		return Certificate{}, fmt.Errorf("certificate: %w", err)
+	}
+
+	if now.Before(c.NotBefore) {
+		return Certificate{}, fmt.Errorf("certificate: not valid before %s", c.NotBefore)
+	}
+	if now.After(c.NotAfter) {
+		return Certificate{}, fmt.Errorf("certificate: expired since %s", c.NotAfter)
+	}
+
+	return c, nil
+}
+
+// Inspect returns the given certificate without verifying it.
+func Inspect(certificate string) (Certificate, error) {
+	s, err := decode(certificate)
+	if err != nil {
+		return Certificate{}, err
+	}
+
+	var c Certificate
+	if err = cbor.Unmarshal(s.Certificate, &c); err != nil {
+		return Certificate{}, fmt.Errorf("certificate: %w", err)
+	}
+	return c, nil
+}
+
+// ValidateAuthority checks the given authority public key.
+func ValidateAuthority(public string) error {
+	if p, err := base58.DecodeString(strings.TrimPrefix(public, prefixPublic)); err != nil || len(p) != ed25519.PublicKeySize {
+		return errors.New("invalid authority public key")
+	}
+	return nil
+}
+
+// Allows returns true if the certificate allows the given destination.
+func (c Certificate) Allows(destination string) bool {
+	return len(c.Destinations) == 0 || slices.Contains(c.Destinations, destination)
+}
+
+func decode(certificate string) (signed, error) {
+	var s signed
+	if !strings.HasPrefix(certificate, prefixCertificate) {
+		return s, errors.New("certificate: invalid format")
+	}
+
+	payload, err := base58.DecodeString(strings.TrimPrefix(certificate, prefixCertificate))
+	if err != nil {
+		return s, fmt.Errorf("certificate: %w", err)
+	}
+
+	if err = cbor.Unmarshal(payload, &s); err != nil {
+		return s, fmt.Errorf("certificate: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,75 @@
+package ca_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/ca"
+	"github.com/mdouchement/seikan/internal/noise"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	authority := ca.GenerateAuthority()
+	client := noise.GenerateIdentity()
+	now := time.Now().Truncate(time.Second)
+
+	certificate, err := authority.Sign(ca.Certificate{
+		Identifier:   "trololo",
+		Public:       client.Public,
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(time.Hour),
+		Destinations: []string{"localhost:22"},
+	})
+	assert.NoError(t, err)
+
+	c, err := ca.Verify(authority.Public, certificate, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "trololo", c.Identifier)
+	assert.Equal(t, client.Public, c.Public)
+	assert.True(t, c.NotAfter.Equal(now.Add(time.Hour)))
+	assert.True(t, c.Allows("localhost:22"))
+	assert.False(t, c.Allows("localhost:80"))
+
+	inspected, err := ca.Inspect(certificate)
+	assert.NoError(t, err)
+	assert.Equal(t, c.Identifier, inspected.Identifier)
+
+	//
+
+	_, err = ca.Verify(authority.Public, certificate, now.Add(2*time.Hour))
+	assert.ErrorContains(t, err, "certificate: expired since")
+
+	_, err = ca.Verify(authority.Public, certificate, now.Add(-time.Hour))
+	assert.ErrorContains(t, err, "certificate: not valid before")
+
+	_, err = ca.Verify(ca.GenerateAuthority().Public, certificate, now)
+	assert.EqualError(t, err, "certificate: invalid signature")
+
+	_, err = ca.Verify(authority.Public, "cert-trololo", now)
+	assert.Error(t, err)
+
+	_, err = ca.Verify("ca-pk-trololo", certificate, now)
+	assert.EqualError(t, err, "invalid authority public key")
+}
+
+func TestSign_Invalid(t *testing.T) {
+	authority := ca.GenerateAuthority()
+	now := time.Now()
+
+	_, err := authority.Sign(ca.Certificate{Identifier: "trololo", NotBefore: now, NotAfter: now.Add(time.Hour)})
+	assert.EqualError(t, err, "certificate identifier and public key are required")
+
+	_, err = authority.Sign(ca.Certificate{Identifier: "trololo", Public: "pk-trololo", NotBefore: now, NotAfter: now})
+	assert.EqualError(t, err, "certificate validity period is empty")
+
+	_, err = ca.Authority{Secret: "ca-sk-trololo"}.Sign(ca.Certificate{})
+	assert.EqualError(t, err, "invalid authority secret key")
+
+	assert.NoError(t, ca.ValidateAuthority(authority.Public))
+	assert.Error(t, ca.ValidateAuthority("ca-pk-trololo"))
+}
+
+func TestCertificate_Allows(t *testing.T) {
+	assert.True(t, ca.Certificate{}.Allows("localhost:22"))
+}
@@ -1,16 +1,23 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"net/url"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/mdouchement/logger"
+	"github.com/mdouchement/seikan/internal/ca"
 	"github.com/mdouchement/seikan/internal/config"
+	"github.com/mdouchement/seikan/internal/control"
+	"github.com/mdouchement/seikan/internal/knownhosts"
 	"github.com/mdouchement/seikan/internal/noise"
 	"github.com/mdouchement/seikan/internal/seikan"
 	"github.com/mdouchement/seikan/internal/smux"
 	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/transport"
 )
 
 type (
@@ -22,6 +29,7 @@ type (
 	client struct {
 		cfg       config.Client
 		log       logger.Logger
+		keyring   *keyring
 		listeners map[string]*smux.DropListener
 	}
 )
@@ -31,15 +39,81 @@ func New(cfg config.Client, l logger.Logger) Client {
 	return &client{
 		cfg:       cfg,
 		log:       l,
+		keyring:   &keyring{},
 		listeners: make(map[string]*smux.DropListener),
 	}
 }
 
 // Dial establishes a tunnel with the server.
 func (client *client) Dial() error {
+	_, u, err := transport.Resolve(client.cfg.Server.Address)
+	if err != nil {
+		return fmt.Errorf("invalid server address %s: %w", client.cfg.Server.Address, err)
+	}
+	if u.Scheme == "mnet" {
+		client.log.Warn("The mnet transport is deprecated, use rudp on both peers")
+	}
+
+	if client.cfg.Server.Public == "" && client.cfg.Server.KnownHosts == "" {
+		return errors.New("server public key or known_hosts file is required")
+	}
+
+	if _, err := noise.ParseSuite(client.cfg.CipherSuite.Cipher, client.cfg.CipherSuite.Hash); err != nil {
+		return fmt.Errorf("cipher_suite: %w", err)
+	}
+
+	if _, err := noise.ParsePadding(client.cfg.Obfuscation.Padding); err != nil {
+		return fmt.Errorf("obfuscation: %w", err)
+	}
+
+	if _, err := snet.ParseCompression(client.cfg.Compression); err != nil {
+		return fmt.Errorf("compression: %w", err)
+	}
+
+	if client.cfg.Server.KeyLookup && client.cfg.Server.Public == "" {
+		return errors.New("key_lookup requires the server public key")
+	}
+
+	if client.cfg.Server.Resumption && client.cfg.Server.Public == "" {
+		return errors.New("resumption requires the server public key")
+	}
+
+	if client.cfg.Certificate != "" {
+		if !client.cfg.Server.KeyLookup {
+			return errors.New("certificate requires key_lookup")
+		}
+
+		cert, err := ca.Inspect(client.cfg.Certificate)
+		if err != nil {
+			return err
+		}
+
+		if cert.Identifier != client.cfg.Identifier || noise.PublicKey(cert.Public) != noise.PublicKey(client.cfg.Public) {
+			return errors.New("certificate: issued for another identifier or public key")
+		}
+
+		if time.Now().After(cert.NotAfter) {
+			client.log.Warnf("Certificate expired since %s", cert.NotAfter)
+		}
+	}
+
+	if client.cfg.PostQuantum && client.cfg.Server.Public == "" {
+		return errors.New("post_quantum requires the server public key")
+	}
+
+	if client.cfg.PSK != "" {
+		if client.cfg.Server.Public == "" {
+			return errors.New("psk requires the server public key")
+		}
+
+		if err := noise.ValidatePSK(client.cfg.PSK); err != nil {
+			return err
+		}
+	}
+
 	// TUNNEL server to client
 	if client.cfg.Inbound {
-		inbound, err := NewInbound(client.cfg, client.log)
+		inbound, err := NewInbound(client.cfg, client.log, client.keyring)
 		if err != nil {
 			return err
 		}
@@ -49,7 +123,7 @@ func (client *client) Dial() error {
 
 	// TUNNEL client to server
 	if len(client.cfg.Outbounds) > 0 {
-		outbound := NewOutbound(client.cfg, client.log)
+		outbound := NewOutbound(client.cfg, client.log, client.keyring)
 
 		err := outbound.Establish()
 		if err != nil {
@@ -62,17 +136,110 @@ func (client *client) Dial() error {
 
 func identity(c config.Client) noise.Identity {
 	return noise.Identity{
-		Secret: c.Secret,
-		Public: c.Public,
+		Secret:      c.Secret,
+		Public:      c.Public,
+		Certificate: c.Certificate,
+	}
+}
+
+func session(r config.Rekey, o config.Obfuscation) noise.SessionOptions {
+	padding, _ := noise.ParsePadding(o.Padding) // Validated by Dial
+
+	return noise.SessionOptions{
+		Rekey: noise.RekeyPolicy{
+			Interval: r.Interval,
+			Bytes:    r.Bytes,
+			Chunks:   r.Chunks,
+		},
+		Rehandshake: r.Rehandshake,
+		Obfuscation: noise.Obfuscation{
+			Enabled: o.Enabled,
+			Padding: padding,
+			Cover:   o.Cover,
+		},
+	}
+}
+
+// do performs the given control, the server public key and the resumption ticket received before the response
+// are kept in the keyring for the next connections.
+func do(log logger.Logger, cfg config.Client, k *keyring, c net.Conn, pdu control.PDU) (control.PDU, error) {
+	return control.DoNotify(c, pdu, func(notice control.PDU) {
+		switch notice := notice.(type) {
+		case *control.ServerKey:
+			if notice.Public == "" {
+				return
+			}
+
+			k.servers.Store(cfg.Server.Address, notice.Public)
+			log.Warnf("Server public key rotated to %s, the previous one expires at %s: update server.public",
+				notice.Public, time.Unix(notice.NotAfter, 0).UTC())
+		case *control.Ticket:
+			if !cfg.Server.Resumption || len(notice.Ticket) == 0 {
+				return
+			}
+
+			k.tickets.put(k.ticketKey(cfg), ticket{
+				sealed:   notice.Ticket,
+				psk:      notice.PSK,
+				notAfter: time.Unix(notice.NotAfter, 0),
+			})
+			log.Debug("Received a resumption ticket")
+		}
+	})
+}
+
+// recipient returns the server peer of the handshake.
+// Without a configured public key, the XX pattern is used and the server public key is pinned on first use.
+func recipient(log logger.Logger, c config.Client, k *keyring) noise.Peer {
+	suite, _ := noise.ParseSuite(c.CipherSuite.Cipher, c.CipherSuite.Hash) // Validated by Dial
+
+	if c.Server.Public != "" {
+		return noise.Peer{
+			Pattern: noise.PatternIK,
+			Public:  k.public(c),
+			PSK:     c.PSK,
+			Hybrid:  c.PostQuantum,
+			Suite:   suite,
+			Lookup:  c.Server.KeyLookup,
+		}
+	}
+
+	address := hostKey(c.Server.Address)
+	return noise.Peer{
+		Pattern: noise.PatternXX,
+		Suite:   suite,
+		Verify: func(public string) error {
+			pinned, err := knownhosts.Verify(c.Server.KnownHosts, address, public)
+			if pinned {
+				log.Warnf("Pinned server public key %s for %s", public, address)
+			}
+			if errors.Is(err, knownhosts.ErrKeyMismatch) {
+				return fmt.Errorf("%w: %w", seikan.ErrNotRetayable, err)
+			}
+			return err
+		},
 	}
 }
 
-func recipient(c config.Client) string {
-	return c.Server.Public
+// hostKey returns the server address without its query parameters and credentials.
+func hostKey(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
 }
 
-func connect(log logger.Logger, cfg config.Client, t smux.Tunnel) (net.Conn, error) {
-	c, err := snet.Dial(t.Remote)
+// handshakeTimeout is the maximum duration of the handshake.
+// A server that does not recognize the advertised identifier drains the connection silently.
+const handshakeTimeout = 30 * time.Second
+
+// connect establishes a session with the server, the given compression is requested during the handshake.
+func connect(log logger.Logger, cfg config.Client, k *keyring, t smux.Tunnel, compression string) (net.Conn, error) {
+	c, err := snet.DialThrough(t.Remote, cfg.Server.Proxy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to server %s: %w", t.Remote, err)
 	}
@@ -82,8 +249,28 @@ func connect(log logger.Logger, cfg config.Client, t smux.Tunnel) (net.Conn, err
 
 	log.Info("Handshake")
 
+	c.SetDeadline(time.Now().Add(handshakeTimeout))
+
 	log.Debug("Sending derived identifier")
-	derived, err := seikan.KDFGenerate(cfg.Identifier)
+	peer := recipient(log, cfg, k)
+	secret := cfg.Identifier
+	if peer.Lookup {
+		// The server does not know the client yet, the identifier is derived from the server public key.
+		secret = noise.PublicKey(peer.Public)
+	}
+
+	// A resumed session is advertised like the key lookup, the client is resolved from its ticket.
+	resumed, resume := ticket{}, false
+	if cfg.Server.Resumption {
+		resumed, resume = k.tickets.take(k.ticketKey(cfg), time.Now())
+	}
+	if resume {
+		secret = noise.PublicKey(peer.Public)
+		peer = noise.Peer{Pattern: noise.PatternNNpsk0, PSK: resumed.psk, Suite: peer.Suite}
+		c.SetDeadline(time.Now().Add(resumeTimeout))
+	}
+
+	derived, err := seikan.KDFGenerateTime(secret, noise.Advertising(peer), time.Now())
 	if err != nil {
 		c.Close()
 		return nil, fmt.Errorf("failed to generate derived identifier: %w", err)
@@ -94,16 +281,42 @@ func connect(log logger.Logger, cfg config.Client, t smux.Tunnel) (net.Conn, err
 		return nil, fmt.Errorf("failed to send derived identifier: %w", err)
 	}
 
+	if resume {
+		log.Debug("Resuming session")
+		if err = seikan.WriteTicket(c, resumed.sealed); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("failed to send ticket: %w", err)
+		}
+	}
+
 	//
 
 	log.Debug("Performing Noise handshake")
-	nc, err := noise.Handshake(c, identity(cfg), recipient(cfg), false)
+	// The client initiates the XX pattern to authenticate the server before sending its static key,
+	// the IK pattern of the key lookup so the server learns its static key from the first message
+	// and the NNpsk0 pattern of a resumed session.
+	options := session(cfg.Rekey, cfg.Obfuscation)
+	options.Compression = compression
+	nc, err := noise.Handshake(c, identity(cfg), peer, peer.Pattern != noise.PatternIK || peer.Lookup, options)
 	if err != nil {
 		c.Close()
 		return nil, err
 	}
+	c.SetDeadline(time.Time{})
+
+	if compression != "" && nc.Compression == "" {
+		log.Warnf("Compression %s not used, the server does not support the negotiation", compression)
+	}
+	if nc.Compression != "" {
+		log.Debugf("Using %s compression", nc.Compression)
+	}
 
-	cc, err := snet.Compress(nc)
+	negotiated, _ := snet.ParseCompression(nc.Compression) // Requested by the client
+	cc, err := snet.CompressWith(nc, negotiated)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
 
 	//
 
@@ -123,5 +336,5 @@ func connect(log logger.Logger, cfg config.Client, t smux.Tunnel) (net.Conn, err
 		return result
 	}
 
-	return snet.CustomConnCloser(cc, close), err
+	return snet.CustomConnCloser(cc, close), nil
 }
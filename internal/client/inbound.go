@@ -11,21 +11,25 @@ import (
 	"github.com/mdouchement/seikan/internal/filter"
 	"github.com/mdouchement/seikan/internal/seikan"
 	"github.com/mdouchement/seikan/internal/smux"
+	"github.com/mdouchement/seikan/internal/snet"
 )
 
 // Inbound handles server to client tunneling.
 type Inbound struct {
 	log          logger.Logger
 	cfg          config.Client
+	keyring      *keyring
 	approver     *filter.Approver
 	destinations map[string]config.Allow
+	compressions map[string]string // Compressions configured by the server, by destination
 }
 
 // NewInbound returns a new Inbound.
-func NewInbound(cfg config.Client, l logger.Logger) (in *Inbound, err error) {
+func NewInbound(cfg config.Client, l logger.Logger, k *keyring) (in *Inbound, err error) {
 	in = &Inbound{
-		cfg: cfg,
-		log: l,
+		cfg:     cfg,
+		log:     l,
+		keyring: k,
 	}
 
 	var stricts, cidrs []string
@@ -77,7 +81,12 @@ func (in *Inbound) establish(destination string) error {
 		IgnoreErrors: in.destinations[destination].IgnoreErrorsRegexp,
 	}
 
-	c, err := connect(log, in.cfg, tun)
+	compression := in.compressions[destination]
+	if compression == "" {
+		compression = in.cfg.Compression
+	}
+
+	c, err := connect(log, in.cfg, in.keyring, tun, compression)
 	if err != nil {
 		return err
 	}
@@ -89,11 +98,20 @@ func (in *Inbound) establish(destination string) error {
 	bind := control.NewBindSC()
 	bind.Identifier = in.cfg.Identifier
 	bind.Address = tun.Destination
+	bind.Metadata = true
+	bind.ServerKey = true
+	bind.Ticket = in.cfg.Server.Resumption
 
-	_, err = control.Do(c, bind)
+	resp, err := do(log, in.cfg, in.keyring, c, bind)
 	if err != nil {
 		return fmt.Errorf("control: %w", err)
 	}
+	if r, ok := resp.(*control.BindSCResp); ok && r.ProxyProtocol > 0 {
+		// Streams start with the original peer address observed by the server.
+		tun.ProxyProtocol = r.ProxyProtocol
+		tun.Metadata = true
+		tun.Trusted = true
+	}
 
 	//
 
@@ -111,7 +129,7 @@ func (in *Inbound) establish(destination string) error {
 func (in *Inbound) getDestinations() (map[string]config.Allow, error) {
 	log := in.log.WithPrefixf("[%s]", basex.GenerateID()).WithPrefix("[ingoing ]")
 
-	c, err := connect(log, in.cfg, smux.Tunnel{Remote: in.cfg.Server.Address})
+	c, err := connect(log, in.cfg, in.keyring, smux.Tunnel{Remote: in.cfg.Server.Address}, in.cfg.Compression)
 	if err != nil {
 		return nil, err
 	}
@@ -122,8 +140,10 @@ func (in *Inbound) getDestinations() (map[string]config.Allow, error) {
 	log.Info("Performing inbounds control")
 	bind := control.NewInbounds()
 	bind.Identifier = in.cfg.Identifier
+	bind.ServerKey = true
+	bind.Ticket = in.cfg.Server.Resumption
 
-	resp, err := control.Do(c, bind)
+	resp, err := do(log, in.cfg, in.keyring, c, bind)
 	if err != nil {
 		return nil, fmt.Errorf("control: %w", err)
 	}
@@ -131,13 +151,23 @@ func (in *Inbound) getDestinations() (map[string]config.Allow, error) {
 	// Check if server's destinations on client host are allowed.
 
 	m := make(map[string]config.Allow)
-	for _, wanted := range resp.(*control.InboundsResp).Inbounds {
+	in.compressions = make(map[string]string)
+	inbounds := resp.(*control.InboundsResp)
+	for _, wanted := range inbounds.Inbounds {
 		err = in.approver.Allowed(context.Background(), wanted)
 		if err != nil {
 			in.log.WithError(err).Warnf("Dropped destination %s", wanted)
 			continue
 		}
 
+		if compression := inbounds.Compressions[wanted]; compression != "" {
+			if _, err := snet.ParseCompression(compression); err != nil {
+				in.log.WithError(err).Warnf("Ignored the compression of destination %s", wanted)
+			} else {
+				in.compressions[wanted] = compression
+			}
+		}
+
 		// Here we are keeping allowed destinations for the next loop.
 		m[wanted] = config.Allow{}
 	}
@@ -2,7 +2,6 @@ package client
 
 import (
 	"fmt"
-	"net"
 
 	"github.com/mdouchement/basex"
 	"github.com/mdouchement/logger"
@@ -10,20 +9,24 @@ import (
 	"github.com/mdouchement/seikan/internal/control"
 	"github.com/mdouchement/seikan/internal/seikan"
 	"github.com/mdouchement/seikan/internal/smux"
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/proxyproto"
 )
 
 // Outbound handles client to server tunneling.
 type Outbound struct {
 	log       logger.Logger
 	cfg       config.Client
+	keyring   *keyring
 	listeners map[string]*smux.DropListener
 }
 
 // NewOutbound returns a new Outbound.
-func NewOutbound(cfg config.Client, l logger.Logger) *Outbound {
+func NewOutbound(cfg config.Client, l logger.Logger, k *keyring) *Outbound {
 	return &Outbound{
 		log:       l,
 		cfg:       cfg,
+		keyring:   k,
 		listeners: make(map[string]*smux.DropListener),
 	}
 }
@@ -32,7 +35,15 @@ func NewOutbound(cfg config.Client, l logger.Logger) *Outbound {
 // It retries in case of error.
 func (out *Outbound) Establish() error {
 	for _, o := range out.cfg.Outbounds {
-		l, err := net.Listen("tcp", o.Source)
+		if o.ProxyProtocol < 0 || o.ProxyProtocol > proxyproto.V2 {
+			return fmt.Errorf("outbound %s: unsupported proxy_protocol version %d", o.Destination, o.ProxyProtocol)
+		}
+
+		if _, err := snet.ParseCompression(o.Compression); err != nil {
+			return fmt.Errorf("outbound %s: compression: %w", o.Destination, err)
+		}
+
+		l, err := snet.ListenEndpoint(o.Source)
 		if err != nil {
 			return err
 		}
@@ -45,7 +56,7 @@ func (out *Outbound) Establish() error {
 		go func(o config.Outbound) {
 			seikan.Retry(func(prev error) error {
 				log := out.log.WithPrefixf("[%s]", basex.GenerateID()).WithPrefix("[outgoing]")
-				err := out.establish(log, o.Source, o.Destination)
+				err := out.establish(log, o)
 				if seikan.IsRetryNewError(prev, err) {
 					log.Errorf("closed (%s)", err) // TODO: if it's retryable, we should not logs closed?
 					return err
@@ -58,18 +69,22 @@ func (out *Outbound) Establish() error {
 	return nil
 }
 
-func (out *Outbound) establish(log logger.Logger, source string, destination string) error {
+func (out *Outbound) establish(log logger.Logger, o config.Outbound) error {
 	tun := smux.Tunnel{
-		Source:      source,
+		Source:      o.Source,
 		Remote:      out.cfg.Server.Address,
-		Destination: destination,
+		Destination: o.Destination,
 	}
 
-	rc, err := connect(log, out.cfg, tun)
+	compression := o.Compression
+	if compression == "" {
+		compression = out.cfg.Compression
+	}
+
+	rc, err := connect(log, out.cfg, out.keyring, tun, compression)
 	if err != nil {
 		return err
 	}
-	defer rc.Close()
 
 	//
 
@@ -77,19 +92,31 @@ func (out *Outbound) establish(log logger.Logger, source string, destination str
 	bind := control.NewBindCS()
 	bind.Identifier = out.cfg.Identifier
 	bind.Address = tun.Destination
+	bind.ProxyProtocol = o.ProxyProtocol
+	bind.ServerKey = true
+	bind.Ticket = out.cfg.Server.Resumption
 
-	_, err = control.Do(rc, bind)
+	resp, err := do(log, out.cfg, out.keyring, rc, bind)
 	if err != nil {
-		return fmt.Errorf("control: %w: %s: %w", seikan.ErrNotRetayable, destination, err)
+		rc.Close()
+		return fmt.Errorf("control: %w: %s: %w", seikan.ErrNotRetayable, o.Destination, err)
+	}
+
+	if r, ok := resp.(*control.BindCSResp); ok {
+		tun.ProxyProtocol = r.ProxyProtocol
+	}
+	if o.ProxyProtocol > 0 && tun.ProxyProtocol == 0 {
+		log.Warnf("PROXY protocol disabled for %s, not enabled by the server allow list", o.Destination)
 	}
 
 	//
 
-	smux, err := smux.NewClient(log, tun, out.listeners[source], rc)
+	smux, err := smux.NewClient(log, tun, out.listeners[o.Source], rc)
 	if err != nil {
+		rc.Close()
 		return fmt.Errorf("failed to initialize smux session: %w", err)
 	}
-	defer smux.Close()
+	defer smux.Close() // Closes also rc, once the live streams are done when the session is drained by the server.
 
 	return smux.Establish()
 }
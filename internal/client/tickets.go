@@ -0,0 +1,100 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/config"
+	"github.com/mdouchement/seikan/internal/noise"
+)
+
+// maxTickets is the maximum number of resumption tickets kept for a server.
+const maxTickets = 8
+
+// resumeTimeout is the maximum duration of a resumption handshake.
+// A server that does not accept the ticket (e.g. restarted) drains the connection silently,
+// the next connection performs a full handshake.
+const resumeTimeout = 5 * time.Second
+
+type (
+	// A keyring holds the server public keys announced during a key rotation and the resumption tickets of a client.
+	// The announced keys replace the configured public keys until the client is restarted.
+	keyring struct {
+		servers sync.Map // Announced server public keys by server address
+		tickets ticketStore
+	}
+
+	// A ticketStore holds the resumption tickets issued by the servers.
+	// A ticket is used once.
+	ticketStore struct {
+		mu      sync.Mutex
+		entries map[ticketKey][]ticket
+	}
+
+	// A ticketKey identifies the server and the client identity a ticket has been issued for.
+	ticketKey struct {
+		address    string
+		identifier string
+		server     string // Public key of the server
+	}
+
+	// A ticket is a resumption ticket issued by a server.
+	ticket struct {
+		sealed   []byte
+		psk      string
+		notAfter time.Time
+	}
+)
+
+// public returns the public key of the server, the announced one during a key rotation.
+func (k *keyring) public(c config.Client) string {
+	if v, ok := k.servers.Load(c.Server.Address); ok {
+		return v.(string)
+	}
+	return c.Server.Public
+}
+
+// ticketKey returns the key of the tickets issued by the server of c for the identity of c.
+func (k *keyring) ticketKey(c config.Client) ticketKey {
+	return ticketKey{
+		address:    c.Server.Address,
+		identifier: c.Identifier,
+		server:     noise.PublicKey(k.public(c)),
+	}
+}
+
+// put adds a ticket issued for the given key, the oldest one is dropped when full.
+func (s *ticketStore) put(key ticketKey, t ticket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[ticketKey][]ticket)
+	}
+
+	entries := append(s.entries[key], t)
+	if len(entries) > maxTickets {
+		entries = entries[len(entries)-maxTickets:]
+	}
+	s.entries[key] = entries
+}
+
+// take removes and returns the newest valid ticket issued for the given key.
+func (s *ticketStore) take(key ticketKey, now time.Time) (ticket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.entries[key]
+	for len(entries) > 0 {
+		t := entries[len(entries)-1]
+		entries = entries[:len(entries)-1]
+
+		if now.Before(t.notAfter) {
+			s.entries[key] = entries
+			return t, true
+		}
+	}
+
+	delete(s.entries, key)
+	return ticket{}, false
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"time"
 
 	"go.yaml.in/yaml/v3"
 )
@@ -15,6 +16,16 @@ type (
 		Address string `yaml:"address"`
 		Secret  string `yaml:"secret"`
 		Public  string `yaml:"public"`
+		// KnownHosts is the pin file used when Public is empty, the server public key is pinned on first use.
+		KnownHosts string `yaml:"known_hosts"`
+		// Proxy is the upstream proxy used by the client to reach the server (http:// or socks5://).
+		Proxy string `yaml:"proxy"`
+		// KeyLookup lets the server identify the client from its public key instead of its identifier.
+		// It requires the server public key and a server supporting it.
+		KeyLookup bool `yaml:"key_lookup"`
+		// Resumption reconnects with the tickets issued by the server, falling back to a full handshake.
+		// It requires the server public key and a server supporting it.
+		Resumption bool `yaml:"resumption"`
 	}
 
 	// A Log handles logging details.
@@ -29,6 +40,12 @@ type (
 		Identifier  string `yaml:"identifier"`
 		Source      string `yaml:"source"`
 		Destination string `yaml:"destination"`
+		// ProxyProtocol is the PROXY protocol version (1 or 2) sent to the destination, disabled when zero.
+		// Client side, it forwards the original peer address to the server, which decides the header it sends.
+		ProxyProtocol int `yaml:"proxy_protocol"`
+		// Compression is the compression of the tunnel (e.g. `lz4' or `zstd:3+adaptive').
+		// Server side, it is sent to the client of the inbound.
+		Compression string `yaml:"compression"`
 	}
 
 	// An Allow is a list of allowed endpoints wit options.
@@ -37,32 +54,148 @@ type (
 		Endpoint           string           `yaml:"endpoint"`
 		IgnoreErrors       []string         `yaml:"ignore_errors"`
 		IgnoreErrorsRegexp []*regexp.Regexp `yaml:"-"`
+		// ProxyProtocol is the PROXY protocol version (1 or 2) sent by the server to the allowed destinations, disabled when zero.
+		ProxyProtocol int `yaml:"proxy_protocol"`
 	}
 
 	AllowWrapper struct {
 		Allow
 	}
+
+	// A ClientKey holds the keys of a client registered on the server.
+	// It is unmarshaled from a single public key or a mapping.
+	ClientKey struct {
+		Public string `yaml:"public"`
+		// PSK is the optional pre-shared key of the client.
+		PSK string `yaml:"psk"`
+		// PostQuantum requires the client to use the hybrid X25519 + ML-KEM-768 handshake.
+		PostQuantum bool `yaml:"post_quantum"`
+		// CipherSuite is the suite used by the client, the only one tried by the legacy lookup.
+		CipherSuite CipherSuite `yaml:"cipher_suite"`
+		// NotBefore and NotAfter bound the validity of the client, unbounded when zero.
+		NotBefore time.Time `yaml:"not_before"`
+		NotAfter  time.Time `yaml:"not_after"`
+		// ProxySources are the networks of the original addresses the client is trusted to forward in the PROXY protocol headers.
+		// The client address observed by the server is sent otherwise.
+		ProxySources []string `yaml:"proxy_sources"`
+	}
+
+	// A CipherSuite selects the Noise cipher (chacha20poly1305, aes256gcm) and hash (blake2b, blake2s) functions.
+	// Empty fields select chacha20poly1305 and blake2b.
+	CipherSuite struct {
+		Cipher string `yaml:"cipher"`
+		Hash   string `yaml:"hash"`
+	}
+
+	// A Rekey holds the rekeying policy of the encrypted session, zero values are disabled.
+	// The encryption key is always rekeyed every 16k chunks.
+	Rekey struct {
+		Interval time.Duration `yaml:"interval"`
+		Bytes    uint64        `yaml:"bytes"`
+		Chunks   uint64        `yaml:"chunks"`
+		// Rehandshake is the interval between two full Noise handshakes performed over the live session.
+		Rehandshake time.Duration `yaml:"rehandshake"`
+	}
+
+	// An Obfuscation hides the size of the encrypted data, it is used when enabled by any of the peers.
+	Obfuscation struct {
+		Enabled bool `yaml:"enabled"`
+		// Padding is none, random or bucket.
+		Padding string `yaml:"padding"`
+		// Cover is the idle duration before sending a cover chunk, disabled when zero.
+		Cover time.Duration `yaml:"cover"`
+	}
+
+	// A ReplayProtection holds the validation of the time embedded in the client identifiers.
+	ReplayProtection struct {
+		// ClockSkew is the maximum difference between the client and server clocks (default 2m).
+		ClockSkew time.Duration `yaml:"clock_skew"`
+		// Legacy accepts the identifiers without a valid time (older clients), they are remembered for a fixed duration.
+		// It is enabled when unset so the server can be upgraded before its clients.
+		Legacy *bool `yaml:"legacy"`
+	}
+
+	// A Resumption holds the session resumption tickets issued by the server.
+	Resumption struct {
+		Enabled bool `yaml:"enabled"`
+		// Lifetime is the validity of a ticket and the rotation interval of the ticket key (default 1h).
+		Lifetime time.Duration `yaml:"lifetime"`
+	}
+
+	// A Restart holds the handover of the listeners to a new server process.
+	Restart struct {
+		// DrainTimeout is the maximum duration the live sessions are drained before being closed (default 10m).
+		DrainTimeout time.Duration `yaml:"drain_timeout"`
+	}
+
+	// A Keypair is a previous keypair of the server, still accepted until NotAfter.
+	Keypair struct {
+		Secret   string    `yaml:"secret"`
+		Public   string    `yaml:"public"`
+		NotAfter time.Time `yaml:"not_after"`
+	}
+
+	// Addresses is a list of listening addresses.
+	// It is unmarshaled from a single address or a list of addresses.
+	Addresses []string
 )
 
 // A Server holds server's configuration fields.
 type Server struct {
-	Connection `yaml:",inline"`
-	Clients    map[string]string `yaml:"clients"`
-	Log        Log               `yaml:"log"`
-	AllowList  []AllowWrapper    `yaml:"allow_list"`
-	Outbounds  []Outbound        `yaml:"outbounds"`
+	Address Addresses `yaml:"address"`
+	Secret  string    `yaml:"secret"`
+	Public  string    `yaml:"public"`
+	// PreviousKeys are the rotated keypairs still accepted from the clients using the key lookup.
+	PreviousKeys []Keypair            `yaml:"previous_keys"`
+	Clients      map[string]ClientKey `yaml:"clients"`
+	// CipherSuites is the list of suites accepted from the clients, the default suite when empty.
+	CipherSuites []CipherSuite `yaml:"cipher_suites"`
+	Rekey        Rekey         `yaml:"rekey"`
+	Obfuscation  Obfuscation   `yaml:"obfuscation"`
+	// ReplayProtection rejects the replayed or too old client identifiers.
+	ReplayProtection ReplayProtection `yaml:"replay_protection"`
+	// Resumption issues tickets letting the clients resume their sessions with a cheaper handshake.
+	Resumption Resumption `yaml:"resumption"`
+	// Restart holds the zero-downtime restart options (SIGUSR2).
+	Restart Restart `yaml:"restart"`
+	// CompressionLevels are the maximum levels of the compressions requested by the clients, by algorithm.
+	// Unset algorithms use the default maximum levels (zstd:3, lz4:1 and s2:2).
+	CompressionLevels map[string]int `yaml:"compression_levels"`
+	// Revocations is the revocation list file of the clients (identifiers or public keys), read again when modified.
+	Revocations string `yaml:"revocations"`
+	// KeyLookupOnly rejects the clients identified by their identifier, only the key lookup is accepted.
+	KeyLookupOnly bool `yaml:"key_lookup_only"`
+	// CA is the public key of the certificate authority, any client presenting a valid certificate is trusted.
+	CA        string         `yaml:"ca"`
+	Log       Log            `yaml:"log"`
+	AllowList []AllowWrapper `yaml:"allow_list"`
+	Outbounds []Outbound     `yaml:"outbounds"`
+	// ProxyProtocol is the list of trusted upstream CIDRs allowed to send a PROXY protocol header.
+	ProxyProtocol []string `yaml:"proxy_protocol"`
 }
 
 // A Client holds client's configuration fields.
 type Client struct {
-	Identifier string         `yaml:"identifier"`
-	Server     Connection     `yaml:"server"`
-	Secret     string         `yaml:"secret"`
-	Public     string         `yaml:"public"`
-	Log        Log            `yaml:"log"`
-	Inbound    bool           `yaml:"inbound"`
-	AllowList  []AllowWrapper `yaml:"allow_list"`
-	Outbounds  []Outbound     `yaml:"outbounds"`
+	Identifier string     `yaml:"identifier"`
+	Server     Connection `yaml:"server"`
+	Secret     string     `yaml:"secret"`
+	Public     string     `yaml:"public"`
+	PSK        string     `yaml:"psk"`
+	// Certificate is the certificate of the public key signed by the server's certificate authority.
+	// It requires the key lookup.
+	Certificate string `yaml:"certificate"`
+	// PostQuantum enables the hybrid X25519 + ML-KEM-768 handshake.
+	PostQuantum bool           `yaml:"post_quantum"`
+	CipherSuite CipherSuite    `yaml:"cipher_suite"`
+	Rekey       Rekey          `yaml:"rekey"`
+	Obfuscation Obfuscation    `yaml:"obfuscation"`
+	Log         Log            `yaml:"log"`
+	Inbound     bool           `yaml:"inbound"`
+	AllowList   []AllowWrapper `yaml:"allow_list"`
+	Outbounds   []Outbound     `yaml:"outbounds"`
+	// Compression is the default compression of the tunnels (none, zstd, lz4 or s2 with an optional level and adaptive mode),
+	// the zstd stream of the previous versions when empty.
+	Compression string `yaml:"compression"`
 }
 
 // Load loads a configuration file.
@@ -103,3 +236,32 @@ func (a *AllowWrapper) UnmarshalYAML(value *yaml.Node) error {
 
 	return nil
 }
+
+func (k *ClientKey) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&k.Public)
+	}
+
+	type plain ClientKey
+	return value.Decode((*plain)(k))
+}
+
+func (a *Addresses) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		var address string
+		if err := value.Decode(&address); err != nil {
+			return err
+		}
+
+		*a = Addresses{address}
+		return nil
+	}
+
+	var addresses []string
+	if err := value.Decode(&addresses); err != nil {
+		return err
+	}
+
+	*a = addresses
+	return nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/mdouchement/seikan/internal/keystore"
+)
+
+// ResolveSecrets replaces the secret references (`file:', `env:' or `keystore:') by the secrets.
+func (s *Server) ResolveSecrets() error {
+	secrets := map[string]*string{
+		"secret": &s.Secret,
+	}
+	for i := range s.PreviousKeys {
+		secrets[fmt.Sprintf("previous_keys[%d].secret", i)] = &s.PreviousKeys[i].Secret
+	}
+
+	// The clients are map values, their pre-shared keys are resolved on copies.
+	psks := make(map[string]*string, len(s.Clients))
+	for identifier, client := range s.Clients {
+		psks[identifier] = &client.PSK
+		secrets[fmt.Sprintf("clients.%s.psk", identifier)] = psks[identifier]
+	}
+
+	if err := resolveSecrets(secrets); err != nil {
+		return err
+	}
+
+	for identifier, psk := range psks {
+		client := s.Clients[identifier]
+		client.PSK = *psk
+		s.Clients[identifier] = client
+	}
+	return nil
+}
+
+// ResolveSecrets replaces the secret references (`file:', `env:' or `keystore:') by the secrets.
+// The certificate can be referenced the same way.
+func (c *Client) ResolveSecrets() error {
+	return resolveSecrets(map[string]*string{
+		"secret":        &c.Secret,
+		"server.secret": &c.Server.Secret,
+		"psk":           &c.PSK,
+		"certificate":   &c.Certificate,
+	})
+}
+
+// resolveSecrets resolves the given secrets, the passphrase of the keystores is asked once.
+func resolveSecrets(secrets map[string]*string) error {
+	var passphrase []byte
+	unlock := func() ([]byte, error) {
+		if passphrase != nil {
+			return passphrase, nil
+		}
+
+		var err error
+		passphrase, err = keystore.Passphrase(false)
+		return passphrase, err
+	}
+
+	for name, secret := range secrets {
+		if *secret == "" {
+			continue
+		}
+
+		v, err := keystore.Resolve(*secret, unlock)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*secret = v
+	}
+
+	return nil
+}
@@ -18,6 +18,8 @@ const (
 	BindCSRespID   ID = 0x05
 	BindSCID       ID = 0x06
 	BindSCRespID   ID = 0x07
+	ServerKeyID    ID = 0x08
+	TicketID       ID = 0x09
 )
 
 func (id ID) String() string {
@@ -36,6 +38,10 @@ func (id ID) String() string {
 		return "bind_sc"
 	case BindSCRespID:
 		return "bind_sc_resp"
+	case ServerKeyID:
+		return "server_key"
+	case TicketID:
+		return "ticket"
 	default:
 		return fmt.Sprintf("%X", uint8(id))
 	}
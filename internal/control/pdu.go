@@ -20,6 +20,12 @@ type PDU interface {
 
 // Do sends the given pdu and returns the pdu response.
 func Do(c net.Conn, pdu PDU) (PDU, error) {
+	return DoNotify(c, pdu, nil)
+}
+
+// DoNotify sends the given pdu and returns the pdu response.
+// The notices received before the response (ServerKey and Ticket) are given to notify.
+func DoNotify(c net.Conn, pdu PDU, notify func(PDU)) (PDU, error) {
 	err := EncodeTo(c, pdu)
 	if err != nil {
 		return nil, fmt.Errorf("encode: %w", err)
@@ -28,9 +34,18 @@ func Do(c net.Conn, pdu PDU) (PDU, error) {
 	pid := pdu.PID()
 	cid := pdu.ControlID()
 
-	pdu, err = Decode(c)
-	if err != nil {
-		return nil, fmt.Errorf("decode: %w", err)
+	for {
+		pdu, err = Decode(c)
+		if err != nil {
+			return nil, fmt.Errorf("decode: %w", err)
+		}
+
+		if !notice(pdu) || pdu.PID() != pid {
+			break
+		}
+		if notify != nil {
+			notify(pdu)
+		}
 	}
 
 	if pdu.PID() != pid && (pdu.ControlID() != respIDFor(cid) || pdu.ControlID() != ErrorID) {
@@ -124,6 +139,14 @@ func Decode(r io.Reader) (PDU, error) {
 		pdu = &BindSCResp{
 			Header: hdr,
 		}
+	case ServerKeyID:
+		pdu = &ServerKey{
+			Header: hdr,
+		}
+	case TicketID:
+		pdu = &Ticket{
+			Header: hdr,
+		}
 	}
 
 	if err := cbor.Unmarshal(p, pdu); err != nil {
@@ -133,6 +156,16 @@ func Decode(r io.Reader) (PDU, error) {
 	return pdu, nil
 }
 
+// notice returns true if the given pdu is sent by the server before the response to a request.
+func notice(pdu PDU) bool {
+	switch pdu.(type) {
+	case *ServerKey, *Ticket:
+		return true
+	default:
+		return false
+	}
+}
+
 func respIDFor(id ID) ID {
 	switch id {
 	case InboundsID:
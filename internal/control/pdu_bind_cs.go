@@ -8,6 +8,13 @@ type BindCS struct {
 	*Header    `cbor:"-"`
 	Identifier string `cbor:"identifier"`
 	Address    string `cbor:"address"`
+	// ProxyProtocol is the PROXY protocol version requested for the destination.
+	// Streams then start with the original peer address as metadata.
+	ProxyProtocol int `cbor:"proxy_protocol,omitempty"`
+	// ServerKey accepts a ServerKey before the response.
+	ServerKey bool `cbor:"server_key,omitempty"`
+	// Ticket accepts a Ticket before the response.
+	Ticket bool `cbor:"ticket,omitempty"`
 }
 
 // NewBindCS returns a new BindCS.
@@ -24,6 +31,8 @@ func NewBindCS() *BindCS {
 // BindCSResp is the response to BindCS.
 type BindCSResp struct {
 	*Header `cbor:"-"`
+	// ProxyProtocol is the PROXY protocol version accepted by the server, zero if not supported.
+	ProxyProtocol int `cbor:"proxy_protocol,omitempty"`
 }
 
 // NewBindCSResp returns a new BindCSResp.
@@ -23,6 +23,7 @@ func TestBindCSSerialization(t *testing.T) {
 	input := control.NewBindCS()
 	input.Identifier = "id-1"
 	input.Address = "@"
+	input.ProxyProtocol = 2
 
 	p, err := control.Encode(input)
 	assert.NoError(t, err)
@@ -46,6 +47,7 @@ func TestBindCSResp(t *testing.T) {
 
 func TestBindCSRespSerialization(t *testing.T) {
 	input := control.NewBindCSResp("unique-id")
+	input.ProxyProtocol = 2
 
 	p, err := control.Encode(input)
 	assert.NoError(t, err)
@@ -8,6 +8,12 @@ type BindSC struct {
 	*Header    `cbor:"-"`
 	Identifier string `cbor:"identifier"`
 	Address    string `cbor:"address"`
+	// Metadata is true when the client can read the original peer address at the beginning of streams.
+	Metadata bool `cbor:"metadata,omitempty"`
+	// ServerKey accepts a ServerKey before the response.
+	ServerKey bool `cbor:"server_key,omitempty"`
+	// Ticket accepts a Ticket before the response.
+	Ticket bool `cbor:"ticket,omitempty"`
 }
 
 // NewBindSC returns a new BindSC.
@@ -24,6 +30,8 @@ func NewBindSC() *BindSC {
 // BindSCResp is the response to BindSC.
 type BindSCResp struct {
 	*Header `cbor:"-"`
+	// ProxyProtocol is the PROXY protocol version the client must send to the destination, disabled when zero.
+	ProxyProtocol int `cbor:"proxy_protocol,omitempty"`
 }
 
 // NewBindSCResp returns a new BindSCResp.
@@ -23,6 +23,7 @@ func TestBindSCSerialization(t *testing.T) {
 	input := control.NewBindSC()
 	input.Identifier = "id-1"
 	input.Address = "@"
+	input.Metadata = true
 
 	p, err := control.Encode(input)
 	assert.NoError(t, err)
@@ -46,6 +47,7 @@ func TestBindSCResp(t *testing.T) {
 
 func TestBindSCRespSerialization(t *testing.T) {
 	input := control.NewBindSCResp("unique-id")
+	input.ProxyProtocol = 1
 
 	p, err := control.Encode(input)
 	assert.NoError(t, err)
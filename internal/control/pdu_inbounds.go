@@ -6,6 +6,10 @@ import "github.com/mdouchement/basex"
 type Inbounds struct {
 	*Header    `cbor:"-"`
 	Identifier string `cbor:"identifier"`
+	// ServerKey accepts a ServerKey before the response.
+	ServerKey bool `cbor:"server_key,omitempty"`
+	// Ticket accepts a Ticket before the response.
+	Ticket bool `cbor:"ticket,omitempty"`
 }
 
 // NewInbounds returns a new Inbounds.
@@ -23,6 +27,8 @@ func NewInbounds() *Inbounds {
 type InboundsResp struct {
 	*Header  `cbor:"-"`
 	Inbounds []string `cbor:"inbounds"`
+	// Compressions are the compressions configured by the server, by inbound.
+	Compressions map[string]string `cbor:"compressions,omitempty"`
 }
 
 // NewInboundsResp returns a new InboundsResp.
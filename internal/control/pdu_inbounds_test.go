@@ -46,6 +46,7 @@ func TestInboudsResp(t *testing.T) {
 func TestInboudsRespSerialization(t *testing.T) {
 	input := control.NewInboundsResp("unique-id")
 	input.Inbounds = []string{"@1", "@2"}
+	input.Compressions = map[string]string{"@2": "lz4+adaptive"}
 
 	p, err := control.Encode(input)
 	assert.NoError(t, err)
@@ -0,0 +1,36 @@
+package control
+
+// ServerKey is sent by the server before the response to a request accepting it (see ServerKey fields of the requests).
+// It announces the current public key of the server to a client that performed the handshake with a previous one.
+type ServerKey struct {
+	*Header `cbor:"-"`
+	// Public is the current public key of the server.
+	Public string `cbor:"public"`
+	// NotAfter is the Unix time after which the previous key used by the client is no longer accepted.
+	NotAfter int64 `cbor:"not_after"`
+}
+
+// NewServerKey returns a new ServerKey for the request of the given id.
+func NewServerKey(id string) *ServerKey {
+	return &ServerKey{
+		Header: &Header{
+			version: 0x01,
+			cid:     ServerKeyID,
+			pid:     id,
+		},
+	}
+}
+
+// AcceptsServerKey returns true if the given request accepts a ServerKey before its response.
+func AcceptsServerKey(pdu PDU) bool {
+	switch p := pdu.(type) {
+	case *Inbounds:
+		return p.ServerKey
+	case *BindCS:
+		return p.ServerKey
+	case *BindSC:
+		return p.ServerKey
+	default:
+		return false
+	}
+}
@@ -0,0 +1,74 @@
+package control_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mdouchement/basex"
+	"github.com/mdouchement/seikan/internal/control"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerKey(t *testing.T) {
+	id := basex.GenerateID()
+	var pdu control.PDU = control.NewServerKey(id) // interface compliance
+	pdu.RawHeader().SetSize(42)
+
+	assert.Equal(t, 42, pdu.Size())
+	assert.Equal(t, 0x01, pdu.Version())
+	assert.Equal(t, control.ServerKeyID, pdu.ControlID())
+	assert.Equal(t, id, pdu.PID())
+}
+
+func TestServerKeySerialization(t *testing.T) {
+	input := control.NewServerKey("unique-id")
+	input.Public = "pk-trololo"
+	input.NotAfter = 1798761600
+
+	p, err := control.Encode(input)
+	assert.NoError(t, err)
+
+	output, err := control.Decode(bytes.NewBuffer(p))
+	assert.NoError(t, err)
+
+	assert.Equal(t, input, output)
+}
+
+func TestAcceptsServerKey(t *testing.T) {
+	bind := control.NewBindCS()
+	assert.False(t, control.AcceptsServerKey(bind))
+
+	bind.ServerKey = true
+	assert.True(t, control.AcceptsServerKey(bind))
+	assert.False(t, control.AcceptsServerKey(control.NewError("unique-id")))
+}
+
+func TestDoNotify(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		pdu, err := control.Decode(server)
+		if err != nil {
+			return
+		}
+
+		notice := control.NewServerKey(pdu.PID())
+		notice.Public = "pk-trololo"
+		control.EncodeTo(server, notice)
+		control.EncodeTo(server, control.NewInboundsResp(pdu.PID()))
+	}()
+
+	var notices []*control.ServerKey
+	resp, err := control.DoNotify(client, control.NewInbounds(), func(notice control.PDU) {
+		notices = append(notices, notice.(*control.ServerKey))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, control.InboundsRespID, resp.ControlID())
+
+	if assert.Len(t, notices, 1) {
+		assert.Equal(t, "pk-trololo", notices[0].Public)
+	}
+}
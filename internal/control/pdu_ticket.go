@@ -0,0 +1,38 @@
+package control
+
+// Ticket is sent by the server before the response to a request accepting it (see Ticket fields of the requests).
+// It gives the client a resumption ticket for its next connection.
+type Ticket struct {
+	*Header `cbor:"-"`
+	// Ticket is the encrypted ticket, opaque to the client.
+	Ticket []byte `cbor:"ticket"`
+	// PSK is the pre-shared key of the resumption handshake.
+	PSK string `cbor:"psk"`
+	// NotAfter is the Unix time after which the ticket is no longer accepted.
+	NotAfter int64 `cbor:"not_after"`
+}
+
+// NewTicket returns a new Ticket for the request of the given id.
+func NewTicket(id string) *Ticket {
+	return &Ticket{
+		Header: &Header{
+			version: 0x01,
+			cid:     TicketID,
+			pid:     id,
+		},
+	}
+}
+
+// AcceptsTicket returns true if the given request accepts a Ticket before its response.
+func AcceptsTicket(pdu PDU) bool {
+	switch p := pdu.(type) {
+	case *Inbounds:
+		return p.Ticket
+	case *BindCS:
+		return p.Ticket
+	case *BindSC:
+		return p.Ticket
+	default:
+		return false
+	}
+}
@@ -0,0 +1,77 @@
+package control_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/mdouchement/basex"
+	"github.com/mdouchement/seikan/internal/control"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTicket(t *testing.T) {
+	id := basex.GenerateID()
+	var pdu control.PDU = control.NewTicket(id) // interface compliance
+	pdu.RawHeader().SetSize(42)
+
+	assert.Equal(t, 42, pdu.Size())
+	assert.Equal(t, 0x01, pdu.Version())
+	assert.Equal(t, control.TicketID, pdu.ControlID())
+	assert.Equal(t, id, pdu.PID())
+}
+
+func TestTicketSerialization(t *testing.T) {
+	input := control.NewTicket("unique-id")
+	input.Ticket = []byte("trololo")
+	input.PSK = "psk-trololo"
+	input.NotAfter = 1798761600
+
+	p, err := control.Encode(input)
+	assert.NoError(t, err)
+
+	output, err := control.Decode(bytes.NewBuffer(p))
+	assert.NoError(t, err)
+
+	assert.Equal(t, input, output)
+}
+
+func TestAcceptsTicket(t *testing.T) {
+	bind := control.NewBindSC()
+	assert.False(t, control.AcceptsTicket(bind))
+
+	bind.Ticket = true
+	assert.True(t, control.AcceptsTicket(bind))
+	assert.False(t, control.AcceptsTicket(control.NewError("unique-id")))
+}
+
+func TestDoNotify_Ticket(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		pdu, err := control.Decode(server)
+		if err != nil {
+			return
+		}
+
+		key := control.NewServerKey(pdu.PID())
+		key.Public = "pk-trololo"
+		control.EncodeTo(server, key)
+
+		ticket := control.NewTicket(pdu.PID())
+		ticket.Ticket = []byte("trololo")
+		control.EncodeTo(server, ticket)
+
+		control.EncodeTo(server, control.NewBindCSResp(pdu.PID()))
+	}()
+
+	var notices []control.ID
+	resp, err := control.DoNotify(client, control.NewBindCS(), func(notice control.PDU) {
+		notices = append(notices, notice.ControlID())
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, control.BindCSRespID, resp.ControlID())
+	assert.Equal(t, []control.ID{control.ServerKeyID, control.TicketID}, notices)
+}
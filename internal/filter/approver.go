@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/url"
 	"slices"
+	"strings"
 )
 
 // ErrHostNotAllowed is returned when a host is not allowed.
@@ -37,6 +38,11 @@ func (f *Approver) Allowed(ctx context.Context, host string) error {
 		return nil
 	}
 
+	if strings.HasPrefix(host, "unix://") {
+		// Unix domain sockets can only be allowed by a strict entry.
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+
 	// Resolve returns an error if there is no matching CIDRs for the given hostname.
 	_, _, err := f.resolver.Resolve(ctx, (&url.URL{Host: host}).Hostname())
 	if err != nil {
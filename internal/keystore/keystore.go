@@ -0,0 +1,192 @@
+// Package keystore resolves the secret keys referenced by the configuration files
+// and protects them with a passphrase.
+package keystore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mdouchement/seikan/pkg/base58"
+	"go.yaml.in/yaml/v3"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Secret reference prefixes.
+const (
+	PrefixFile     = "file:"
+	PrefixEnv      = "env:"
+	PrefixKeystore = "keystore:"
+)
+
+// scrypt parameters of the new keystores.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	saltLength = 16
+	version    = 1
+)
+
+// Upper bounds of the scrypt parameters read from a keystore file (1 GiB of memory at most).
+const (
+	maxScryptN = 1 << 20
+	maxScryptR = 8
+	maxScryptP = 4
+)
+
+// additionalData is authenticated with the encrypted secret.
+var additionalData = []byte("seikan-keystore-v1")
+
+// A Keystore holds a secret encrypted with a key derived from a passphrase.
+type Keystore struct {
+	Version int    `yaml:"version"`
+	KDF     string `yaml:"kdf"`
+	// N, R and P are the scrypt cost, block size and parallelization parameters.
+	N      int    `yaml:"cost"`
+	R      int    `yaml:"block_size"`
+	P      int    `yaml:"parallelism"`
+	Salt   string `yaml:"salt"`
+	Cipher string `yaml:"cipher"`
+	Nonce  string `yaml:"nonce"`
+	// Ciphertext is the encrypted secret.
+	Ciphertext string `yaml:"ciphertext"`
+}
+
+// Encrypt returns the keystore of the given secret encrypted with the given passphrase.
+// The key is derived with scrypt and the secret is encrypted with ChaCha20-Poly1305.
+func Encrypt(secret string, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(Keystore{
+		Version:    version,
+		KDF:        "scrypt",
+		N:          scryptN,
+		R:          scryptR,
+		P:          scryptP,
+		Salt:       base58.Encode(salt),
+		Cipher:     "chacha20poly1305",
+		Nonce:      base58.Encode(nonce),
+		Ciphertext: base58.Encode(aead.Seal(nil, nonce, []byte(secret), additionalData)),
+	})
+}
+
+// Decrypt returns the secret of the given keystore encrypted with the given passphrase.
+func Decrypt(data []byte, passphrase []byte) (string, error) {
+	var ks Keystore
+	if err := yaml.Unmarshal(data, &ks); err != nil {
+		return "", fmt.Errorf("keystore: %w", err)
+	}
+
+	if ks.Version != version || ks.KDF != "scrypt" || ks.Cipher != "chacha20poly1305" {
+		return "", errors.New("keystore: unsupported format")
+	}
+
+	if ks.N > maxScryptN || ks.R > maxScryptR || ks.P > maxScryptP {
+		return "", fmt.Errorf("keystore: scrypt parameters exceed N=%d, r=%d and p=%d", maxScryptN, maxScryptR, maxScryptP)
+	}
+
+	nonce := base58.Decode(ks.Nonce)
+	if len(nonce) != chacha20poly1305.NonceSize {
+		return "", errors.New("keystore: invalid nonce")
+	}
+
+	key, err := scrypt.Key(passphrase, base58.Decode(ks.Salt), ks.N, ks.R, ks.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return "", fmt.Errorf("keystore: %w", err)
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := aead.Open(nil, nonce, base58.Decode(ks.Ciphertext), additionalData)
+	if err != nil {
+		return "", errors.New("keystore: invalid passphrase")
+	}
+
+	return string(secret), nil
+}
+
+// Resolve returns the secret referenced by the given value:
+//   - `file:<path>' reads the secret from a file
+//   - `env:<name>' reads the secret from an environment variable
+//   - `keystore:<path>' decrypts the secret of a keystore file with the passphrase returned by passphrase
+//
+// Any other value is returned as is.
+func Resolve(value string, passphrase func() ([]byte, error)) (string, error) {
+	switch {
+	case strings.HasPrefix(value, PrefixFile):
+		data, err := os.ReadFile(strings.TrimPrefix(value, PrefixFile))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(value, PrefixEnv):
+		name := strings.TrimPrefix(value, PrefixEnv)
+		secret := strings.TrimSpace(os.Getenv(name))
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s is empty", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, PrefixKeystore):
+		data, err := os.ReadFile(strings.TrimPrefix(value, PrefixKeystore))
+		if err != nil {
+			return "", err
+		}
+
+		p, err := passphrase()
+		if err != nil {
+			return "", err
+		}
+		return Decrypt(data, p)
+	default:
+		return value, nil
+	}
+}
+
+// Write encrypts the given secret with the given passphrase to a new keystore file and returns its reference.
+// An existing file is never overwritten.
+func Write(filename, secret string, passphrase []byte) (string, error) {
+	ks, err := Encrypt(secret, passphrase)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = f.Write(ks); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		return "", err
+	}
+
+	return PrefixKeystore + filename, nil
+}
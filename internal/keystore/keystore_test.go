@@ -0,0 +1,93 @@
+package keystore_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/keystore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncrypt(t *testing.T) {
+	ks, err := keystore.Encrypt("sk-trololo", []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(ks), "trololo")
+
+	secret, err := keystore.Decrypt(ks, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-trololo", secret)
+
+	_, err = keystore.Decrypt(ks, []byte("wrong"))
+	assert.EqualError(t, err, "keystore: invalid passphrase")
+
+	_, err = keystore.Decrypt([]byte("version: 42"), []byte("passphrase"))
+	assert.EqualError(t, err, "keystore: unsupported format")
+
+	// The scrypt parameters of the file are bounded.
+	expensive := strings.Replace(string(ks), "cost: 32768", "cost: 1073741824", 1)
+	_, err = keystore.Decrypt([]byte(expensive), []byte("passphrase"))
+	assert.EqualError(t, err, "keystore: scrypt parameters exceed N=1048576, r=8 and p=4")
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	passphrase := func() ([]byte, error) { return []byte("passphrase"), nil }
+
+	secret, err := keystore.Resolve("sk-inline", passphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-inline", secret)
+
+	//
+
+	filename := filepath.Join(dir, "secret")
+	assert.NoError(t, os.WriteFile(filename, []byte("sk-file\n"), 0o600))
+
+	secret, err = keystore.Resolve("file:"+filename, passphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-file", secret)
+
+	//
+
+	t.Setenv("SEIKAN_TEST_SECRET", "sk-env")
+
+	secret, err = keystore.Resolve("env:SEIKAN_TEST_SECRET", passphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-env", secret)
+
+	_, err = keystore.Resolve("env:SEIKAN_TEST_UNSET", passphrase)
+	assert.EqualError(t, err, "environment variable SEIKAN_TEST_UNSET is empty")
+
+	//
+
+	ks, err := keystore.Encrypt("sk-keystore", []byte("passphrase"))
+	assert.NoError(t, err)
+
+	filename = filepath.Join(dir, "keystore.yml")
+	assert.NoError(t, os.WriteFile(filename, ks, 0o600))
+
+	secret, err = keystore.Resolve("keystore:"+filename, passphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-keystore", secret)
+
+	_, err = keystore.Resolve("keystore:"+filename, func() ([]byte, error) { return nil, errors.New("no passphrase") })
+	assert.EqualError(t, err, "no passphrase")
+}
+
+func TestWrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "keystore")
+	passphrase := func() ([]byte, error) { return []byte("passphrase"), nil }
+
+	reference, err := keystore.Write(filename, "sk-trololo", []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, "keystore:"+filename, reference)
+
+	secret, err := keystore.Resolve(reference, passphrase)
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-trololo", secret)
+
+	_, err = keystore.Write(filename, "sk-other", []byte("passphrase"))
+	assert.ErrorIs(t, err, os.ErrExist)
+}
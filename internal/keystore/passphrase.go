@@ -0,0 +1,51 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// EnvPassphrase is the environment variable holding the passphrase of the keystores.
+const EnvPassphrase = "SEIKAN_PASSPHRASE"
+
+// Passphrase returns the passphrase of the keystores from the environment or prompts it on the terminal.
+// The prompted passphrase is asked twice when confirm is true.
+func Passphrase(confirm bool) ([]byte, error) {
+	if v, ok := os.LookupEnv(EnvPassphrase); ok {
+		return []byte(v), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("passphrase: %s is not set and stdin is not a terminal", EnvPassphrase)
+	}
+
+	passphrase, err := prompt(fd, "Passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		again, err := prompt(fd, "Confirm passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(passphrase, again) {
+			return nil, errors.New("passphrase: mismatch")
+		}
+	}
+
+	return passphrase, nil
+}
+
+func prompt(fd int, message string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, message)
+	defer fmt.Fprintln(os.Stderr)
+
+	return term.ReadPassword(fd)
+}
@@ -0,0 +1,108 @@
+// Package knownhosts pins the public keys of servers on first use (TOFU), like the OpenSSH known_hosts file.
+//
+// Each line of the file is a server address followed by its public key, lines starting by `#' are ignored:
+//
+//	tcp://seikan.example.com:4242 pk-FHpBuj1zYgsbRkD9UhPcHTxrU5jbeSsoUYciFj9yTrFh
+package knownhosts
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrKeyMismatch is returned when the public key of a server differs from the pinned one.
+var ErrKeyMismatch = errors.New("knownhosts: server public key does not match the pinned one")
+
+var mu sync.Mutex
+
+// Verify checks the public key of the server at address against the given pin file.
+// An unknown server is pinned on first use, pinned is true in that case.
+func Verify(filename, address, public string) (pinned bool, err error) {
+	filename, err = expand(filename)
+	if err != nil {
+		return false, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	known, found, err := lookup(filename, address)
+	if err != nil {
+		return false, err
+	}
+
+	if found {
+		if known != public {
+			return false, fmt.Errorf("%w for %s (%s)", ErrKeyMismatch, address, filename)
+		}
+		return false, nil
+	}
+
+	return true, pin(filename, address, public)
+}
+
+func lookup(filename, address string) (string, bool, error) {
+	f, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return "", false, fmt.Errorf("knownhosts: %s:%d: malformed line", filename, n)
+		}
+
+		if fields[0] == address {
+			return fields[1], true, nil
+		}
+	}
+
+	return "", false, scanner.Err()
+}
+
+func pin(filename, address, public string) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(f, "%s %s\n", address, public)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// expand replaces the leading `~' of filename by the home directory.
+func expand(filename string) (string, error) {
+	rest, ok := strings.CutPrefix(filename, "~/")
+	if !ok {
+		return filename, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, rest), nil
+}
@@ -0,0 +1,42 @@
+package knownhosts_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/knownhosts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "seikan", "known_hosts")
+
+	pinned, err := knownhosts.Verify(filename, "tcp://localhost:4242", "pk-server")
+	assert.NoError(t, err)
+	assert.True(t, pinned)
+
+	pinned, err = knownhosts.Verify(filename, "tcp://localhost:4242", "pk-server")
+	assert.NoError(t, err)
+	assert.False(t, pinned)
+
+	_, err = knownhosts.Verify(filename, "tcp://localhost:4242", "pk-attacker")
+	assert.ErrorIs(t, err, knownhosts.ErrKeyMismatch)
+
+	pinned, err = knownhosts.Verify(filename, "quic://localhost:4242", "pk-other")
+	assert.NoError(t, err)
+	assert.True(t, pinned)
+
+	p, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://localhost:4242 pk-server\nquic://localhost:4242 pk-other\n", string(p))
+}
+
+func TestVerify_Malformed(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	err := os.WriteFile(filename, []byte("# comment\n\ntcp://localhost:4242\n"), 0o600)
+	assert.NoError(t, err)
+
+	_, err = knownhosts.Verify(filename, "tcp://localhost:4242", "pk-server")
+	assert.EqualError(t, err, "knownhosts: "+filename+":3: malformed line")
+}
@@ -1,29 +1,167 @@
 package noise
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 
+	"github.com/mdouchement/seikan/pkg/base58"
 	"github.com/mdouchement/seikan/pkg/noise"
 )
 
-// Handshake performs the handshake for Identity sender and recipient using the given net.Conn.
+// A HandshakePattern is a Noise handshake pattern.
+type HandshakePattern = noise.HandshakePattern
+
+// Supported handshake patterns.
+const (
+	PatternIK = noise.PatternIK
+	PatternXX = noise.PatternXX
+	// PatternIKpsk2 is used by a responder resolving the pre-shared key of its peer (see Peer.Resolve).
+	PatternIKpsk2 = noise.PatternIKpsk2
+	// PatternNNpsk0 resumes a session with the pre-shared key of a resumption ticket, no static key is used.
+	PatternNNpsk0 = noise.PatternNNpsk0
+)
+
+// A Peer describes the remote participant of a handshake.
+type Peer struct {
+	Pattern HandshakePattern
+	// Public is the known public key of the peer.
+	// It is optional with the XX pattern when Verify is provided.
+	Public string
+	// Verify is called with the public key received from the peer.
+	Verify func(public string) error
+	// PSK is the optional pre-shared key of the peer, it upgrades the IK pattern to IKpsk2.
+	PSK string
+	// Hybrid combines the IK pattern with an ML-KEM-768 key encapsulation.
+	Hybrid bool
+	// Suite is the cipher suite of the handshake, DefaultSuite when empty.
+	Suite Suite
+	// Lookup reverses the IK roles, the client is the initiator and is identified by its static key.
+	Lookup bool
+	// Resolve is called with the public key received from a peer that is unknown before the handshake,
+	// after Verify when both are set.
+	// It returns the pre-shared key of the peer, used with the IKpsk2 pattern.
+	Resolve func(public string) (psk string, err error)
+	// Certify is called with the public key and the certificate received from the peer (empty if none),
+	// once the handshake payload is decrypted.
+	Certify func(public, certificate string) error
+}
+
+// Handshake performs the handshake for Identity sender and the given peer using the given net.Conn.
 //
-// The cipher suite used is:
+// The default cipher suite is:
 // Curve25519 ECDH, ChaCha20-Poly1305 AEAD, BLAKE2b hash.
+// AES-256-GCM AEAD and BLAKE2s hash can be selected with the peer suite.
 //
 // The handshake uses the IK pattern:
 // I = Static key for initiator Immediately transmitted to responder, despite reduced or absent identity hiding
 // K = Static key for responder Known to initiator
 //
+// or the XX pattern when the peer public key is unknown:
+// X = Static key for initiator/responder Xmitted ("transmitted") to the other side
+//
+// A peer with a pre-shared key upgrades the IK pattern to IKpsk2, the key is mixed in the second message.
+//
+// With a lookup peer, the client initiates the IK pattern and the server resolves the client from its static key
+// received in the first message, the lookup cost does not depend on the number of registered clients.
+//
+// A resumed session uses the NNpsk0 pattern with the pre-shared key of its ticket,
+// the peers are authenticated by the key and only the ephemeral keys are exchanged.
+//
+// A hybrid peer adds an ML-KEM-768 key encapsulation to the IK pattern, the encapsulated key is mixed
+// in the second message (combined with the optional pre-shared key). Both peers must be hybrid.
+//
 // One of the Noise participants should be the initiator.
-func Handshake(c net.Conn, sender Identity, recipient string, initiator bool) (net.Conn, error) {
+//
+// If c exposes a `ChannelBinding() []byte' method (e.g. QUIC), the handshake is bound to the transport's secure channel.
+//
+// Both peers advertise their supported features in the handshake payload, the session options are applied when supported by the peer.
+// The payload also carries the certificate of the sender identity, if any, and the compression requested by the client.
+// The requested compression is negotiated when both peers support it.
+func Handshake(c net.Conn, sender Identity, peer Peer, initiator bool, session SessionOptions) (*Conn, error) {
+	suite := peer.Suite.orDefault()
 	options := noise.HandshakeOptions{
-		Pattern:   noise.PatternIK,
-		Hash:      noise.HashBlake2b,
-		Cipher:    noise.CipherChaCha20Poly1305,
-		Sender:    noise.ParseX25519Identity(sender.private(), sender.public()),
-		Recipient: noise.ParseX25519Recipient(Identity{Public: recipient}.public()),
+		Pattern: peer.Pattern,
+		Hash:    suite.Hash,
+		Cipher:  suite.Cipher,
+		Sender:  noise.ParseX25519Identity(sender.private(), sender.public()),
+	}
+
+	if peer.Public != "" {
+		options.Recipient = noise.ParseX25519Recipient(Identity{Public: peer.Public}.public())
+	}
+
+	if peer.Pattern == PatternIKpsk2 && peer.PSK == "" && peer.Resolve == nil {
+		return nil, errors.New("handshake: IKpsk2 pattern requires a pre-shared key")
+	}
+
+	if peer.Pattern == PatternNNpsk0 && peer.PSK == "" {
+		return nil, errors.New("handshake: NNpsk0 pattern requires a pre-shared key")
+	}
+
+	if peer.PSK != "" {
+		switch peer.Pattern {
+		case PatternIK, PatternIKpsk2:
+			options.Pattern = noise.PatternIKpsk2
+		case PatternNNpsk0:
+		default:
+			return nil, errors.New("handshake: pre-shared key requires the IK pattern")
+		}
+
+		options.PresharedKey = base58.Decode(strings.TrimPrefix(peer.PSK, "psk-"))
+	}
+
+	if peer.Hybrid {
+		if peer.Pattern != PatternIK && peer.Pattern != PatternIKpsk2 {
+			return nil, errors.New("handshake: hybrid mode requires the IK pattern")
+		}
+
+		options.Hybrid = true
+	}
+
+	var received hello
+	var public string
+	var psk string
+	if peer.Verify != nil || peer.Resolve != nil {
+		// The received public key is verified then resolved.
+		options.VerifyPeer = func(key noise.X25519PublicKey) (err error) {
+			public = "pk-" + base58.Encode(key)
+			if peer.Verify != nil {
+				if err = peer.Verify(public); err != nil {
+					return err
+				}
+			}
+
+			if peer.Resolve != nil {
+				psk, err = peer.Resolve(public)
+			}
+			return err
+		}
+	}
+
+	if peer.Resolve != nil && options.Pattern == noise.PatternIKpsk2 && options.PresharedKey == nil {
+		options.PresharedKeyOf = func(noise.X25519PublicKey) ([]byte, error) {
+			return base58.Decode(strings.TrimPrefix(psk, "psk-")), nil
+		}
+	}
+
+	if b, ok := c.(interface{ ChannelBinding() []byte }); ok {
+		options.ChannelBinding = b.ChannelBinding()
+	}
+
+	payload := newHello(session)
+	payload.Certificate = sender.Certificate
+	options.Payload = payload.marshal()
+	options.ReceivePayload = received.unmarshal
+
+	if peer.Certify != nil {
+		options.ReceivePayload = func(payload []byte) error {
+			if err := received.unmarshal(payload); err != nil {
+				return err
+			}
+			return peer.Certify(public, received.Certificate)
+		}
 	}
 
 	cipher, err := noise.Handshake(c, options, initiator)
@@ -31,5 +169,44 @@ func Handshake(c net.Conn, sender Identity, recipient string, initiator bool) (n
 		return nil, fmt.Errorf("handshake: %w", err)
 	}
 
-	return noise.NewChunkedConn(c, cipher), nil
+	return &Conn{
+		Conn:        noise.NewChunkedConnWithOptions(c, cipher, session.stream(received)),
+		Compression: session.compression(received),
+	}, nil
+}
+
+// Advertising returns the HKDF info used to derive the client identifier for the handshake of the given peer.
+// IK with the default suite uses no info to stay compatible with previous clients.
+// Any other suite is appended to the info (e.g. `XX/aes256gcm+blake2s').
+//
+// A lookup peer advertises the IK pattern with its modifiers (e.g. `lookup/IKpsk2+MLKEM768'),
+// the server resolves the client after the first handshake message.
+// A resumed session advertises `resume', the server resolves the client from its ticket.
+func Advertising(peer Peer) []byte {
+	var info []byte
+	switch {
+	case peer.Pattern == PatternNNpsk0:
+		info = []byte("resume")
+	case peer.Lookup:
+		info = []byte("lookup/IK")
+		if peer.PSK != "" || peer.Pattern == PatternIKpsk2 {
+			info = append(info, "psk2"...)
+		}
+		if peer.Hybrid {
+			info = append(info, "+MLKEM768"...)
+		}
+	case peer.Pattern == PatternXX:
+		info = []byte("XX")
+	case peer.Hybrid:
+		info = []byte("IK+MLKEM768")
+	}
+
+	if suite := peer.Suite.orDefault(); suite != DefaultSuite {
+		if len(info) > 0 {
+			info = append(info, '/')
+		}
+		info = append(info, suite.String()...)
+	}
+
+	return info
 }
@@ -0,0 +1,276 @@
+package noise_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/noise"
+	pnoise "github.com/mdouchement/seikan/pkg/noise"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandshake_Session(t *testing.T) {
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+
+	obfuscated := noise.SessionOptions{
+		Rekey:       noise.RekeyPolicy{Chunks: 1},
+		Obfuscation: noise.Obfuscation{Enabled: true, Padding: pnoise.PaddingBucket},
+	}
+
+	sessions := [][2]noise.SessionOptions{
+		{{}, {}},
+		{obfuscated, {}},
+		{{}, obfuscated},
+		{obfuscated, obfuscated},
+	}
+
+	for _, session := range sessions {
+		c1, c2 := net.Pipe()
+
+		errc := make(chan error, 1)
+		go func() {
+			c, err := noise.Handshake(c1, server, noise.Peer{Pattern: noise.PatternIK, Public: client.Public}, true, session[0])
+			if err == nil {
+				_, err = c.Write([]byte("trololo"))
+			}
+			errc <- err
+		}()
+
+		c, err := noise.Handshake(c2, client, noise.Peer{Pattern: noise.PatternIK, Public: server.Public}, false, session[1])
+		assert.NoError(t, err)
+
+		p := make([]byte, 7)
+		_, err = io.ReadFull(c, p)
+		assert.NoError(t, err)
+		assert.Equal(t, "trololo", string(p))
+		assert.NoError(t, <-errc)
+
+		c1.Close()
+		c2.Close()
+	}
+}
+
+func TestHandshake_Lookup(t *testing.T) {
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+	psk := noise.GeneratePSK()
+
+	clients := []noise.Peer{
+		{Pattern: noise.PatternIK, Public: server.Public, Lookup: true},
+		{Pattern: noise.PatternIK, Public: server.Public, PSK: psk, Hybrid: true, Lookup: true},
+	}
+
+	for _, peer := range clients {
+		c1, c2 := net.Pipe()
+
+		pattern := noise.PatternIK
+		if peer.PSK != "" {
+			pattern = noise.PatternIKpsk2
+		}
+
+		var resolved string
+		errc := make(chan error, 1)
+		go func() {
+			responder := noise.Peer{
+				Pattern: pattern,
+				Hybrid:  peer.Hybrid,
+				Lookup:  true,
+				Resolve: func(public string) (string, error) {
+					resolved = public
+					return psk, nil
+				},
+			}
+
+			c, err := noise.Handshake(c1, server, responder, false, noise.SessionOptions{})
+			if err == nil {
+				_, err = c.Write([]byte("trololo"))
+			}
+			errc <- err
+		}()
+
+		c, err := noise.Handshake(c2, client, peer, true, noise.SessionOptions{})
+		assert.NoError(t, err)
+
+		p := make([]byte, 7)
+		_, err = io.ReadFull(c, p)
+		assert.NoError(t, err)
+		assert.Equal(t, "trololo", string(p))
+		assert.NoError(t, <-errc)
+		assert.Equal(t, client.Public, resolved)
+
+		c1.Close()
+		c2.Close()
+	}
+}
+
+func TestHandshake_VerifyResolve(t *testing.T) {
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+
+	for _, rejected := range []bool{false, true} {
+		c1, c2 := net.Pipe()
+
+		var calls []string
+		errc := make(chan error, 1)
+		go func() {
+			responder := noise.Peer{
+				Pattern: noise.PatternIK,
+				Lookup:  true,
+				Verify: func(public string) error {
+					calls = append(calls, "verify")
+					if rejected {
+						return errors.New("rejected")
+					}
+					return nil
+				},
+				Resolve: func(public string) (string, error) {
+					calls = append(calls, "resolve")
+					return "", nil
+				},
+			}
+
+			_, err := noise.Handshake(c1, server, responder, false, noise.SessionOptions{})
+			c1.Close()
+			errc <- err
+		}()
+
+		peer := noise.Peer{Pattern: noise.PatternIK, Public: server.Public, Lookup: true}
+		noise.Handshake(c2, client, peer, true, noise.SessionOptions{})
+		err := <-errc
+		c2.Close()
+
+		if rejected {
+			assert.ErrorContains(t, err, "rejected")
+			assert.Equal(t, []string{"verify"}, calls)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"verify", "resolve"}, calls)
+	}
+}
+
+func TestHandshake_Resume(t *testing.T) {
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+	psk := noise.GeneratePSK()
+
+	handshake := func(serverPSK, clientPSK string) (error, error) {
+		c1, c2 := net.Pipe()
+		defer c1.Close()
+		defer c2.Close()
+
+		errc := make(chan error, 1)
+		go func() {
+			c, err := noise.Handshake(c1, server, noise.Peer{Pattern: noise.PatternNNpsk0, PSK: serverPSK}, false, noise.SessionOptions{})
+			if err == nil {
+				_, err = c.Write([]byte("trololo"))
+			}
+			c1.Close()
+			errc <- err
+		}()
+
+		c, err := noise.Handshake(c2, client, noise.Peer{Pattern: noise.PatternNNpsk0, PSK: clientPSK}, true, noise.SessionOptions{})
+		if err == nil {
+			p := make([]byte, 7)
+			_, err = io.ReadFull(c, p)
+			assert.Equal(t, "trololo", string(p))
+		}
+		c2.Close()
+
+		return err, <-errc
+	}
+
+	errClient, errServer := handshake(psk, psk)
+	assert.NoError(t, errClient)
+	assert.NoError(t, errServer)
+
+	errClient, errServer = handshake(psk, noise.GeneratePSK())
+	assert.Error(t, errClient)
+	assert.Error(t, errServer)
+
+	_, err := noise.Handshake(nil, client, noise.Peer{Pattern: noise.PatternNNpsk0}, true, noise.SessionOptions{})
+	assert.EqualError(t, err, "handshake: NNpsk0 pattern requires a pre-shared key")
+}
+
+func TestHandshake_Compression(t *testing.T) {
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+
+	for _, requested := range []string{"", "none", "lz4:9+adaptive"} {
+		c1, c2 := net.Pipe()
+
+		connc := make(chan *noise.Conn, 1)
+		go func() {
+			c, err := noise.Handshake(c1, server, noise.Peer{Pattern: noise.PatternIK, Public: client.Public}, true, noise.SessionOptions{})
+			assert.NoError(t, err)
+			connc <- c
+		}()
+
+		c, err := noise.Handshake(c2, client, noise.Peer{Pattern: noise.PatternIK, Public: server.Public}, false, noise.SessionOptions{Compression: requested})
+		assert.NoError(t, err)
+		assert.Equal(t, requested, c.Compression)
+		assert.Equal(t, requested, (<-connc).Compression)
+
+		c1.Close()
+		c2.Close()
+	}
+}
+
+func TestHandshake_Certificate(t *testing.T) {
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+	client.Certificate = "cert-trololo"
+
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	var public, certificate string
+	errc := make(chan error, 1)
+	go func() {
+		responder := noise.Peer{
+			Pattern: noise.PatternIK,
+			Lookup:  true,
+			Resolve: func(string) (string, error) { return "", nil },
+			Certify: func(pub, cert string) error {
+				public, certificate = pub, cert
+				return nil
+			},
+		}
+
+		_, err := noise.Handshake(c1, server, responder, false, noise.SessionOptions{})
+		errc <- err
+	}()
+
+	_, err := noise.Handshake(c2, client, noise.Peer{Pattern: noise.PatternIK, Public: server.Public, Lookup: true}, true, noise.SessionOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, <-errc)
+	assert.Equal(t, client.Public, public)
+	assert.Equal(t, "cert-trololo", certificate)
+
+	//
+
+	c3, c4 := net.Pipe()
+	defer c3.Close()
+	defer c4.Close()
+
+	go func() {
+		responder := noise.Peer{
+			Pattern: noise.PatternIK,
+			Lookup:  true,
+			Resolve: func(string) (string, error) { return "", nil },
+			Certify: func(string, string) error { return errors.New("untrusted certificate") },
+		}
+
+		_, err := noise.Handshake(c3, server, responder, false, noise.SessionOptions{})
+		c3.Close()
+		errc <- err
+	}()
+
+	noise.Handshake(c4, client, noise.Peer{Pattern: noise.PatternIK, Public: server.Public, Lookup: true}, true, noise.SessionOptions{})
+	assert.ErrorContains(t, <-errc, "untrusted certificate")
+}
@@ -1,8 +1,11 @@
 package noise
 
 import (
+	"crypto/rand"
+	"errors"
 	"strings"
 
+	"github.com/mdouchement/seikan/pkg/base58"
 	"github.com/mdouchement/seikan/pkg/noise"
 )
 
@@ -10,6 +13,8 @@ import (
 type Identity struct {
 	Secret string
 	Public string
+	// Certificate is the optional certificate of the public key, sent to the peer during the handshake.
+	Certificate string
 }
 
 // GenerateIdentity returns a new Identity.
@@ -21,6 +26,29 @@ func GenerateIdentity() Identity {
 	}
 }
 
+// GeneratePSK returns a new pre-shared key.
+func GeneratePSK() string {
+	psk := make([]byte, noise.PresharedKeySize)
+	if _, err := rand.Read(psk); err != nil {
+		panic(err)
+	}
+
+	return "psk-" + base58.Encode(psk)
+}
+
+// ValidatePSK checks the given pre-shared key.
+func ValidatePSK(psk string) error {
+	if len(base58.Decode(strings.TrimPrefix(psk, "psk-"))) != noise.PresharedKeySize {
+		return errors.New("invalid pre-shared key")
+	}
+	return nil
+}
+
+// PublicKey returns the given public key with its `pk-' prefix.
+func PublicKey(public string) string {
+	return "pk-" + Identity{Public: public}.public()
+}
+
 func (i Identity) private() string {
 	return strings.ReplaceAll(i.Secret, "sk-", "")
 }
@@ -0,0 +1,138 @@
+package noise
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mdouchement/seikan/pkg/noise"
+)
+
+// A RekeyPolicy defines when the sent data are rekeyed.
+type RekeyPolicy = noise.RekeyPolicy
+
+// An Obfuscation describes how the size of the sent data is hidden.
+type Obfuscation = noise.Obfuscation
+
+// SessionOptions holds the options of the session established by a handshake.
+// They are ignored when the peer does not support the control messages (previous versions).
+type SessionOptions struct {
+	// Rekey is the rekeying policy of the sent data.
+	Rekey RekeyPolicy
+	// Rehandshake is the interval between two full handshakes performed over the session, disabled when zero.
+	Rehandshake time.Duration
+	// Obfuscation is used when enabled by any of the peers.
+	Obfuscation Obfuscation
+	// Compression is the compression requested by the client, the previous zstd stream when empty.
+	// The server leaves it empty and follows the client.
+	Compression string
+}
+
+// Features supported by the peers.
+const (
+	// featureControl is the support of the control messages (rekeys and re-handshakes).
+	featureControl = "control"
+	// featureObfuscation is the support of the obfuscated chunks.
+	featureObfuscation = "obfuscation"
+	// featureCompression is the support of the compression negotiation.
+	featureCompression = "compression"
+)
+
+// A hello is the handshake payload advertising the features supported by its sender.
+// Previous versions send an empty payload and ignore the received one.
+type hello struct {
+	Features []string `cbor:"features,omitempty"`
+	// Obfuscation is true when the sender requests the obfuscated chunks.
+	Obfuscation bool `cbor:"obfuscation,omitempty"`
+	// Certificate is the certificate of the sender static key signed by a certificate authority.
+	Certificate string `cbor:"certificate,omitempty"`
+	// Compression is the compression requested by the sender.
+	Compression string `cbor:"compression,omitempty"`
+}
+
+func newHello(options SessionOptions) hello {
+	return hello{
+		Features:    []string{featureControl, featureObfuscation, featureCompression},
+		Obfuscation: options.Obfuscation.Enabled,
+		Compression: options.Compression,
+	}
+}
+
+func (h hello) marshal() []byte {
+	payload, err := cbor.Marshal(h)
+	if err != nil {
+		panic(err) // Not supposed to happen
+	}
+	return payload
+}
+
+func (h *hello) unmarshal(payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	return cbor.Unmarshal(payload, h)
+}
+
+func (h hello) supports(feature string) bool {
+	return slices.Contains(h.Features, feature)
+}
+
+// stream returns the stream options supported by both peers.
+func (o SessionOptions) stream(peer hello) noise.StreamOptions {
+	if !peer.supports(featureControl) {
+		return noise.StreamOptions{}
+	}
+
+	options := noise.StreamOptions{
+		Rekey:       o.Rekey,
+		Rehandshake: o.Rehandshake,
+	}
+
+	if peer.supports(featureObfuscation) && (o.Obfuscation.Enabled || peer.Obfuscation) {
+		options.Obfuscation = o.Obfuscation
+		options.Obfuscation.Enabled = true
+	}
+
+	return options
+}
+
+// compression returns the compression negotiated with the peer, empty when the peer does not support the negotiation.
+func (o SessionOptions) compression(peer hello) string {
+	if !peer.supports(featureCompression) {
+		return ""
+	}
+
+	if o.Compression != "" {
+		return o.Compression
+	}
+	return peer.Compression
+}
+
+// A Conn is a session established by a handshake.
+type Conn struct {
+	net.Conn
+	// Compression is the compression negotiated by the peers (see snet.ParseCompression).
+	// It is empty when none is requested or the peer does not support the negotiation.
+	Compression string
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// ParsePadding returns the padding of the given name (none, random or bucket).
+func ParsePadding(name string) (noise.Padding, error) {
+	switch name {
+	case "", "none":
+		return noise.PaddingNone, nil
+	case "random":
+		return noise.PaddingRandom, nil
+	case "bucket":
+		return noise.PaddingBucket, nil
+	default:
+		return 0, fmt.Errorf("unsupported padding %s", name)
+	}
+}
@@ -0,0 +1,88 @@
+package noise
+
+import (
+	"fmt"
+
+	"github.com/mdouchement/seikan/pkg/noise"
+)
+
+// A Suite is the cipher suite of a handshake (the Diffie-Hellman function is always Curve25519).
+type Suite struct {
+	Cipher noise.CipherFunction
+	Hash   noise.HashFunction
+}
+
+// DefaultSuite is the suite used when none is configured.
+var DefaultSuite = Suite{
+	Cipher: noise.CipherChaCha20Poly1305,
+	Hash:   noise.HashBlake2b,
+}
+
+var (
+	ciphers = map[string]noise.CipherFunction{
+		"chacha20poly1305": noise.CipherChaCha20Poly1305,
+		"aes256gcm":        noise.CipherAES256GCM,
+	}
+	hashes = map[string]noise.HashFunction{
+		"blake2b": noise.HashBlake2b,
+		"blake2s": noise.HashBlake2s,
+	}
+)
+
+// ParseSuite returns the suite of the given cipher and hash names.
+// An empty name selects the one of the DefaultSuite.
+func ParseSuite(cipher, hash string) (Suite, error) {
+	suite := DefaultSuite
+
+	if cipher != "" {
+		c, ok := ciphers[cipher]
+		if !ok {
+			return suite, fmt.Errorf("unsupported cipher %s", cipher)
+		}
+		suite.Cipher = c
+	}
+
+	if hash != "" {
+		h, ok := hashes[hash]
+		if !ok {
+			return suite, fmt.Errorf("unsupported hash %s", hash)
+		}
+		suite.Hash = h
+	}
+
+	return suite, nil
+}
+
+// Suites returns all the supported suites.
+func Suites() []Suite {
+	suites := []Suite{DefaultSuite}
+	for _, c := range []noise.CipherFunction{noise.CipherChaCha20Poly1305, noise.CipherAES256GCM} {
+		for _, h := range []noise.HashFunction{noise.HashBlake2b, noise.HashBlake2s} {
+			if s := (Suite{Cipher: c, Hash: h}); s != DefaultSuite {
+				suites = append(suites, s)
+			}
+		}
+	}
+	return suites
+}
+
+// String implements fmt.Stringer.
+func (s Suite) String() string {
+	return name(ciphers, s.Cipher) + "+" + name(hashes, s.Hash)
+}
+
+func (s Suite) orDefault() Suite {
+	if s == (Suite{}) {
+		return DefaultSuite
+	}
+	return s
+}
+
+func name[T comparable](names map[string]T, v T) string {
+	for k, n := range names {
+		if n == v {
+			return k
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,50 @@
+package noise_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/noise"
+	pnoise "github.com/mdouchement/seikan/pkg/noise"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSuite(t *testing.T) {
+	suite, err := noise.ParseSuite("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, noise.DefaultSuite, suite)
+	assert.Equal(t, "chacha20poly1305+blake2b", suite.String())
+
+	suite, err = noise.ParseSuite("aes256gcm", "blake2s")
+	assert.NoError(t, err)
+	assert.Equal(t, noise.Suite{Cipher: pnoise.CipherAES256GCM, Hash: pnoise.HashBlake2s}, suite)
+	assert.Equal(t, "aes256gcm+blake2s", suite.String())
+
+	_, err = noise.ParseSuite("des", "")
+	assert.EqualError(t, err, "unsupported cipher des")
+
+	_, err = noise.ParseSuite("", "md5")
+	assert.EqualError(t, err, "unsupported hash md5")
+
+	assert.Len(t, noise.Suites(), 4)
+	assert.Equal(t, noise.DefaultSuite, noise.Suites()[0])
+}
+
+func TestAdvertising(t *testing.T) {
+	aes := noise.Suite{Cipher: pnoise.CipherAES256GCM, Hash: pnoise.HashBlake2b}
+
+	assert.Nil(t, noise.Advertising(noise.Peer{Pattern: noise.PatternIK}))
+	assert.Nil(t, noise.Advertising(noise.Peer{Pattern: noise.PatternIK, Suite: noise.DefaultSuite}))
+	assert.Equal(t, []byte("XX"), noise.Advertising(noise.Peer{Pattern: noise.PatternXX}))
+	assert.Equal(t, []byte("IK+MLKEM768"), noise.Advertising(noise.Peer{Pattern: noise.PatternIK, Hybrid: true}))
+
+	assert.Equal(t, []byte("aes256gcm+blake2b"), noise.Advertising(noise.Peer{Pattern: noise.PatternIK, Suite: aes}))
+	assert.Equal(t, []byte("XX/aes256gcm+blake2b"), noise.Advertising(noise.Peer{Pattern: noise.PatternXX, Suite: aes}))
+
+	assert.Equal(t, []byte("lookup/IK"), noise.Advertising(noise.Peer{Pattern: noise.PatternIK, Lookup: true}))
+	assert.Equal(t, []byte("lookup/IKpsk2"), noise.Advertising(noise.Peer{Pattern: noise.PatternIK, PSK: "psk-1", Lookup: true}))
+	assert.Equal(t, []byte("lookup/IKpsk2"), noise.Advertising(noise.Peer{Pattern: noise.PatternIKpsk2, Lookup: true}))
+	assert.Equal(t, []byte("lookup/IKpsk2+MLKEM768/aes256gcm+blake2b"), noise.Advertising(noise.Peer{Pattern: noise.PatternIKpsk2, Hybrid: true, Suite: aes, Lookup: true}))
+
+	assert.Equal(t, []byte("resume"), noise.Advertising(noise.Peer{Pattern: noise.PatternNNpsk0, PSK: "psk-1"}))
+	assert.Equal(t, []byte("resume/aes256gcm+blake2b"), noise.Advertising(noise.Peer{Pattern: noise.PatternNNpsk0, Suite: aes}))
+}
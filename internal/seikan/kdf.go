@@ -3,8 +3,10 @@ package seikan
 import (
 	"crypto/rand"
 	"crypto/subtle"
+	"encoding/binary"
 	"hash"
 	"io"
+	"time"
 
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/hkdf"
@@ -12,12 +14,18 @@ import (
 
 // KDF global configuration.
 const (
-	KDFLength  = 48
-	saltlength = 16
+	KDFLength   = 48
+	saltlength  = 16
+	noncelength = 8
 )
 
 // KDFGenerate generates a safe derivation hash of the given s.
 func KDFGenerate(s string) ([]byte, error) {
+	return KDFGenerateInfo(s, nil)
+}
+
+// KDFGenerateInfo generates a safe derivation hash of the given s bound to the given info.
+func KDFGenerateInfo(s string, info []byte) ([]byte, error) {
 	payload := make([]byte, KDFLength)
 	if _, err := io.ReadFull(rand.Reader, payload[:saltlength]); err != nil {
 		return nil, err
@@ -31,13 +39,66 @@ func KDFGenerate(s string) ([]byte, error) {
 		return h
 	}
 
-	kdf := hkdf.New(nash, []byte(s), nil, nil)
+	kdf := hkdf.New(nash, []byte(s), nil, info)
 	_, err := io.ReadFull(kdf, payload[saltlength:])
 	return payload, err
 }
 
+// KDFGenerateTime generates a safe derivation hash of the given s bound to the given info and to the given time.
+// The salt holds a random nonce followed by the time masked with a hash of s and the nonce.
+// The payload stays comparable by KDFCompareInfo.
+func KDFGenerateTime(s string, info []byte, t time.Time) ([]byte, error) {
+	var salt [saltlength]byte
+	if _, err := io.ReadFull(rand.Reader, salt[:noncelength]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(salt[noncelength:], uint64(t.Unix()))
+	mask(salt[:], s)
+
+	nash := func() hash.Hash {
+		h, err := blake2b.New256(salt[:])
+		if err != nil {
+			panic(err)
+		}
+		return h
+	}
+
+	payload := make([]byte, KDFLength)
+	copy(payload, salt[:])
+
+	kdf := hkdf.New(nash, []byte(s), nil, info)
+	_, err := io.ReadFull(kdf, payload[saltlength:])
+	return payload, err
+}
+
+// KDFTime returns the time held by the salt of the payload for the given s.
+// The result is meaningless if the payload has not been generated by KDFGenerateTime for s.
+func KDFTime(payload []byte, s string) time.Time {
+	var salt [saltlength]byte
+	copy(salt[:], payload)
+	mask(salt[:], s)
+
+	return time.Unix(int64(binary.BigEndian.Uint64(salt[noncelength:])), 0)
+}
+
+// KDFSalt returns the salt of the payload.
+func KDFSalt(payload []byte) [saltlength]byte {
+	return [saltlength]byte(payload[:saltlength])
+}
+
+// mask applies the mask of the time held by the salt.
+func mask(salt []byte, s string) {
+	m := blake2b.Sum256(append([]byte(s), salt[:noncelength]...))
+	subtle.XORBytes(salt[noncelength:], salt[noncelength:], m[:saltlength-noncelength])
+}
+
 // KDFCompare returns true if the hased payload match the given s.
 func KDFCompare(payload []byte, s string) bool {
+	return KDFCompareInfo(payload, s, nil)
+}
+
+// KDFCompareInfo returns true if the hased payload match the given s bound to the given info.
+func KDFCompareInfo(payload []byte, s string, info []byte) bool {
 	nash := func() hash.Hash {
 		h, err := blake2b.New256(payload[:saltlength])
 		if err != nil {
@@ -45,7 +106,7 @@ func KDFCompare(payload []byte, s string) bool {
 		}
 		return h
 	}
-	kdf := hkdf.New(nash, []byte(s), nil, nil)
+	kdf := hkdf.New(nash, []byte(s), nil, info)
 
 	hash := make([]byte, KDFLength-saltlength)
 	_, err := io.ReadFull(kdf, hash)
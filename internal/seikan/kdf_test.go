@@ -3,6 +3,7 @@ package seikan_test
 import (
 	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/mdouchement/basex"
 	"github.com/mdouchement/seikan/internal/seikan"
@@ -27,3 +28,32 @@ func TestKDF(t *testing.T) {
 		assert.True(t, seikan.KDFCompare(payload, id), "end2end")
 	}
 }
+
+func TestKDFInfo(t *testing.T) {
+	id := basex.GenerateID()
+
+	payload, err := seikan.KDFGenerateInfo(id, []byte("XX"))
+	assert.NoError(t, err)
+	assert.True(t, seikan.KDFCompareInfo(payload, id, []byte("XX")))
+	assert.False(t, seikan.KDFCompare(payload, id))
+
+	payload, err = seikan.KDFGenerate(id)
+	assert.NoError(t, err)
+	assert.False(t, seikan.KDFCompareInfo(payload, id, []byte("XX")))
+}
+
+func TestKDFTime(t *testing.T) {
+	id := basex.GenerateID()
+	now := time.Unix(time.Now().Unix(), 0)
+
+	payload, err := seikan.KDFGenerateTime(id, []byte("XX"), now)
+	assert.NoError(t, err)
+	assert.True(t, seikan.KDFCompareInfo(payload, id, []byte("XX")))
+	assert.Equal(t, now, seikan.KDFTime(payload, id))
+	assert.NotEqual(t, now, seikan.KDFTime(payload, basex.GenerateID()))
+
+	// Tampered time
+	payload[15] ^= 0x01
+	assert.NotEqual(t, now, seikan.KDFTime(payload, id))
+	assert.False(t, seikan.KDFCompareInfo(payload, id, []byte("XX")))
+}
@@ -0,0 +1,73 @@
+package seikan
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// A ReplayCache remembers the salts of the recently received identifiers in order to reject replayed ones.
+// It is bounded: when it is full, the salt closest to its expiration is evicted so new salts are always accepted.
+type ReplayCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[[saltlength]byte]time.Time
+	queue   expirations
+}
+
+// NewReplayCache returns a new ReplayCache holding up to size salts.
+func NewReplayCache(size int) *ReplayCache {
+	return &ReplayCache{
+		size:    size,
+		entries: make(map[[saltlength]byte]time.Time),
+	}
+}
+
+// Add remembers the given salt until its expiration.
+// It returns false if the salt has already been added.
+func (c *ReplayCache) Add(salt [saltlength]byte, expiration time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for len(c.queue) > 0 && !now.Before(c.queue[0].expiration) {
+		c.evict()
+	}
+
+	if _, ok := c.entries[salt]; ok {
+		return false
+	}
+
+	if len(c.entries) >= c.size {
+		c.evict()
+	}
+
+	c.entries[salt] = expiration
+	heap.Push(&c.queue, expiry{salt: salt, expiration: expiration})
+	return true
+}
+
+// evict removes the salt closest to its expiration.
+func (c *ReplayCache) evict() {
+	e := heap.Pop(&c.queue).(expiry)
+	delete(c.entries, e.salt)
+}
+
+type expiry struct {
+	salt       [saltlength]byte
+	expiration time.Time
+}
+
+// expirations is a min-heap of salts ordered by expiration.
+type expirations []expiry
+
+func (h expirations) Len() int           { return len(h) }
+func (h expirations) Less(i, j int) bool { return h[i].expiration.Before(h[j].expiration) }
+func (h expirations) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expirations) Push(x any)        { *h = append(*h, x.(expiry)) }
+func (h *expirations) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,27 @@
+package seikan_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/seikan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayCache(t *testing.T) {
+	cache := seikan.NewReplayCache(2)
+	expiration := time.Now().Add(time.Minute)
+
+	assert.True(t, cache.Add([16]byte{1}, expiration))
+	assert.False(t, cache.Add([16]byte{1}, expiration), "replayed")
+	assert.True(t, cache.Add([16]byte{2}, expiration.Add(time.Minute)))
+	assert.True(t, cache.Add([16]byte{3}, expiration), "full, the salt closest to its expiration is evicted")
+	assert.True(t, cache.Add([16]byte{1}, expiration), "evicted")
+	assert.False(t, cache.Add([16]byte{2}, expiration), "replayed")
+
+	cache = seikan.NewReplayCache(2)
+	assert.True(t, cache.Add([16]byte{1}, time.Now()))
+	assert.True(t, cache.Add([16]byte{2}, expiration))
+	assert.True(t, cache.Add([16]byte{3}, expiration), "expired salt purged")
+	assert.False(t, cache.Add([16]byte{2}, expiration), "replayed")
+}
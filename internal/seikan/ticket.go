@@ -0,0 +1,166 @@
+package seikan
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Ticket constants.
+const (
+	// MaxTicketLength is the maximum length of a sealed ticket.
+	MaxTicketLength = 4096
+	expirylength    = 8
+)
+
+// A TicketSealer encrypts the resumption tickets with a key rotated every lifetime.
+// A ticket expires after the lifetime and is opened only once.
+// The previous key is kept for one more lifetime so the tickets sealed just before a rotation stay valid.
+type TicketSealer struct {
+	mu       sync.Mutex
+	lifetime time.Duration
+	current  ticketKey
+	previous ticketKey
+	replays  *ReplayCache
+}
+
+// A ticketKey is a ticket key used to seal new tickets until rotation.
+type ticketKey struct {
+	aead     cipher.AEAD
+	rotation time.Time
+}
+
+// NewTicketSealer returns a new TicketSealer sealing tickets valid for the given lifetime,
+// up to size tickets are remembered to reject the replayed ones.
+func NewTicketSealer(lifetime time.Duration, size int) *TicketSealer {
+	return &TicketSealer{
+		lifetime: lifetime,
+		replays:  NewReplayCache(size),
+	}
+}
+
+// Seal returns the ticket of the given plaintext and its expiration.
+// The ticket is the random nonce followed by the expiration (authenticated) and the ciphertext.
+func (s *TicketSealer) Seal(plaintext []byte, now time.Time) ([]byte, time.Time, error) {
+	s.mu.Lock()
+	aead := s.rotate(now).aead
+	s.mu.Unlock()
+
+	expiration := now.Add(s.lifetime)
+
+	ticket := make([]byte, chacha20poly1305.NonceSizeX+expirylength, chacha20poly1305.NonceSizeX+expirylength+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, ticket[:chacha20poly1305.NonceSizeX]); err != nil {
+		return nil, time.Time{}, err
+	}
+	binary.BigEndian.PutUint64(ticket[chacha20poly1305.NonceSizeX:], uint64(expiration.Unix()))
+
+	nonce, ad := ticket[:chacha20poly1305.NonceSizeX], ticket[chacha20poly1305.NonceSizeX:]
+	ticket = aead.Seal(ticket, nonce, plaintext, ad)
+	if len(ticket) > MaxTicketLength {
+		return nil, time.Time{}, errors.New("ticket too large")
+	}
+
+	return ticket, time.Unix(int64(binary.BigEndian.Uint64(ad)), 0), nil
+}
+
+// Open returns the plaintext of the given ticket.
+// It fails if the ticket is expired, has been sealed by a retired key or has already been opened.
+func (s *TicketSealer) Open(ticket []byte, now time.Time) ([]byte, error) {
+	if len(ticket) < chacha20poly1305.NonceSizeX+expirylength+chacha20poly1305.Overhead {
+		return nil, errors.New("invalid ticket")
+	}
+	nonce := ticket[:chacha20poly1305.NonceSizeX]
+	ad := ticket[chacha20poly1305.NonceSizeX : chacha20poly1305.NonceSizeX+expirylength]
+	ciphertext := ticket[chacha20poly1305.NonceSizeX+expirylength:]
+
+	s.mu.Lock()
+	s.rotate(now)
+	keys := []ticketKey{s.current, s.previous}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		if key.aead == nil {
+			continue
+		}
+
+		plaintext, err := key.aead.Open(nil, nonce, ciphertext, ad)
+		if err != nil {
+			continue
+		}
+
+		expiration := time.Unix(int64(binary.BigEndian.Uint64(ad)), 0)
+		if now.After(expiration) {
+			return nil, fmt.Errorf("ticket expired since %s", expiration)
+		}
+
+		if !s.replays.Add([saltlength]byte(nonce[:saltlength]), expiration) {
+			return nil, errors.New("ticket replayed")
+		}
+		return plaintext, nil
+	}
+
+	return nil, errors.New("invalid ticket")
+}
+
+// rotate returns the current key, a new one is generated once rotated.
+func (s *TicketSealer) rotate(now time.Time) ticketKey {
+	if s.current.aead != nil && now.Before(s.current.rotation) {
+		return s.current
+	}
+
+	s.previous = ticketKey{}
+	if s.current.aead != nil && now.Before(s.current.rotation.Add(s.lifetime)) {
+		s.previous = s.current
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		panic(err)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		panic(err) // Not supposed to happen
+	}
+
+	s.current = ticketKey{aead: aead, rotation: now.Add(s.lifetime)}
+	return s.current
+}
+
+// WriteTicket writes the given ticket prefixed by its length.
+func WriteTicket(w io.Writer, ticket []byte) error {
+	if len(ticket) > MaxTicketLength {
+		return errors.New("ticket too large")
+	}
+
+	p := make([]byte, 2, 2+len(ticket))
+	binary.BigEndian.PutUint16(p, uint16(len(ticket)))
+	_, err := w.Write(append(p, ticket...))
+	return err
+}
+
+// ReadTicket reads a ticket written by WriteTicket.
+func ReadTicket(r io.Reader) ([]byte, error) {
+	p := make([]byte, 2)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint16(p)
+	if n > MaxTicketLength {
+		return nil, errors.New("ticket too large")
+	}
+
+	ticket := make([]byte, n)
+	if _, err := io.ReadFull(r, ticket); err != nil {
+		return nil, err
+	}
+	return ticket, nil
+}
@@ -0,0 +1,88 @@
+package seikan_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/seikan"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTicketSealer(t *testing.T) {
+	sealer := seikan.NewTicketSealer(time.Hour, 16)
+	now := time.Now()
+
+	ticket, expiration, err := sealer.Seal([]byte("trololo"), now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour).Unix(), expiration.Unix())
+	assert.NotContains(t, string(ticket), "trololo")
+
+	plaintext, err := sealer.Open(ticket, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "trololo", string(plaintext))
+
+	_, err = sealer.Open(ticket, now)
+	assert.EqualError(t, err, "ticket replayed")
+
+	//
+
+	ticket, _, err = sealer.Seal([]byte("trololo"), now)
+	assert.NoError(t, err)
+
+	_, err = sealer.Open(ticket, now.Add(time.Hour+time.Minute))
+	assert.ErrorContains(t, err, "ticket expired since")
+
+	ticket[len(ticket)-1] ^= 0xFF
+	_, err = sealer.Open(ticket, now)
+	assert.EqualError(t, err, "invalid ticket")
+
+	_, err = sealer.Open([]byte("trololo"), now)
+	assert.EqualError(t, err, "invalid ticket")
+
+	_, err = seikan.NewTicketSealer(time.Hour, 16).Open(ticket, now)
+	assert.EqualError(t, err, "invalid ticket")
+}
+
+func TestTicketSealer_Rotation(t *testing.T) {
+	sealer := seikan.NewTicketSealer(time.Hour, 16)
+	now := time.Now()
+
+	retired, _, err := sealer.Seal([]byte("retired"), now)
+	assert.NoError(t, err)
+	before, _, err := sealer.Seal([]byte("before"), now.Add(59*time.Minute))
+	assert.NoError(t, err)
+
+	// Rotated, the previous key still opens its tickets until they expire.
+	after, _, err := sealer.Seal([]byte("after"), now.Add(61*time.Minute))
+	assert.NoError(t, err)
+
+	plaintext, err := sealer.Open(before, now.Add(61*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "before", string(plaintext))
+
+	plaintext, err = sealer.Open(after, now.Add(61*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "after", string(plaintext))
+
+	// Rotated twice, the first key is retired.
+	_, _, err = sealer.Seal(nil, now.Add(2*time.Hour+time.Minute))
+	assert.NoError(t, err)
+
+	_, err = sealer.Open(retired, now.Add(2*time.Hour+time.Minute))
+	assert.EqualError(t, err, "invalid ticket")
+}
+
+func TestTicketFraming(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, seikan.WriteTicket(&buf, []byte("trololo")))
+
+	ticket, err := seikan.ReadTicket(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "trololo", string(ticket))
+
+	assert.EqualError(t, seikan.WriteTicket(&buf, make([]byte, seikan.MaxTicketLength+1)), "ticket too large")
+
+	_, err = seikan.ReadTicket(bytes.NewReader([]byte{0xFF, 0xFF}))
+	assert.EqualError(t, err, "ticket too large")
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/mdouchement/basex"
+	"github.com/mdouchement/seikan/internal/ca"
+	"github.com/mdouchement/seikan/internal/control"
+	"github.com/mdouchement/seikan/internal/seikan"
+)
+
+// Lookup for test purpose: returns the identifier of the client advertised by derived,
+// the public key is used to resolve a client advertised with the key lookup.
+func Lookup(s Server, derived []byte, public string) (string, error) {
+	srv := s.(*server)
+
+	advertised, err := srv.recipient(derived)
+	if err != nil || !advertised.peer.Lookup {
+		return advertised.identifier, err
+	}
+
+	identifier, _, err := srv.resolve(advertised.peer, public)
+	return identifier, err
+}
+
+// ServerKey for test purpose: returns the server public key expected by the client advertised by derived.
+func ServerKey(s Server, derived []byte) (string, error) {
+	advert, err := s.(*server).recipient(derived)
+	return advert.keypair.identity.Public, err
+}
+
+// Adverts for test purpose: returns the number of advertisings tried by the legacy lookup for all the clients.
+func Adverts(s Server) (n int) {
+	for _, peers := range s.(*server).adverts {
+		n += len(peers)
+	}
+	return n
+}
+
+// ProxyProtocol for test purpose: returns the PROXY protocol version sent to the given destination of the client tunnels.
+func ProxyProtocol(s Server, address string) int {
+	return s.(*server).proxyProtocol(address)
+}
+
+// Compression for test purpose: returns the compression used by the server for the one requested by a client.
+func Compression(s Server, requested string) (string, error) {
+	compression, err := s.(*server).compression(requested)
+	return compression.String(), err
+}
+
+type nopDrainer struct {
+	io.Closer
+}
+
+func (*nopDrainer) Drain() {}
+
+// AddSession for test purpose: registers a live session of the given client running over c.
+func AddSession(s Server, identifier string, c io.Closer) {
+	s.(*server).sessions.add(identifier, &nopDrainer{c}, c)
+}
+
+// Track for test purpose: registers a running handler of the connection c until the returned function is called.
+func Track(s Server, c io.Closer) func() {
+	return s.(*server).sessions.track(c)
+}
+
+// WaitSessions for test purpose: waits for the tracked handlers, the remaining connections are closed after the timeout.
+func WaitSessions(s Server, timeout time.Duration) bool {
+	return s.(*server).sessions.wait(timeout)
+}
+
+// Teardown for test purpose: reloads the revocation list then closes the sessions of the clients that are no longer valid.
+func Teardown(s Server) (int, error) {
+	srv := s.(*server)
+
+	if _, err := srv.revoked.reload(); err != nil {
+		return 0, err
+	}
+	return srv.teardown(time.Now()), nil
+}
+
+// Certify for test purpose: returns the certificate presented by a client for its public key.
+func Certify(s Server, public, certificate string) (*ca.Certificate, error) {
+	return s.(*server).certify(public, certificate, time.Now())
+}
+
+// Issue for test purpose: returns a new resumption ticket of the given client.
+func Issue(s Server, identifier, public string) (*control.Ticket, error) {
+	return s.(*server).issue(basex.GenerateID(), identifier, public, nil)
+}
+
+// Resume for test purpose: returns the identifier and the pre-shared key of the session resumed with the given ticket.
+func Resume(s Server, sealed []byte) (string, string, error) {
+	var buf bytes.Buffer
+	if err := seikan.WriteTicket(&buf, sealed); err != nil {
+		return "", "", err
+	}
+
+	t, err := s.(*server).resume(&buf, time.Now())
+	return t.Identifier, t.PSK, err
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/mdouchement/seikan/internal/config"
 	"github.com/mdouchement/seikan/internal/seikan"
 	"github.com/mdouchement/seikan/internal/smux"
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/proxyproto"
 )
 
 // Outbound handles server to client tunneling.
@@ -16,18 +18,28 @@ type Outbound struct {
 	log       logger.Logger
 	cfg       config.Server
 	listeners map[string]*smux.DropListener
+	sessions  *sessions
 }
 
 // NewOutbound returns a new Outbound.
 func NewOutbound(cfg config.Server, log logger.Logger) (out *Outbound, err error) {
 	out = &Outbound{
+		sessions:  newSessions(),
 		cfg:       cfg,
 		log:       log.WithPrefix("[outgoing]"),
 		listeners: make(map[string]*smux.DropListener, len(cfg.Outbounds)),
 	}
 
 	for _, o := range cfg.Outbounds {
-		l, err := net.Listen("tcp", o.Source)
+		if o.ProxyProtocol < 0 || o.ProxyProtocol > proxyproto.V2 {
+			return nil, fmt.Errorf("outbound %s: unsupported proxy_protocol version %d", o.Destination, o.ProxyProtocol)
+		}
+
+		if _, err := snet.ParseCompression(o.Compression); err != nil {
+			return nil, fmt.Errorf("outbound %s: compression: %w", o.Destination, err)
+		}
+
+		l, err := snet.ListenEndpoint(o.Source)
 		if err != nil {
 			return nil, err
 		}
@@ -39,16 +51,22 @@ func NewOutbound(cfg config.Server, log logger.Logger) (out *Outbound, err error
 	return out, err
 }
 
-// Establish establishes the tunnel on the given remote connection rc for the given outbound config.
-func (out *Outbound) Establish(log logger.Logger, outbound config.Outbound, rc net.Conn) error {
-	var found bool
+// Lookup returns the configuration of the outbound matching the given identifier and destination.
+func (out *Outbound) Lookup(identifier, destination string) (config.Outbound, bool) {
 	for _, o := range out.cfg.Outbounds {
-		if o.Identifier == outbound.Identifier && o.Destination == outbound.Destination {
-			found = true
+		if o.Identifier == identifier && o.Destination == destination {
+			return o, true
 		}
 	}
 
-	if !found {
+	return config.Outbound{}, false
+}
+
+// Establish establishes the tunnel on the given remote connection rc, accepted by the given listener, for the given outbound config.
+// The PROXY protocol version of the given outbound is the one negotiated with the client.
+// The underlying connection raw is closed when the tunnel is drained.
+func (out *Outbound) Establish(log logger.Logger, listener string, outbound config.Outbound, rc, raw net.Conn) error {
+	if _, found := out.Lookup(outbound.Identifier, outbound.Destination); !found {
 		return errors.New("outbound configuration not found")
 	}
 
@@ -59,23 +77,33 @@ func (out *Outbound) Establish(log logger.Logger, outbound config.Outbound, rc n
 
 	tun := smux.Tunnel{
 		Source:      l.Address(),
-		Remote:      out.cfg.Address,
+		Remote:      listener,
 		Destination: outbound.Destination,
+		// Streams start with metadata, the client sends the PROXY protocol header to the destination.
+		ProxyProtocol: outbound.ProxyProtocol,
 	}
 
-	return out.establish(log, tun, l, rc)
+	return out.establish(log, outbound.Identifier, tun, l, rc, raw)
 }
 
-func (out *Outbound) establish(log logger.Logger, tun smux.Tunnel, l *smux.DropListener, rc net.Conn) error {
-	smux, err := smux.NewClient(log, tun, l, rc)
+func (out *Outbound) establish(log logger.Logger, identifier string, tun smux.Tunnel, l *smux.DropListener, rc, raw net.Conn) error {
+	smux, err := smux.NewClient(log, tun, l, snet.NopConnCloser(rc)) // rc is closed by the server
 	if err != nil {
 		return fmt.Errorf("failed to initialize smux session: %w", err)
 	}
 	defer smux.Close()
+	defer out.sessions.add(identifier, smux, raw)()
 
 	return smux.Establish()
 }
 
+// Close closes the listeners of all the outbounds.
+func (out *Outbound) Close() {
+	for _, l := range out.listeners {
+		l.Close()
+	}
+}
+
 func (out *Outbound) key(o config.Outbound) string {
 	return seikan.CraftKey(o.Identifier, o.Destination)
 }
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/snet"
+)
+
+const (
+	// envReadyFD is the file descriptor used by a new server process to tell its parent it is ready.
+	envReadyFD = "SEIKAN_READY_FD"
+	// envNotifySocket is the systemd notification socket.
+	envNotifySocket = "NOTIFY_SOCKET"
+)
+
+// restartTimeout is the maximum duration for a new server process to be ready.
+const restartTimeout = 30 * time.Second
+
+// Restart starts a new server process with the same arguments, inheriting all the stream listeners.
+// Once the new process is ready, the listeners are closed and the live sessions are drained,
+// Listen returns when all of them are done. The current process keeps serving if the new one fails.
+//
+// Listeners of UDP based transports (quic, rudp) cannot be handed over, restarting such a server is not supported.
+func (s *server) Restart() error {
+	if s.sessions.isDraining() {
+		return errors.New("already restarted")
+	}
+
+	for _, address := range s.cfg.Address {
+		if !snet.Inheritable(address) {
+			return fmt.Errorf("listener %s cannot be handed over", listenerName(address))
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	files, err := snet.ListenerFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(os.Environ(),
+		snet.EnvListenFDs+"="+strconv.Itoa(len(files)),
+		envReadyFD+"="+strconv.Itoa(3+len(files)),
+	)
+
+	s.log.Infof("Restarting with %d inherited listeners", len(files))
+	err = cmd.Start()
+	w.Close() // Reading returns EOF if the new process exits before being ready.
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	if err = awaitReady(r); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("new process %d is not ready: %w", cmd.Process.Pid, err)
+	}
+	s.log.Infof("New process %d is ready", cmd.Process.Pid)
+	cmd.Process.Release()
+	snet.HandOverListeners()
+
+	//
+
+	s.sessions.drain()
+	s.outbound.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	return nil
+}
+
+// awaitReady waits for the readiness notification of a new process.
+func awaitReady(r *os.File) error {
+	r.SetReadDeadline(time.Now().Add(restartTimeout))
+
+	_, err := r.Read(make([]byte, 1))
+	if errors.Is(err, io.EOF) {
+		return errors.New("process exited")
+	}
+	return err
+}
+
+// ready tells the parent process and systemd that the server is ready to accept connections.
+func ready() error {
+	if v := os.Getenv(envReadyFD); v != "" {
+		os.Unsetenv(envReadyFD)
+
+		fd, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", envReadyFD, err)
+		}
+
+		f := os.NewFile(uintptr(fd), "ready")
+		_, err = f.Write([]byte{1})
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return notify(fmt.Sprintf("MAINPID=%d\nREADY=1", os.Getpid()))
+}
+
+// notify sends the given state to systemd when running as a notify service.
+// A new process started by Restart needs NotifyAccess=all to update the main PID.
+func notify(state string) error {
+	socket := os.Getenv(envNotifySocket)
+	if socket == "" {
+		return nil
+	}
+
+	c, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = c.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/noise"
+)
+
+// revocationsInterval is the interval between two checks of the revocation list and the client validity.
+const revocationsInterval = 10 * time.Second
+
+// revocations holds the revoked clients read from a file, one client identifier or public key per line.
+// The file is read again when it is modified.
+type revocations struct {
+	filename string
+
+	mu      sync.RWMutex
+	modtime time.Time
+	size    int64
+	entries map[string]bool
+}
+
+func newRevocations(filename string) (*revocations, error) {
+	r := &revocations{
+		filename: filename,
+	}
+
+	_, err := r.reload()
+	return r, err
+}
+
+// reload reads the file again when it has been modified since the last read.
+func (r *revocations) reload() (bool, error) {
+	if r.filename == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(r.filename)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := info.ModTime().Equal(r.modtime) && info.Size() == r.size
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	f, err := os.Open(r.filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	entries, err := parseRevocations(f)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.modtime = info.ModTime()
+	r.size = info.Size()
+	r.entries = entries
+	return true, nil
+}
+
+// revoked returns true if the client of the given identifier and public key is revoked.
+func (r *revocations) revoked(identifier, public string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.entries[identifier] || r.entries[noise.PublicKey(public)]
+}
+
+// parseRevocations parses a revocation list, empty lines and lines starting with `#' are ignored.
+func parseRevocations(r io.Reader) (map[string]bool, error) {
+	entries := map[string]bool{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "pk-") {
+			line = noise.PublicKey(line)
+		}
+		entries[line] = true
+	}
+
+	return entries, scanner.Err()
+}
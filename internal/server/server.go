@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"maps"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/mdouchement/basex"
 	"github.com/mdouchement/logger"
+	"github.com/mdouchement/seikan/internal/ca"
 	"github.com/mdouchement/seikan/internal/config"
 	"github.com/mdouchement/seikan/internal/control"
 	"github.com/mdouchement/seikan/internal/filter"
@@ -18,12 +25,38 @@ import (
 	"github.com/mdouchement/seikan/internal/seikan"
 	"github.com/mdouchement/seikan/internal/smux"
 	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/proxyproto"
+)
+
+// Replay protection defaults.
+const (
+	defaultClockSkew = 2 * time.Minute
+	replayCacheSize  = 1 << 16
+	// legacyReplayTTL is the time an identifier accepted without a valid time (legacy) stays in the replay cache.
+	legacyReplayTTL = time.Hour
+)
+
+// defaultCompressionLevels are the maximum levels of the compressions requested by the clients.
+var defaultCompressionLevels = map[string]int{
+	snet.CompressionZstd: 3,
+	snet.CompressionLZ4:  1,
+	snet.CompressionS2:   2,
+}
+
+// Draining timeouts.
+const (
+	// probeDrainTimeout is the maximum duration a failed connection is drained.
+	probeDrainTimeout = 2 * time.Minute
+	// defaultDrainTimeout is the maximum duration the live sessions are drained after a restart.
+	defaultDrainTimeout = 10 * time.Minute
 )
 
 type (
 	// A Server listens on a port for running Seikan's tunnels.
 	Server interface {
 		Listen() error
+		// Restart hands the listeners over to a new server process then drains the live sessions.
+		Restart() error
 	}
 
 	server struct {
@@ -31,166 +64,530 @@ type (
 		log      logger.Logger
 		approver *filter.Approver
 		outbound *Outbound
+		trusted  []*net.IPNet
+		proxies  []proxy                 // Destinations of the client tunnels receiving a PROXY protocol header
+		sources  map[string][]*net.IPNet // Trusted PROXY protocol sources by client identifier
+		levels   map[string]int          // Maximum compression levels by algorithm
+		suites   []noise.Suite
+		probes   []noise.Suite           // The accepted suites then the default suite when it is not accepted, tried by the lookups
+		adverts  map[string][]noise.Peer // Advertisings tried by the legacy lookup, by client identifier
+		keypairs []keypair               // The current keypair then the previous ones
+		keys     map[string]string       // Client identifiers by public key
+		revoked  *revocations
+		replays  *seikan.ReplayCache
+		tickets  *seikan.TicketSealer // Nil when the session resumption is disabled
+		sessions *sessions
+		// certified holds the last certificate presented by the clients identified by the CA (ca.Certificate by identifier).
+		certified sync.Map
+
+		mu        sync.Mutex
+		listeners []net.Listener
+	}
+
+	// A stream runs a session over c, raw is the underlying connection of the client.
+	stream func(c, raw net.Conn) error
+
+	// A proxy is an allowed destination receiving a PROXY protocol header, network is nil for a strict endpoint.
+	proxy struct {
+		endpoint string
+		network  *net.IPNet
+		version  int
+	}
+
+	// A keypair is a keypair of the server, a previous one is accepted until notAfter.
+	keypair struct {
+		identity noise.Identity
+		notAfter time.Time
 	}
 
-	stream func(c net.Conn) error
+	// An advert is the client advertised by a derived identifier.
+	advert struct {
+		peer noise.Peer
+		// identifier is empty until the client is resolved with the key lookup.
+		identifier string
+		// keypair is the server keypair expected by the client.
+		keypair keypair
+	}
 )
 
 // New returns a new server.
 func New(cfg config.Server, l logger.Logger) (Server, error) {
+	if cfg.ReplayProtection.ClockSkew <= 0 {
+		cfg.ReplayProtection.ClockSkew = defaultClockSkew
+	}
+	if cfg.Resumption.Lifetime <= 0 {
+		cfg.Resumption.Lifetime = defaultTicketLifetime
+	}
+	if cfg.ReplayProtection.Legacy == nil {
+		legacy := true
+		cfg.ReplayProtection.Legacy = &legacy
+	}
+
 	s := &server{
-		cfg: cfg,
-		log: l,
+		cfg:      cfg,
+		log:      l,
+		keys:     make(map[string]string, len(cfg.Clients)),
+		sources:  make(map[string][]*net.IPNet),
+		adverts:  make(map[string][]noise.Peer, len(cfg.Clients)),
+		replays:  seikan.NewReplayCache(replayCacheSize),
+		sessions: newSessions(),
+	}
+
+	if cfg.Resumption.Enabled {
+		s.tickets = seikan.NewTicketSealer(cfg.Resumption.Lifetime, replayCacheSize)
+	}
+
+	s.keypairs = append(s.keypairs, keypair{identity: identity(cfg.Secret, cfg.Public)})
+	for i, previous := range cfg.PreviousKeys {
+		if previous.Secret == "" || previous.Public == "" || previous.NotAfter.IsZero() {
+			return s, fmt.Errorf("previous_keys[%d]: secret, public and not_after are required", i)
+		}
+
+		s.keypairs = append(s.keypairs, keypair{
+			identity: identity(previous.Secret, previous.Public),
+			notAfter: previous.NotAfter,
+		})
+	}
+
+	if *cfg.ReplayProtection.Legacy {
+		l.Warn("The identifiers of the clients older than the replay protection are accepted, set replay_protection.legacy to false once all the clients are updated")
+	}
+
+	if len(cfg.PreviousKeys) > 0 && !cfg.KeyLookupOnly {
+		// The legacy lookup and the XX pattern do not tell which server key the client expects.
+		l.Warn("The previous_keys are only accepted from the clients using the key lookup, the other clients must be updated with the current public key")
+	}
+
+	if cfg.CA != "" {
+		if err := ca.ValidateAuthority(cfg.CA); err != nil {
+			return s, fmt.Errorf("ca: %w", err)
+		}
+	}
+
+	var err error
+	s.revoked, err = newRevocations(cfg.Revocations)
+	if err != nil {
+		return s, fmt.Errorf("revocations: %w", err)
 	}
 
 	var stricts, cidrs []string
 	for _, allowed := range cfg.AllowList {
+		if allowed.ProxyProtocol < 0 || allowed.ProxyProtocol > proxyproto.V2 {
+			return s, fmt.Errorf("allow_list %s: unsupported proxy_protocol version %d", allowed.Endpoint, allowed.ProxyProtocol)
+		}
+
 		if allowed.Type == "cidr" {
 			cidrs = append(cidrs, allowed.Endpoint)
+
+			if allowed.ProxyProtocol > 0 {
+				_, n, err := net.ParseCIDR(allowed.Endpoint)
+				if err != nil {
+					return s, fmt.Errorf("allow_list: %w", err)
+				}
+				s.proxies = append(s.proxies, proxy{network: n, version: allowed.ProxyProtocol})
+			}
 			continue
 		}
 
 		stricts = append(stricts, allowed.Endpoint)
+		if allowed.ProxyProtocol > 0 {
+			s.proxies = append(s.proxies, proxy{endpoint: allowed.Endpoint, version: allowed.ProxyProtocol})
+		}
 	}
 
-	var err error
 	s.approver, err = filter.NewAppover(stricts, cidrs)
 	if err != nil {
 		return s, err
 	}
 
+	for identifier, client := range cfg.Clients {
+		public := noise.PublicKey(client.Public)
+		if other, ok := s.keys[public]; ok {
+			return s, fmt.Errorf("clients %s and %s share the same public key", other, identifier)
+		}
+		s.keys[public] = identifier
+
+		for _, cidr := range client.ProxySources {
+			_, n, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return s, fmt.Errorf("client %s: proxy_sources: %w", identifier, err)
+			}
+			s.sources[identifier] = append(s.sources[identifier], n)
+		}
+
+		if client.PSK == "" {
+			continue
+		}
+
+		if err := noise.ValidatePSK(client.PSK); err != nil {
+			return s, fmt.Errorf("client %s: %w", identifier, err)
+		}
+	}
+
+	s.levels = maps.Clone(defaultCompressionLevels)
+	for algorithm, level := range cfg.CompressionLevels {
+		if _, ok := s.levels[algorithm]; !ok {
+			return s, fmt.Errorf("compression_levels: unsupported compression %s", algorithm)
+		}
+		if _, err := snet.ParseCompression(fmt.Sprintf("%s:%d", algorithm, level)); err != nil {
+			return s, fmt.Errorf("compression_levels: %w", err)
+		}
+		s.levels[algorithm] = level
+	}
+
+	if _, err := noise.ParsePadding(cfg.Obfuscation.Padding); err != nil {
+		return s, fmt.Errorf("obfuscation: %w", err)
+	}
+
+	for _, suite := range cfg.CipherSuites {
+		ns, err := noise.ParseSuite(suite.Cipher, suite.Hash)
+		if err != nil {
+			return s, fmt.Errorf("cipher_suites: %w", err)
+		}
+		s.suites = append(s.suites, ns)
+	}
+	if len(s.suites) == 0 {
+		s.suites = []noise.Suite{noise.DefaultSuite}
+	}
+	s.probes = s.suites
+	if !slices.Contains(s.suites, noise.DefaultSuite) {
+		// A single extra comparison rejects the clients left with the default suite, without trying every suite.
+		s.probes = append(slices.Clip(s.suites), noise.DefaultSuite)
+	}
+
+	for identifier, client := range cfg.Clients {
+		suite, err := noise.ParseSuite(client.CipherSuite.Cipher, client.CipherSuite.Hash)
+		if err != nil {
+			return s, fmt.Errorf("client %s: cipher_suite: %w", identifier, err)
+		}
+
+		// The legacy lookup only tries the patterns and the suite allowed by the client configuration.
+		if client.PostQuantum {
+			s.adverts[identifier] = []noise.Peer{{Pattern: noise.PatternIK, Hybrid: true, Suite: suite}}
+			continue
+		}
+		s.adverts[identifier] = []noise.Peer{
+			{Pattern: noise.PatternIK, Suite: suite},
+			{Pattern: noise.PatternXX, Suite: suite},
+		}
+	}
+
+	for _, cidr := range cfg.ProxyProtocol {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return s, fmt.Errorf("proxy_protocol: %w", err)
+		}
+		s.trusted = append(s.trusted, n)
+	}
+	for _, address := range cfg.Address {
+		if u, err := url.Parse(address); err == nil && u.Scheme == "mnet" {
+			l.Warnf("The mnet transport of %s is deprecated, use rudp on both peers", listenerName(address))
+		}
+	}
+	if len(s.trusted) > 0 {
+		// The header of the other transports would be read after their handshake (e.g. TLS or WebSocket).
+		for _, address := range cfg.Address {
+			if u, err := url.Parse(address); err == nil && !slices.Contains([]string{"tcp", "tcp4", "tcp6", "unix"}, u.Scheme) {
+				return s, fmt.Errorf("proxy_protocol: unsupported by the %s listener, only tcp and unix listeners accept it", listenerName(address))
+			}
+		}
+	}
+
 	s.outbound, err = NewOutbound(cfg, l)
-	return s, err
+	if err != nil {
+		return s, err
+	}
+	s.outbound.sessions = s.sessions
+
+	return s, nil
 }
 
-// Listen listens for incoming tunnels.
+// Listen listens for incoming tunnels on all the configured addresses.
+// It returns when one of the listeners fails or once all the sessions are drained after a restart.
 func (s *server) Listen() error {
-	l, err := snet.Listen(s.cfg.Address)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", s.cfg.Address, err)
+	if len(s.cfg.Address) == 0 {
+		return errors.New("no listening address")
+	}
+
+	listeners := make([]net.Listener, 0, len(s.cfg.Address))
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
+	for _, address := range s.cfg.Address {
+		l, err := snet.Listen(address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	s.mu.Lock()
+	s.listeners = listeners
+	s.mu.Unlock()
+
+	errc := make(chan error, len(listeners))
+	for i, l := range listeners {
+		go func() {
+			errc <- s.serve(listenerName(s.cfg.Address[i]), l)
+		}()
+	}
+
+	stop := s.watch()
+	defer stop()
+
+	snet.CloseUnusedListeners()
+	if err := ready(); err != nil {
+		s.log.WithError(err).Warn("failed to notify readiness")
+	}
+
+	err := <-errc
+	if !s.sessions.isDraining() {
+		return err
+	}
+
+	for range len(listeners) - 1 {
+		<-errc
 	}
+	if !s.sessions.wait(s.drainTimeout()) {
+		s.log.Warn("Drain timeout elapsed, the remaining sessions are closed")
+		return nil
+	}
+	s.log.Info("All sessions drained")
+	return nil
+}
 
-	s.log.Infof("Listening on %s", s.cfg.Address)
+// serve runs the accept loop of the given listener.
+func (s *server) serve(listener string, l net.Listener) error {
+	s.log.Infof("Listening on %s", listener)
 	for {
 		c, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return fmt.Errorf("listener %s closed: %w", listener, err)
+		}
 		if err != nil {
-			s.log.WithError(err).Warn("failed to accept connection")
+			s.log.WithError(err).Warnf("failed to accept connection on %s", listener)
 			continue
 		}
 
+		done := s.sessions.track(c)
 		go func() {
-			defer c.Close()
-			snet.EnableKeepAlive(c)
+			defer done()
+			s.handle(listener, c)
+		}()
+	}
+}
 
-			log := s.log.WithPrefixf("[%s]", basex.GenerateID())
-			log.Info("Handshake")
+// handle performs the handshake and controls of an incoming session then runs its stream.
+func (s *server) handle(listener string, c net.Conn) {
+	defer c.Close()
+	snet.EnableKeepAlive(c)
 
-			defer drain(log, c)
+	log := s.log.WithPrefixf("[%s][%s]", listener, basex.GenerateID())
+	raw := c
+	defer func() {
+		if s.sessions.isDraining() {
+			return // Closes the connection so the client reconnects to the new server process.
+		}
+		drain(log, raw)
+	}()
 
-			//
-			// Identifier
-			//
+	//
+	// PROXY protocol
+	//
 
-			log.Debug("Reading derived identifier")
-			derived := make([]byte, seikan.KDFLength)
-			if _, err = io.ReadFull(c, derived); err != nil {
-				log.Errorf("failed to read derived identifier: %s", err.Error())
-				return
-			}
+	c, err := snet.AcceptProxyProtocol(c, s.trusted)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	remote := c.RemoteAddr() // Client address, recovered from the PROXY protocol header of a trusted upstream
 
-			recipient, sessid, err := s.recipient(derived)
-			if err != nil {
-				log.Error(err.Error())
-				return
-			}
+	//
+	// Identifier
+	//
 
-			//
-			// Handshake
-			//
+	log.Debug("Reading derived identifier")
+	derived := make([]byte, seikan.KDFLength)
+	if _, err := io.ReadFull(c, derived); err != nil {
+		log.Errorf("failed to read derived identifier from %s: %s", c.RemoteAddr(), err.Error())
+		return
+	}
 
-			log.Debug("Performing Noise handshake")
-			c, err = noise.Handshake(c, identity(s.cfg), recipient, true)
-			if err != nil {
-				if !errors.Is(err, io.EOF) {
-					log = log.WithError(err)
-				}
-				log.Error("failed to perform handshake")
-				return
-			}
+	advertised, err := s.recipient(derived)
+	if err != nil {
+		log.Errorf("%s from %s", err.Error(), c.RemoteAddr())
+		return
+	}
+	peer, sessid := advertised.peer, advertised.identifier
+	public := peer.Public    // Static key of the client
+	var cert *ca.Certificate // Certificate of a client identified by the CA
 
-			//
-			// Compression
-			//
+	if peer.Pattern == noise.PatternNNpsk0 {
+		resumed, err := s.resume(c, time.Now())
+		if err != nil {
+			log.Errorf("%s from %s", err.Error(), c.RemoteAddr())
+			return
+		}
 
-			c, err = snet.Compress(c)
-			if err != nil {
-				log.Error(err.Error())
-				return
-			}
-			defer c.Close() // Compression only
-
-			//
-			// Controls
-			//
-
-			var await bool
-			var stream stream
-			for {
-				pdu, err := control.Decode(c)
-				if errors.Is(err, io.EOF) {
-					log.Error("connection closed during control")
+		peer.PSK = resumed.PSK
+		sessid, public, cert = resumed.Identifier, resumed.Public, resumed.Certificate
+	}
+
+	if peer.Lookup {
+		peer.Resolve = func(key string) (string, error) {
+			identifier, psk, err := s.resolve(peer, key)
+			sessid, public = identifier, key
+			return psk, err
+		}
+
+		if s.cfg.CA != "" {
+			peer.Certify = func(key, certificate string) error {
+				if sessid != "" {
+					return nil // Registered client
 				}
 
+				certified, err := s.certify(key, certificate, time.Now())
 				if err != nil {
-					log.WithError(err).Error("failed to receive control")
+					return err
+				}
 
-					pid := "unkown"
-					if pdu != nil {
-						pid = pdu.PID()
-					}
+				cert, sessid = certified, certified.Identifier
+				return nil
+			}
+		}
+	}
 
-					resp := control.NewError(pid)
-					resp.Status = http.StatusInternalServerError
-					resp.Message = "failed to receive control"
-					control.EncodeTo(c, resp)
+	log.Infof("Handshake from %s", c.RemoteAddr())
 
-					return
-				}
+	//
+	// Handshake
+	//
 
-				pdu, stream, await = s.control(log, sessid, pdu)
-				if err = control.EncodeTo(c, pdu); err != nil {
-					log.WithError(err).Error("failed to send control")
+	log.Debug("Performing Noise handshake")
+	// The client initiates the XX pattern to authenticate the server before sending its static key,
+	// and the IK pattern of the key lookup so the server learns its static key from the first message.
+	nc, err := noise.Handshake(c, advertised.keypair.identity, peer, peer.Pattern == noise.PatternIK && !peer.Lookup, session(s.cfg.Rekey, s.cfg.Obfuscation))
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			log = log.WithError(err)
+		}
+		log.Error("failed to perform handshake")
+		return
+	}
 
-					resp := control.NewError(pdu.PID())
-					resp.Status = http.StatusInternalServerError
-					resp.Message = "failed to send control"
-					control.EncodeTo(c, resp)
+	switch {
+	case peer.Pattern == noise.PatternNNpsk0:
+		log.Debugf("Client %s resumed its session", sessid)
+	case peer.Lookup:
+		log.Debugf("Client %s identified by its public key", sessid)
+	}
 
-					return
-				}
+	//
+	// Compression
+	//
 
-				if stream != nil {
-					break
-				}
+	compression, err := s.compression(nc.Compression)
+	if err != nil {
+		log.WithError(err).Error("failed to negotiate compression")
+		return
+	}
+	if nc.Compression != "" {
+		log.Debugf("Using %s compression", compression)
+	}
 
-				if !await {
-					log.Info("closing connection")
-					return
-				}
+	c, err = snet.CompressWith(nc, compression)
+	if err != nil {
+		log.Error(err.Error())
+		return
+	}
+	defer c.Close() // Compression only
+
+	//
+	// Controls
+	//
+
+	var await, issued bool
+	var stream stream
+	for {
+		pdu, err := control.Decode(c)
+		if errors.Is(err, io.EOF) {
+			log.Error("connection closed during control")
+		}
+
+		if err != nil {
+			log.WithError(err).Error("failed to receive control")
+
+			pid := "unkown"
+			if pdu != nil {
+				pid = pdu.PID()
 			}
 
-			//
-			// Streaming
-			//
+			resp := control.NewError(pid)
+			resp.Status = http.StatusInternalServerError
+			resp.Message = "failed to receive control"
+			control.EncodeTo(c, resp)
+
+			return
+		}
+
+		if control.AcceptsServerKey(pdu) && advertised.keypair.rotated() {
+			notice := control.NewServerKey(pdu.PID())
+			notice.Public = s.cfg.Public
+			notice.NotAfter = advertised.keypair.notAfter.Unix()
 
-			if err = stream(c); err != nil {
-				log.WithError(err).Error("stream closed")
+			if err = control.EncodeTo(c, notice); err != nil {
+				log.WithError(err).Error("failed to send server key")
+				return
 			}
-		}()
+			log.Infof("Announced the current server public key, the previous one expires at %s", advertised.keypair.notAfter)
+		}
+
+		if control.AcceptsTicket(pdu) && s.tickets != nil && sessid != "" && !issued {
+			notice, err := s.issue(pdu.PID(), sessid, public, cert)
+			if err != nil {
+				log.WithError(err).Error("failed to issue ticket")
+			} else if err = control.EncodeTo(c, notice); err != nil {
+				log.WithError(err).Error("failed to send ticket")
+				return
+			}
+			issued = true
+		}
+
+		pdu, stream, await = s.control(log, listener, sessid, remote, cert, pdu)
+		if err = control.EncodeTo(c, pdu); err != nil {
+			log.WithError(err).Error("failed to send control")
+
+			resp := control.NewError(pdu.PID())
+			resp.Status = http.StatusInternalServerError
+			resp.Message = "failed to send control"
+			control.EncodeTo(c, resp)
+
+			return
+		}
+
+		if stream != nil {
+			break
+		}
+
+		if !await {
+			log.Info("closing connection")
+			return
+		}
+	}
+
+	//
+	// Streaming
+	//
+
+	if err = stream(c, raw); err != nil {
+		log.WithError(err).Error("stream closed")
 	}
 }
 
-func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (control.PDU, stream, bool) {
+func (s *server) control(log logger.Logger, listener, sessid string, remote net.Addr, cert *ca.Certificate, pdu control.PDU) (control.PDU, stream, bool) {
 	log.Infof("Performing %s control", pdu.ControlID())
 
 	switch p := pdu.(type) {
@@ -216,14 +613,21 @@ func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (con
 		//
 
 		var addresses []string
+		compressions := make(map[string]string)
 		for _, outbound := range s.cfg.Outbounds {
 			if outbound.Identifier == p.Identifier {
 				addresses = append(addresses, outbound.Destination)
+				if outbound.Compression != "" {
+					compressions[outbound.Destination] = outbound.Compression
+				}
 			}
 		}
 
 		resp := control.NewInboundsResp(pdu.PID())
 		resp.Inbounds = addresses
+		if len(compressions) > 0 {
+			resp.Compressions = compressions
+		}
 
 		return resp, nil, false
 		//
@@ -247,6 +651,24 @@ func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (con
 			return resp, nil, false
 		}
 
+		if p.ProxyProtocol < 0 || p.ProxyProtocol > proxyproto.V2 {
+			resp := control.NewError(pdu.PID())
+			resp.Status = http.StatusUnprocessableEntity
+			resp.Message = "unsupported PROXY protocol version"
+
+			return resp, nil, false
+		}
+
+		if cert != nil && !cert.Allows(p.Address) {
+			log.Warnf("Rejected %s, not allowed by the certificate", p.Address)
+
+			resp := control.NewError(pdu.PID())
+			resp.Status = http.StatusForbidden
+			resp.Message = "destination not allowed"
+
+			return resp, nil, false
+		}
+
 		err := s.approver.Allowed(context.Background(), p.Address)
 		if len(s.cfg.AllowList) > 0 && err != nil {
 			log.WithError(err).Warnf("Rejected %s", p.Address)
@@ -261,17 +683,24 @@ func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (con
 		//
 
 		tun := smux.Tunnel{
-			Source:      p.Identifier,
-			Remote:      s.cfg.Address,
-			Destination: p.Address,
+			Source:        p.Identifier,
+			Remote:        listener,
+			Destination:   p.Address,
+			ProxyProtocol: s.proxyProtocol(p.Address),
+			Metadata:      p.ProxyProtocol > 0,
+			Peer:          remote,
+			Sources:       s.sources[p.Identifier],
 		}
 
-		stream := func(c net.Conn) error {
+		stream := func(c, raw net.Conn) error {
+			tun.Local = raw.LocalAddr()
+
 			smux, err := smux.NewServer(log.WithPrefix("[ingoing ]"), tun, c)
 			if err != nil {
 				return fmt.Errorf("failed to establish connection for %s.%s: %w", p.Identifier, p.Address, err)
 			}
 			defer smux.Close()
+			defer s.sessions.add(p.Identifier, smux, raw)()
 
 			return smux.Listen()
 		}
@@ -279,6 +708,9 @@ func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (con
 		//
 
 		resp := control.NewBindCSResp(pdu.PID())
+		if tun.Metadata && tun.ProxyProtocol > 0 {
+			resp.ProxyProtocol = tun.ProxyProtocol // The client sends the stream metadata
+		}
 		return resp, stream, false
 		//
 		//
@@ -303,17 +735,29 @@ func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (con
 
 		//
 
-		stream := func(c net.Conn) error {
+		outbound := config.Outbound{Identifier: p.Identifier, Destination: p.Address}
+		if o, ok := s.outbound.Lookup(p.Identifier, p.Address); ok && o.ProxyProtocol > 0 {
+			if p.Metadata {
+				outbound.ProxyProtocol = o.ProxyProtocol
+			} else {
+				log.Warnf("PROXY protocol disabled for %s, the client does not support stream metadata", p.Address)
+			}
+		}
+
+		stream := func(c, raw net.Conn) error {
 			return s.outbound.Establish(
 				log.WithPrefix("[outgoing]"),
-				config.Outbound{Identifier: p.Identifier, Destination: p.Address},
+				listener,
+				outbound,
 				c,
+				raw,
 			)
 		}
 
 		//
 
 		resp := control.NewBindSCResp(pdu.PID())
+		resp.ProxyProtocol = outbound.ProxyProtocol
 		return resp, stream, false
 		//
 		//
@@ -326,27 +770,366 @@ func (s *server) control(log logger.Logger, sessid string, pdu control.PDU) (con
 	}
 }
 
-func (s *server) recipient(derived []byte) (string, string, error) {
+// compression returns the compression requested by the client, its level is lowered to the maximum level of the server.
+func (s *server) compression(requested string) (snet.Compression, error) {
+	compression, err := snet.ParseCompression(requested)
+	if err != nil {
+		return compression, err
+	}
+
+	if max := s.levels[compression.Algorithm]; compression.Level > max {
+		compression.Level = max
+	}
+	return compression, nil
+}
+
+// proxyProtocol returns the PROXY protocol version enabled by the allow list for the given destination, zero if disabled.
+func (s *server) proxyProtocol(address string) int {
+	for _, p := range s.proxies {
+		if p.network == nil {
+			if p.endpoint == address {
+				return p.version
+			}
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil && p.network.Contains(ip) {
+			return p.version
+		}
+	}
+
+	return 0
+}
+
+// recipient returns the client advertised by the given derived identifier.
+// The key lookup is tried first, its peer is resolved during the handshake so the identifier is empty.
+// Otherwise, the identifier of every registered client is tried (legacy lookup) with the current keypair.
+// Only the advertisings allowed by the client configuration are tried, at most two per client:
+// the hybrid one for a client requiring the post-quantum handshake, IK and XX otherwise, with the suite of the client.
+// A client advertising a suite that is not accepted is rejected before the handshake.
+func (s *server) recipient(derived []byte) (advert, error) {
+	if found, ok, err := s.lookup(derived); ok {
+		return found, err
+	}
+
+	if s.cfg.KeyLookupOnly {
+		return advert{}, errors.New("unknown receipient")
+	}
+
 	for identifier, receipient := range s.cfg.Clients {
-		if seikan.KDFCompare(derived, identifier) {
-			return receipient, identifier, nil
+		for _, peer := range s.adverts[identifier] {
+			if !seikan.KDFCompareInfo(derived, identifier, noise.Advertising(peer)) {
+				continue
+			}
+
+			if err := s.fresh(derived, identifier); err != nil {
+				return advert{}, fmt.Errorf("client %s: %w", identifier, err)
+			}
+
+			if !slices.Contains(s.suites, peer.Suite) {
+				return advert{}, fmt.Errorf("client %s: cipher suite %s not accepted", identifier, peer.Suite)
+			}
+
+			if err := s.validate(identifier, receipient, time.Now()); err != nil {
+				return advert{}, err
+			}
+
+			peer.Public = receipient.Public
+			peer.PSK = receipient.PSK
+			return advert{peer: peer, identifier: identifier, keypair: s.keypairs[0]}, nil
+		}
+	}
+
+	return advert{}, errors.New("unknown receipient")
+}
+
+// lookup returns the client advertised by the given derived identifier with the key lookup or the session resumption.
+// The identifier is derived from the server public key expected by the client, all the valid keypairs are tried.
+// The cost does not depend on the number of clients.
+func (s *server) lookup(derived []byte) (advert, bool, error) {
+	now := time.Now()
+
+	for _, pair := range s.keypairs {
+		if pair.rotated() && now.After(pair.notAfter) {
+			continue
+		}
+		secret := noise.PublicKey(pair.identity.Public)
+
+		if found, ok, err := s.resumption(derived, secret, pair); ok {
+			return found, ok, err
+		}
+
+		for _, pattern := range []noise.HandshakePattern{noise.PatternIK, noise.PatternIKpsk2} {
+			for _, hybrid := range []bool{false, true} {
+				for _, suite := range s.probes {
+					peer := noise.Peer{Pattern: pattern, Hybrid: hybrid, Suite: suite, Lookup: true}
+					if !seikan.KDFCompareInfo(derived, secret, noise.Advertising(peer)) {
+						continue
+					}
+
+					if err := s.fresh(derived, secret); err != nil {
+						return advert{}, true, fmt.Errorf("key lookup: %w", err)
+					}
+
+					if !slices.Contains(s.suites, suite) {
+						return advert{}, true, fmt.Errorf("key lookup: cipher suite %s not accepted", suite)
+					}
+
+					return advert{peer: peer, keypair: pair}, true, nil
+				}
+			}
 		}
 	}
 
-	return "", "", errors.New("unknown receipient")
+	return advert{}, false, nil
 }
 
-func identity(c config.Server) noise.Identity {
+// resumption returns the resumed session advertised by the given derived identifier, its client is resolved from its ticket.
+func (s *server) resumption(derived []byte, secret string, pair keypair) (advert, bool, error) {
+	if s.tickets == nil {
+		return advert{}, false, nil
+	}
+
+	for _, suite := range s.probes {
+		peer := noise.Peer{Pattern: noise.PatternNNpsk0, Suite: suite}
+		if !seikan.KDFCompareInfo(derived, secret, noise.Advertising(peer)) {
+			continue
+		}
+
+		if err := s.fresh(derived, secret); err != nil {
+			return advert{}, true, fmt.Errorf("resumption: %w", err)
+		}
+
+		if !slices.Contains(s.suites, suite) {
+			return advert{}, true, fmt.Errorf("resumption: cipher suite %s not accepted", suite)
+		}
+
+		return advert{peer: peer, keypair: pair}, true, nil
+	}
+
+	return advert{}, false, nil
+}
+
+// rotated returns true for a previous keypair of the server.
+func (k keypair) rotated() bool {
+	return !k.notAfter.IsZero()
+}
+
+// resolve returns the identifier and the pre-shared key of the client owning the given public key.
+// The client must use the handshake modifiers it is registered with.
+// An unknown client is identified by its certificate when the server has a certificate authority (see certify),
+// the identifier is then empty.
+func (s *server) resolve(peer noise.Peer, public string) (string, string, error) {
+	identifier, ok := s.keys[noise.PublicKey(public)]
+	if !ok {
+		if s.cfg.CA == "" || peer.Pattern == noise.PatternIKpsk2 {
+			return "", "", errors.New("unknown client public key")
+		}
+		return "", "", nil
+	}
+
+	client := s.cfg.Clients[identifier]
+	if err := s.validate(identifier, client, time.Now()); err != nil {
+		return "", "", err
+	}
+	if client.PostQuantum && !peer.Hybrid {
+		return "", "", fmt.Errorf("client %s: post-quantum handshake required", identifier)
+	}
+	if (client.PSK != "") != (peer.Pattern == noise.PatternIKpsk2) {
+		return "", "", fmt.Errorf("client %s: pre-shared key mismatch", identifier)
+	}
+
+	return identifier, client.PSK, nil
+}
+
+// certify returns the verified certificate presented by a client for its public key.
+// The certificate must be signed by the certificate authority of the server and valid at the given time.
+// Its identifier cannot be one of the registered clients.
+func (s *server) certify(public, certificate string, now time.Time) (*ca.Certificate, error) {
+	if certificate == "" {
+		return nil, errors.New("unknown client public key")
+	}
+
+	cert, err := ca.Verify(s.cfg.CA, certificate, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if noise.PublicKey(cert.Public) != noise.PublicKey(public) {
+		return nil, fmt.Errorf("client %s: certificate issued for another public key", cert.Identifier)
+	}
+
+	if _, ok := s.cfg.Clients[cert.Identifier]; ok {
+		return nil, fmt.Errorf("client %s: certificate for a registered client", cert.Identifier)
+	}
+
+	if err = s.validate(cert.Identifier, certifiedKey(cert), now); err != nil {
+		return nil, err
+	}
+
+	s.certified.Store(cert.Identifier, cert)
+	return &cert, nil
+}
+
+// validate checks that the given client is neither revoked nor outside of its validity period at the given time.
+func (s *server) validate(identifier string, client config.ClientKey, now time.Time) error {
+	if s.revoked.revoked(identifier, client.Public) {
+		return fmt.Errorf("client %s: revoked", identifier)
+	}
+	if !client.NotBefore.IsZero() && now.Before(client.NotBefore) {
+		return fmt.Errorf("client %s: not valid before %s", identifier, client.NotBefore)
+	}
+	if !client.NotAfter.IsZero() && now.After(client.NotAfter) {
+		return fmt.Errorf("client %s: expired since %s", identifier, client.NotAfter)
+	}
+	return nil
+}
+
+// watch reads the revocation list again when modified and tears down the live sessions of the revoked or expired clients,
+// until the returned function is called.
+func (s *server) watch() func() {
+	ticker := time.NewTicker(revocationsInterval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			if reloaded, err := s.revoked.reload(); err != nil {
+				s.log.WithError(err).Warn("failed to read the revocation list")
+			} else if reloaded {
+				s.log.Info("Revocation list reloaded")
+			}
+
+			s.teardown(time.Now())
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// teardown closes the live sessions of the clients that are not valid at the given time.
+// The expired certificates are forgotten.
+func (s *server) teardown(now time.Time) int {
+	s.certified.Range(func(identifier, cert any) bool {
+		if now.After(cert.(ca.Certificate).NotAfter) {
+			s.certified.Delete(identifier)
+		}
+		return true
+	})
+
+	return s.sessions.teardown(func(identifier string) bool {
+		client, ok := s.cfg.Clients[identifier]
+		if !ok {
+			cert, ok := s.certified.Load(identifier)
+			if !ok {
+				return true
+			}
+			client = certifiedKey(cert.(ca.Certificate))
+		}
+
+		err := s.validate(identifier, client, now)
+		if err != nil {
+			s.log.Warnf("Tearing down a session: %s", err)
+		}
+		return err != nil
+	})
+}
+
+// fresh checks the time embedded in the derived identifier of the client and rejects the replayed identifiers.
+func (s *server) fresh(derived []byte, identifier string) error {
+	skew := s.cfg.ReplayProtection.ClockSkew
+
+	t := seikan.KDFTime(derived, identifier)
+	expiration := t.Add(skew)
+	if d := time.Since(t); d > skew || d < -skew {
+		if !*s.cfg.ReplayProtection.Legacy {
+			return errors.New("identifier is too old or from an older client")
+		}
+		// The legacy mode only relaxes the time check, the salt is remembered for a fixed duration.
+		expiration = time.Now().Add(legacyReplayTTL)
+	}
+
+	if !s.replays.Add(seikan.KDFSalt(derived), expiration) {
+		return errors.New("identifier replayed")
+	}
+	return nil
+}
+
+// drainTimeout returns the maximum duration of the drain after a restart.
+func (s *server) drainTimeout() time.Duration {
+	if s.cfg.Restart.DrainTimeout > 0 {
+		return s.cfg.Restart.DrainTimeout
+	}
+	return defaultDrainTimeout
+}
+
+// listenerName returns the address of a listener without its query parameters (e.g. certificate paths).
+func listenerName(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+
+	u.RawQuery = ""
+	u.User = nil
+	return u.String()
+}
+
+// certifiedKey returns the client key of the given certificate.
+func certifiedKey(cert ca.Certificate) config.ClientKey {
+	return config.ClientKey{
+		Public:    cert.Public,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
+
+func identity(secret, public string) noise.Identity {
 	return noise.Identity{
-		Secret: c.Secret,
-		Public: c.Public,
+		Secret: secret,
+		Public: public,
+	}
+}
+
+func session(r config.Rekey, o config.Obfuscation) noise.SessionOptions {
+	padding, _ := noise.ParsePadding(o.Padding) // Validated by New
+
+	return noise.SessionOptions{
+		Rekey: noise.RekeyPolicy{
+			Interval: r.Interval,
+			Bytes:    r.Bytes,
+			Chunks:   r.Chunks,
+		},
+		Rehandshake: r.Rehandshake,
+		Obfuscation: noise.Obfuscation{
+			Enabled: o.Enabled,
+			Padding: padding,
+			Cover:   o.Cover,
+		},
 	}
 }
 
 // Drain c to avoid leaking server behavioral features
 // see https://www.ndss-symposium.org/ndss-paper/detecting-probe-resistant-proxies/
+// The connection is drained for probeDrainTimeout at most.
 func drain(log logger.Logger, c net.Conn) {
+	c.SetReadDeadline(time.Now().Add(probeDrainTimeout))
 	_, err := io.Copy(ioutil.Discard, c)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
 	if err != nil {
 		log.Warnf("Draining error: %s", err)
 	}
@@ -0,0 +1,644 @@
+package server_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/seikan/internal/ca"
+	"github.com/mdouchement/seikan/internal/config"
+	"github.com/mdouchement/seikan/internal/noise"
+	"github.com/mdouchement/seikan/internal/seikan"
+	"github.com/mdouchement/seikan/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	identity := noise.GenerateIdentity()
+	alice := noise.GenerateIdentity()
+	bob := noise.GenerateIdentity()
+	mallory := noise.GenerateIdentity()
+
+	cfg := config.Server{
+		Secret: identity.Secret,
+		Public: identity.Public,
+		Clients: map[string]config.ClientKey{
+			"alice": {Public: alice.Public},
+			"bob":   {Public: bob.Public, PSK: noise.GeneratePSK(), PostQuantum: true},
+		},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	advertise := func(secret string, peer noise.Peer) []byte {
+		derived, err := seikan.KDFGenerateTime(secret, noise.Advertising(peer), time.Now())
+		assert.NoError(t, err)
+		return derived
+	}
+
+	lookup := func(psk string, hybrid bool) []byte {
+		return advertise(identity.Public, noise.Peer{Pattern: noise.PatternIK, PSK: psk, Hybrid: hybrid, Lookup: true})
+	}
+
+	identifier, err := server.Lookup(s, lookup("", false), alice.Public)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", identifier)
+
+	identifier, err = server.Lookup(s, lookup("psk", true), bob.Public)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", identifier)
+
+	_, err = server.Lookup(s, lookup("", false), mallory.Public)
+	assert.EqualError(t, err, "unknown client public key")
+
+	_, err = server.Lookup(s, lookup("", true), bob.Public)
+	assert.EqualError(t, err, "client bob: pre-shared key mismatch")
+
+	_, err = server.Lookup(s, lookup("psk", false), bob.Public)
+	assert.EqualError(t, err, "client bob: post-quantum handshake required")
+
+	// Legacy lookup
+	identifier, err = server.Lookup(s, advertise("alice", noise.Peer{Pattern: noise.PatternIK}), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", identifier)
+
+	cfg.KeyLookupOnly = true
+	s, err = server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	_, err = server.Lookup(s, advertise("alice", noise.Peer{Pattern: noise.PatternIK}), "")
+	assert.EqualError(t, err, "unknown receipient")
+
+	//
+
+	cfg.Clients["eve"] = config.ClientKey{Public: alice.Public}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.ErrorContains(t, err, "share the same public key")
+}
+
+func TestLookup_Replay(t *testing.T) {
+	identity := noise.GenerateIdentity()
+	alice := noise.GenerateIdentity()
+
+	for _, legacy := range []*bool{new(bool), nil} { // Enabled when unset
+		cfg := config.Server{
+			Secret:           identity.Secret,
+			Public:           identity.Public,
+			Clients:          map[string]config.ClientKey{"alice": {Public: alice.Public}},
+			ReplayProtection: config.ReplayProtection{Legacy: legacy},
+		}
+
+		s, err := server.New(cfg, logger.NewNullLogger())
+		assert.NoError(t, err)
+
+		derived, err := seikan.KDFGenerateTime("alice", nil, time.Now())
+		assert.NoError(t, err)
+
+		_, err = server.Lookup(s, derived, "")
+		assert.NoError(t, err)
+		_, err = server.Lookup(s, derived, "")
+		assert.EqualError(t, err, "client alice: identifier replayed")
+
+		old, err := seikan.KDFGenerateTime("alice", nil, time.Unix(0, 0))
+		assert.NoError(t, err)
+
+		_, err = server.Lookup(s, old, "")
+		if legacy != nil {
+			assert.EqualError(t, err, "client alice: identifier is too old or from an older client")
+			continue
+		}
+
+		// The legacy mode only relaxes the time check.
+		assert.NoError(t, err)
+		_, err = server.Lookup(s, old, "")
+		assert.EqualError(t, err, "client alice: identifier replayed")
+	}
+}
+
+func TestLookup_Suites(t *testing.T) {
+	identity := noise.GenerateIdentity()
+	alice := noise.GenerateIdentity()
+	bob := noise.GenerateIdentity()
+
+	cfg := config.Server{
+		Secret: identity.Secret,
+		Public: identity.Public,
+		Clients: map[string]config.ClientKey{
+			"alice": {Public: alice.Public, CipherSuite: config.CipherSuite{Cipher: "aes256gcm", Hash: "blake2s"}},
+			"bob":   {Public: bob.Public},
+		},
+		CipherSuites: []config.CipherSuite{{Cipher: "aes256gcm", Hash: "blake2s"}},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	advertise := func(secret, cipher, hash string, lookup bool) []byte {
+		suite, err := noise.ParseSuite(cipher, hash)
+		assert.NoError(t, err)
+
+		derived, err := seikan.KDFGenerateTime(secret, noise.Advertising(noise.Peer{Pattern: noise.PatternIK, Suite: suite, Lookup: lookup}), time.Now())
+		assert.NoError(t, err)
+		return derived
+	}
+
+	identifier, err := server.Lookup(s, advertise("alice", "aes256gcm", "blake2s", false), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", identifier)
+
+	identifier, err = server.Lookup(s, advertise(identity.Public, "aes256gcm", "blake2s", true), alice.Public)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", identifier)
+
+	// The legacy lookup only tries the suite of the client.
+	assert.Equal(t, 4, server.Adverts(s)) // IK and XX by client
+	_, err = server.Lookup(s, advertise("alice", "", "", false), "")
+	assert.EqualError(t, err, "unknown receipient")
+
+	_, err = server.Lookup(s, advertise("bob", "", "", false), "")
+	assert.EqualError(t, err, "client bob: cipher suite chacha20poly1305+blake2b not accepted")
+
+	// The default suite is the only one matched by the key lookup when it is not accepted.
+
+	_, err = server.Lookup(s, advertise(identity.Public, "", "", true), alice.Public)
+	assert.EqualError(t, err, "key lookup: cipher suite chacha20poly1305+blake2b not accepted")
+
+	_, err = server.Lookup(s, advertise("alice", "aes256gcm", "", false), "")
+	assert.EqualError(t, err, "unknown receipient")
+
+	cfg.Clients["eve"] = config.ClientKey{Public: noise.GenerateIdentity().Public, CipherSuite: config.CipherSuite{Cipher: "des"}}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.ErrorContains(t, err, "client eve: cipher_suite")
+}
+
+func TestLookup_Rotation(t *testing.T) {
+	current := noise.GenerateIdentity()
+	previous := noise.GenerateIdentity()
+	expired := noise.GenerateIdentity()
+	alice := noise.GenerateIdentity()
+
+	cfg := config.Server{
+		Secret: current.Secret,
+		Public: current.Public,
+		PreviousKeys: []config.Keypair{
+			{Secret: previous.Secret, Public: previous.Public, NotAfter: time.Now().Add(time.Hour)},
+			{Secret: expired.Secret, Public: expired.Public, NotAfter: time.Now().Add(-time.Hour)},
+		},
+		Clients: map[string]config.ClientKey{
+			"alice": {Public: alice.Public},
+		},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	lookup := func(public string) []byte {
+		peer := noise.Peer{Pattern: noise.PatternIK, Lookup: true}
+		derived, err := seikan.KDFGenerateTime(public, noise.Advertising(peer), time.Now())
+		assert.NoError(t, err)
+		return derived
+	}
+
+	public, err := server.ServerKey(s, lookup(current.Public))
+	assert.NoError(t, err)
+	assert.Equal(t, current.Public, public)
+
+	public, err = server.ServerKey(s, lookup(previous.Public))
+	assert.NoError(t, err)
+	assert.Equal(t, previous.Public, public)
+
+	_, err = server.ServerKey(s, lookup(expired.Public))
+	assert.EqualError(t, err, "unknown receipient")
+
+	// Legacy lookup
+	derived, err := seikan.KDFGenerateTime("alice", nil, time.Now())
+	assert.NoError(t, err)
+
+	public, err = server.ServerKey(s, derived)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Public, public)
+
+	//
+
+	cfg.PreviousKeys[0].NotAfter = time.Time{}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "previous_keys[0]: secret, public and not_after are required")
+}
+
+func TestRevocations(t *testing.T) {
+	identity := noise.GenerateIdentity()
+	alice := noise.GenerateIdentity()
+	bob := noise.GenerateIdentity()
+
+	revocations := filepath.Join(t.TempDir(), "revocations")
+	assert.NoError(t, os.WriteFile(revocations, []byte("# Revoked clients\nalice\n"), 0o600))
+
+	cfg := config.Server{
+		Secret: identity.Secret,
+		Public: identity.Public,
+		Clients: map[string]config.ClientKey{
+			"alice":   {Public: alice.Public},
+			"bob":     {Public: bob.Public},
+			"charlie": {Public: noise.GenerateIdentity().Public, NotAfter: time.Now().Add(-time.Hour)},
+			"dave":    {Public: noise.GenerateIdentity().Public, NotBefore: time.Now().Add(time.Hour)},
+		},
+		Revocations: revocations,
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	legacy := func(identifier string) error {
+		derived, err := seikan.KDFGenerateTime(identifier, nil, time.Now())
+		assert.NoError(t, err)
+
+		_, err = server.Lookup(s, derived, "")
+		return err
+	}
+
+	assert.EqualError(t, legacy("alice"), "client alice: revoked")
+	assert.NoError(t, legacy("bob"))
+	assert.ErrorContains(t, legacy("charlie"), "client charlie: expired since")
+	assert.ErrorContains(t, legacy("dave"), "client dave: not valid before")
+
+	peer := noise.Peer{Pattern: noise.PatternIK, Lookup: true}
+	derived, err := seikan.KDFGenerateTime(identity.Public, noise.Advertising(peer), time.Now())
+	assert.NoError(t, err)
+	_, err = server.Lookup(s, derived, alice.Public)
+	assert.EqualError(t, err, "client alice: revoked")
+
+	//
+
+	var closed []string
+	for _, identifier := range []string{"alice", "bob", "charlie"} {
+		server.AddSession(s, identifier, closer(func() { closed = append(closed, identifier) }))
+	}
+
+	n, err := server.Teardown(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"alice", "charlie"}, closed)
+
+	// Revoking bob by its public key
+	assert.NoError(t, os.WriteFile(revocations, []byte(bob.Public+"\n"), 0o600))
+	closed = nil
+
+	n, err = server.Teardown(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"bob"}, closed)
+
+	assert.NoError(t, legacy("alice"))
+	assert.EqualError(t, legacy("bob"), "client bob: revoked")
+}
+
+func TestProxyProtocol(t *testing.T) {
+	identity := noise.GenerateIdentity()
+
+	cfg := config.Server{
+		Secret: identity.Secret,
+		Public: identity.Public,
+		AllowList: []config.AllowWrapper{
+			{Allow: config.Allow{Endpoint: "localhost:6379", ProxyProtocol: 1}},
+			{Allow: config.Allow{Endpoint: "localhost:5432"}},
+			{Allow: config.Allow{Type: "cidr", Endpoint: "10.0.0.0/8", ProxyProtocol: 2}},
+		},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, server.ProxyProtocol(s, "localhost:6379"))
+	assert.Equal(t, 0, server.ProxyProtocol(s, "localhost:5432"))
+	assert.Equal(t, 2, server.ProxyProtocol(s, "10.1.2.3:80"))
+	assert.Equal(t, 0, server.ProxyProtocol(s, "192.168.1.1:80"))
+
+	cfg.AllowList[0].ProxyProtocol = 3
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "allow_list localhost:6379: unsupported proxy_protocol version 3")
+
+	cfg.AllowList[0].ProxyProtocol = 1
+	cfg.Clients = map[string]config.ClientKey{"alice": {Public: noise.GenerateIdentity().Public, ProxySources: []string{"10.0.0.0"}}}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "client alice: proxy_sources: invalid CIDR address: 10.0.0.0")
+
+	// The PROXY protocol header of the upstreams is only read by the tcp and unix listeners.
+	cfg.Clients = nil
+	cfg.ProxyProtocol = []string{"10.0.0.0/8"}
+	cfg.Address = config.Addresses{"tcp://localhost:4242", "unix:///run/seikan.sock"}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	cfg.Address = append(cfg.Address, "tls://localhost:4243?cert=/etc/seikan/cert.pem")
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "proxy_protocol: unsupported by the tls://localhost:4243 listener, only tcp and unix listeners accept it")
+}
+
+func TestCompression(t *testing.T) {
+	identity := noise.GenerateIdentity()
+
+	cfg := config.Server{
+		Secret:            identity.Secret,
+		Public:            identity.Public,
+		CompressionLevels: map[string]int{"zstd": 9},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	for requested, expected := range map[string]string{
+		"":                 "",
+		"none":             "none",
+		"zstd":             "zstd",
+		"zstd:7":           "zstd:7",
+		"zstd:22+adaptive": "zstd:9+adaptive",
+		"lz4:9":            "lz4:1",
+		"s2:3":             "s2:2",
+	} {
+		compression, err := server.Compression(s, requested)
+		assert.NoError(t, err, requested)
+		assert.Equal(t, expected, compression, requested)
+	}
+
+	cfg.CompressionLevels = map[string]int{"lz4": 10}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "compression_levels: unsupported lz4 compression level 10")
+
+	cfg.CompressionLevels = map[string]int{"gzip": 1}
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "compression_levels: unsupported compression gzip")
+}
+
+func TestWaitSessions(t *testing.T) {
+	identity := noise.GenerateIdentity()
+
+	s, err := server.New(config.Server{Secret: identity.Secret, Public: identity.Public}, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	assert.True(t, server.WaitSessions(s, time.Second))
+
+	// A stuck handler returns once its connection is closed by the timeout.
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	done := server.Track(s, c1)
+	go func() {
+		defer done()
+		io.Copy(io.Discard, c1)
+	}()
+
+	assert.False(t, server.WaitSessions(s, 10*time.Millisecond))
+}
+
+func TestCertify(t *testing.T) {
+	identity := noise.GenerateIdentity()
+	authority := ca.GenerateAuthority()
+	alice := noise.GenerateIdentity()
+	carol := noise.GenerateIdentity()
+	mallory := noise.GenerateIdentity()
+
+	revocations := filepath.Join(t.TempDir(), "revocations")
+	assert.NoError(t, os.WriteFile(revocations, nil, 0o600))
+
+	cfg := config.Server{
+		Secret:      identity.Secret,
+		Public:      identity.Public,
+		CA:          authority.Public,
+		Revocations: revocations,
+		Clients: map[string]config.ClientKey{
+			"alice": {Public: alice.Public},
+		},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	sign := func(identifier, public string, validity time.Duration) string {
+		certificate, err := authority.Sign(ca.Certificate{
+			Identifier:   identifier,
+			Public:       public,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(validity),
+			Destinations: []string{"localhost:22"},
+		})
+		assert.NoError(t, err)
+		return certificate
+	}
+
+	lookup := func(psk string) []byte {
+		peer := noise.Peer{Pattern: noise.PatternIK, PSK: psk, Lookup: true}
+		derived, err := seikan.KDFGenerateTime(identity.Public, noise.Advertising(peer), time.Now())
+		assert.NoError(t, err)
+		return derived
+	}
+
+	// Resolved by its certificate after the handshake
+	identifier, err := server.Lookup(s, lookup(""), carol.Public)
+	assert.NoError(t, err)
+	assert.Empty(t, identifier)
+
+	_, err = server.Lookup(s, lookup("psk"), carol.Public)
+	assert.EqualError(t, err, "unknown client public key")
+
+	cert, err := server.Certify(s, carol.Public, sign("carol", carol.Public, time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, "carol", cert.Identifier)
+	assert.Equal(t, []string{"localhost:22"}, cert.Destinations)
+
+	_, err = server.Certify(s, carol.Public, "")
+	assert.EqualError(t, err, "unknown client public key")
+
+	_, err = server.Certify(s, mallory.Public, sign("carol", carol.Public, time.Hour))
+	assert.EqualError(t, err, "client carol: certificate issued for another public key")
+
+	_, err = server.Certify(s, alice.Public, sign("alice", alice.Public, time.Hour))
+	assert.EqualError(t, err, "client alice: certificate for a registered client")
+
+	_, err = server.Certify(s, carol.Public, sign("carol", carol.Public, -time.Second))
+	assert.ErrorContains(t, err, "certificate: expired since")
+
+	other := ca.GenerateAuthority()
+	certificate, err := other.Sign(ca.Certificate{Identifier: "mallory", Public: mallory.Public, NotAfter: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	_, err = server.Certify(s, mallory.Public, certificate)
+	assert.EqualError(t, err, "certificate: invalid signature")
+
+	// Revocation
+	var closed bool
+	server.AddSession(s, "carol", closer(func() { closed = true }))
+
+	n, err := server.Teardown(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	assert.NoError(t, os.WriteFile(revocations, []byte("carol\n"), 0o600))
+
+	n, err = server.Teardown(s)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, closed)
+
+	_, err = server.Certify(s, carol.Public, sign("carol", carol.Public, time.Hour))
+	assert.EqualError(t, err, "client carol: revoked")
+
+	//
+
+	cfg.CA = "ca-pk-trololo"
+	_, err = server.New(cfg, logger.NewNullLogger())
+	assert.EqualError(t, err, "ca: invalid authority public key")
+}
+
+func TestResume(t *testing.T) {
+	identity := noise.GenerateIdentity()
+	alice := noise.GenerateIdentity()
+	bob := noise.GenerateIdentity()
+
+	revocations := filepath.Join(t.TempDir(), "revocations")
+	assert.NoError(t, os.WriteFile(revocations, nil, 0o600))
+
+	cfg := config.Server{
+		Secret: identity.Secret,
+		Public: identity.Public,
+		Clients: map[string]config.ClientKey{
+			"alice": {Public: alice.Public},
+			"bob":   {Public: bob.Public},
+		},
+		Revocations: revocations,
+		Resumption:  config.Resumption{Enabled: true},
+	}
+
+	s, err := server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	ticket, err := server.Issue(s, "alice", alice.Public)
+	assert.NoError(t, err)
+	assert.NoError(t, noise.ValidatePSK(ticket.PSK))
+	assert.InDelta(t, time.Now().Add(time.Hour).Unix(), ticket.NotAfter, 1)
+
+	// The resumed session is advertised with the server public key.
+	peer := noise.Peer{Pattern: noise.PatternNNpsk0, PSK: ticket.PSK}
+	derived, err := seikan.KDFGenerateTime(identity.Public, noise.Advertising(peer), time.Now())
+	assert.NoError(t, err)
+
+	identifier, err := server.Lookup(s, derived, "")
+	assert.NoError(t, err)
+	assert.Empty(t, identifier)
+
+	identifier, psk, err := server.Resume(s, ticket.Ticket)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", identifier)
+	assert.Equal(t, ticket.PSK, psk)
+
+	_, _, err = server.Resume(s, ticket.Ticket)
+	assert.EqualError(t, err, "ticket replayed")
+
+	_, _, err = server.Resume(s, []byte("trololo"))
+	assert.EqualError(t, err, "invalid ticket")
+
+	// Issued before the client was rekeyed or revoked.
+	ticket, err = server.Issue(s, "alice", noise.GenerateIdentity().Public)
+	assert.NoError(t, err)
+	_, _, err = server.Resume(s, ticket.Ticket)
+	assert.EqualError(t, err, "ticket of an unknown client")
+
+	ticket, err = server.Issue(s, "bob", bob.Public)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(revocations, []byte("bob\n"), 0o600))
+	_, err = server.Teardown(s)
+	assert.NoError(t, err)
+
+	_, _, err = server.Resume(s, ticket.Ticket)
+	assert.EqualError(t, err, "client bob: revoked")
+
+	// Disabled
+	cfg.Resumption.Enabled = false
+	s, err = server.New(cfg, logger.NewNullLogger())
+	assert.NoError(t, err)
+
+	_, err = server.Lookup(s, derived, "")
+	assert.EqualError(t, err, "unknown receipient")
+}
+
+type closer func()
+
+func (f closer) Close() error {
+	f()
+	return nil
+}
+
+func BenchmarkLookup(b *testing.B) {
+	identity := noise.GenerateIdentity()
+
+	for _, n := range []int{10, 10000} {
+		cfg := config.Server{
+			Secret:  identity.Secret,
+			Public:  identity.Public,
+			Clients: make(map[string]config.ClientKey, n),
+			// The accepted suites do not multiply the cost of the legacy lookup.
+			CipherSuites: []config.CipherSuite{
+				{Cipher: "chacha20poly1305", Hash: "blake2b"},
+				{Cipher: "chacha20poly1305", Hash: "blake2s"},
+				{Cipher: "aes256gcm", Hash: "blake2b"},
+				{Cipher: "aes256gcm", Hash: "blake2s"},
+			},
+		}
+
+		var client noise.Identity
+		for i := range n {
+			client = noise.GenerateIdentity()
+			cfg.Clients[fmt.Sprintf("client-%d", i)] = config.ClientKey{Public: client.Public}
+		}
+		identifier := fmt.Sprintf("client-%d", n-1)
+
+		s, err := server.New(cfg, logger.NewNullLogger())
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		// A fresh derived identifier is generated for each iteration, the replay cache rejects the replayed ones.
+		lookup := func(b *testing.B, secret string, peer noise.Peer, public string) {
+			for range b.N {
+				b.StopTimer()
+				derived, err := seikan.KDFGenerateTime(secret, noise.Advertising(peer), time.Now())
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if _, err := server.Lookup(s, derived, public); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+
+		b.Run(fmt.Sprintf("legacy-%d", n), func(b *testing.B) {
+			lookup(b, identifier, noise.Peer{Pattern: noise.PatternIK}, "")
+		})
+
+		// An unknown identifier tries the two advertisings of every client.
+		b.Run(fmt.Sprintf("unknown-%d", n), func(b *testing.B) {
+			for range b.N {
+				b.StopTimer()
+				derived, err := seikan.KDFGenerateTime("unknown", nil, time.Now())
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				if _, err := server.Lookup(s, derived, ""); err == nil {
+					b.Fatal("unknown client found")
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("key-%d", n), func(b *testing.B) {
+			lookup(b, identity.Public, noise.Peer{Pattern: noise.PatternIK, Lookup: true}, client.Public)
+		})
+	}
+}
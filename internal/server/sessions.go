@@ -0,0 +1,139 @@
+package server
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// A drainer is a session that can wait for its live streams to be done.
+type drainer interface {
+	Drain()
+}
+
+// sessions tracks the live sessions of the server in order to drain them during a restart
+// or to tear down the ones of a revoked client.
+type sessions struct {
+	mu       sync.Mutex
+	live     map[drainer]liveSession
+	conns    map[io.Closer]struct{}
+	draining bool
+	wg       sync.WaitGroup
+}
+
+// A liveSession is a live session of a client.
+type liveSession struct {
+	identifier string
+	c          io.Closer
+}
+
+func newSessions() *sessions {
+	return &sessions{
+		live:  map[drainer]liveSession{},
+		conns: map[io.Closer]struct{}{},
+	}
+}
+
+// add registers the given session of the given client running over c until the returned function is called.
+// Once drained, c is closed to end the session.
+// The session is drained right away when the server is already draining.
+func (ss *sessions) add(identifier string, d drainer, c io.Closer) func() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.live[d] = liveSession{identifier: identifier, c: c}
+	if ss.draining {
+		go closeDrained(d, c)
+	}
+
+	return func() {
+		ss.mu.Lock()
+		delete(ss.live, d)
+		ss.mu.Unlock()
+	}
+}
+
+// track registers a running handler of the connection c until the returned function is called.
+func (ss *sessions) track(c io.Closer) func() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.wg.Add(1)
+	ss.conns[c] = struct{}{}
+
+	return func() {
+		ss.mu.Lock()
+		delete(ss.conns, c)
+		ss.mu.Unlock()
+		ss.wg.Done()
+	}
+}
+
+// drain drains all the live sessions and the ones registered from now on.
+func (ss *sessions) drain() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.draining = true
+	for d, s := range ss.live {
+		go closeDrained(d, s.c)
+	}
+}
+
+// teardown closes right away the live sessions of the clients matching the given function.
+// It returns the number of closed sessions.
+func (ss *sessions) teardown(match func(identifier string) bool) int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var n int
+	for d, s := range ss.live {
+		if match(s.identifier) {
+			s.c.Close()
+			delete(ss.live, d)
+			n++
+		}
+	}
+	return n
+}
+
+// isDraining returns true when the server is draining its sessions.
+func (ss *sessions) isDraining() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.draining
+}
+
+// wait waits for all the tracked connection handlers to return.
+// Once the timeout is elapsed, the tracked connections and the live sessions are closed and false is returned.
+func (ss *sessions) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		ss.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+
+	ss.mu.Lock()
+	for c := range ss.conns {
+		c.Close()
+	}
+	for _, s := range ss.live {
+		s.c.Close()
+	}
+	ss.mu.Unlock()
+
+	<-done
+	return false
+}
+
+func closeDrained(d drainer, c io.Closer) {
+	d.Drain()
+	c.Close()
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/mdouchement/seikan/internal/ca"
+	"github.com/mdouchement/seikan/internal/control"
+	"github.com/mdouchement/seikan/internal/noise"
+	"github.com/mdouchement/seikan/internal/seikan"
+)
+
+// defaultTicketLifetime is the default validity of a resumption ticket and rotation interval of the ticket key.
+const defaultTicketLifetime = time.Hour
+
+// A ticket is the sealed content of a resumption ticket.
+type ticket struct {
+	Identifier string `cbor:"identifier"`
+	// Public is the static key of the client when the ticket was issued.
+	Public string `cbor:"public"`
+	// PSK is the pre-shared key of the resumption handshake.
+	PSK string `cbor:"psk"`
+	// Certificate is the certificate of a client identified by the CA.
+	Certificate *ca.Certificate `cbor:"certificate,omitempty"`
+}
+
+// issue returns a new resumption ticket of the given client for the request of the given id.
+func (s *server) issue(id, identifier, public string, cert *ca.Certificate) (*control.Ticket, error) {
+	t := ticket{
+		Identifier:  identifier,
+		Public:      public,
+		PSK:         noise.GeneratePSK(),
+		Certificate: cert,
+	}
+
+	payload, err := cbor.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, expiration, err := s.tickets.Seal(payload, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	notice := control.NewTicket(id)
+	notice.Ticket = sealed
+	notice.PSK = t.PSK
+	notice.NotAfter = expiration.Unix()
+	return notice, nil
+}
+
+// resume reads the ticket sent by a client resuming its session and returns its content.
+// The client must still be valid: registered with the same public key or holding a certificate, neither revoked nor expired.
+func (s *server) resume(r io.Reader, now time.Time) (ticket, error) {
+	sealed, err := seikan.ReadTicket(r)
+	if err != nil {
+		return ticket{}, fmt.Errorf("failed to read ticket: %w", err)
+	}
+
+	payload, err := s.tickets.Open(sealed, now)
+	if err != nil {
+		return ticket{}, err
+	}
+
+	var t ticket
+	if err = cbor.Unmarshal(payload, &t); err != nil {
+		return ticket{}, fmt.Errorf("ticket: %w", err)
+	}
+
+	client, registered := s.cfg.Clients[t.Identifier]
+	if t.Certificate != nil {
+		if registered || t.Certificate.Identifier != t.Identifier {
+			return ticket{}, fmt.Errorf("client %s: certificate for a registered client", t.Identifier)
+		}
+
+		if err = s.validate(t.Identifier, certifiedKey(*t.Certificate), now); err != nil {
+			return ticket{}, err
+		}
+
+		s.certified.Store(t.Identifier, *t.Certificate)
+		return t, nil
+	}
+
+	if !registered || noise.PublicKey(client.Public) != noise.PublicKey(t.Public) {
+		return ticket{}, errors.New("ticket of an unknown client")
+	}
+
+	if err = s.validate(t.Identifier, client, now); err != nil {
+		return ticket{}, err
+	}
+	return t, nil
+}
@@ -1,14 +1,17 @@
 package smux
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/yamux"
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/proxyproto"
 )
 
 // A Client allows bidirectional multiplexed streaming over an established tunnel.
@@ -17,15 +20,17 @@ type Client struct {
 	log      logger.Logger
 	listener *DropListener
 	rc       net.Conn
-	session  *yamux.Session
+	session  Session
 	ignore   []*regexp.Regexp
+	metadata bool
+
+	drained     chan struct{}
+	drainedOnce sync.Once
 }
 
 // NewClient returns a new Client.
 func NewClient(l logger.Logger, tun Tunnel, listener *DropListener, rc net.Conn) (*Client, error) {
-	cfg := yamux.DefaultConfig()
-	cfg.EnableKeepAlive = false
-	session, err := yamux.Client(snet.NopConnCloser(rc), cfg)
+	session, err := newSession(rc, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish session: %w", err)
 	}
@@ -36,6 +41,8 @@ func NewClient(l logger.Logger, tun Tunnel, listener *DropListener, rc net.Conn)
 		rc:       rc,
 		session:  session,
 		ignore:   tun.IgnoreErrors,
+		metadata: tun.ProxyProtocol > 0,
+		drained:  make(chan struct{}),
 	}
 	client.log.Infof("Session oppened %s", tun)
 
@@ -44,17 +51,32 @@ func NewClient(l logger.Logger, tun Tunnel, listener *DropListener, rc net.Conn)
 }
 
 // Establish establishes multiplexed streaming with the server.
+// It returns when the session is closed or drained by the server.
 func (cl *Client) Establish() error {
 	for {
 		select {
 		case <-cl.session.CloseChan():
 			cl.log.Info("Session closed")
 			return nil
+		case <-cl.drained:
+			// The server is restarting, live streams are kept until they are done.
+			cl.log.Info("Session drained by the server")
+			return nil
 		case c := <-cl.listener.Accept():
 			go func() {
+				stream, err := cl.session.Open()
+				if errors.Is(err, yamux.ErrRemoteGoAway) || errors.Is(err, yamux.ErrSessionShutdown) {
+					// The connection waits for the next session.
+					if !cl.listener.Requeue(c) {
+						c.Close()
+					}
+					if errors.Is(err, yamux.ErrRemoteGoAway) {
+						cl.drainedOnce.Do(func() { close(cl.drained) })
+					}
+					return
+				}
 				defer c.Close()
 
-				stream, err := cl.session.OpenStream()
 				if err != nil {
 					for _, re := range cl.ignore {
 						if re.MatchString(err.Error()) {
@@ -68,6 +90,15 @@ func (cl *Client) Establish() error {
 				}
 				defer stream.Close()
 
+				if cl.metadata {
+					// The original peer address is sent as a PROXY protocol v2 header.
+					err = snet.WriteProxyProtocol(stream, proxyproto.V2, c.RemoteAddr(), c.LocalAddr())
+					if err != nil {
+						cl.log.WithError(err).Warn("failed to send stream metadata")
+						return
+					}
+				}
+
 				pipe, err := snet.NewPipe(c, stream)
 				if err != nil {
 					for _, re := range cl.ignore {
@@ -108,8 +139,13 @@ func (cl *Client) Establish() error {
 }
 
 func (cl *Client) ping() {
+	session, ok := cl.session.(*yamux.Session)
+	if !ok {
+		return // Native multiplexers handle their own keep-alive.
+	}
+
 	for {
-		_, err := cl.session.Ping()
+		_, err := session.Ping()
 		if err != nil {
 			cl.session.Close()
 			return
@@ -118,7 +154,27 @@ func (cl *Client) ping() {
 	}
 }
 
-// Close implements io.Close.
+// Drain tells the peer to stop opening new streams and waits for the live streams to be done.
+func (cl *Client) Drain() {
+	cl.log.Info("Draining session")
+	drain(cl.session)
+}
+
+// Close implements io.Close. It also closes the given conn to NewClient.
+// When the session is drained by the server, the live streams are kept until they are done.
 func (cl *Client) Close() {
-	cl.session.Close() // Closes also the given conn to Yamux. Use snet.NopConnCloser to avoid it.
+	select {
+	case <-cl.drained:
+		go func() {
+			drain(cl.session)
+			cl.close()
+		}()
+	default:
+		cl.close()
+	}
+}
+
+func (cl *Client) close() {
+	cl.rc.Close() // Unblocks the session's reader.
+	cl.session.Close()
 }
@@ -1,6 +1,7 @@
 package smux
 
 import (
+	"errors"
 	"net"
 
 	"github.com/mdouchement/logger"
@@ -37,9 +38,23 @@ func (l *DropListener) Address() string {
 	return l.address
 }
 
+// Requeue gives back a connection that could not be handled by the current session.
+// It returns false if the connection cannot wait for the next session.
+func (l *DropListener) Requeue(conn net.Conn) bool {
+	select {
+	case l.connCh <- conn:
+		return true
+	default:
+		return false
+	}
+}
+
 func (l *DropListener) serve() {
 	for {
 		conn, err := l.Listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
 		if err != nil {
 			l.log.WithError(err).Warnf("failed to listening on %q: %s", l.Listener.Addr(), err)
 			continue
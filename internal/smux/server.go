@@ -1,6 +1,7 @@
 package smux
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -9,6 +10,7 @@ import (
 	"github.com/hashicorp/yamux"
 	"github.com/mdouchement/logger"
 	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/proxyproto"
 )
 
 // A Server allows bidirectional multiplexed streaming over an established tunnel.
@@ -17,7 +19,7 @@ type Server struct {
 	rc      net.Conn
 	tun     Tunnel
 	log     logger.Logger
-	session *yamux.Session
+	session Session
 	ignore  []*regexp.Regexp
 }
 
@@ -25,9 +27,7 @@ type Server struct {
 func NewServer(l logger.Logger, tun Tunnel, rc net.Conn) (*Server, error) {
 	l = l.WithPrefixf("[smux][%s]", tun.Destination)
 
-	cfg := yamux.DefaultConfig()
-	cfg.EnableKeepAlive = false
-	session, err := yamux.Server(snet.NopConnCloser(rc), cfg)
+	session, err := newSession(rc, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to establish session: %w", err)
 	}
@@ -47,7 +47,7 @@ func (s *Server) Listen() error {
 	for {
 		sc, err := s.session.Accept()
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || errors.Is(err, yamux.ErrSessionShutdown) || errors.Is(err, net.ErrClosed) {
 				s.log.Info("session closed")
 				return nil
 			}
@@ -57,7 +57,7 @@ func (s *Server) Listen() error {
 		go func() {
 			defer sc.Close()
 
-			pipe, err := snet.NewPipeTCP(sc, s.tun.Destination) // TODO: allow UDP too
+			pipe, err := s.pipe(sc)
 			if err != nil {
 				for _, re := range s.ignore {
 					if re.MatchString(err.Error()) {
@@ -95,6 +95,51 @@ func (s *Server) Listen() error {
 	}
 }
 
+// pipe connects the stream sc to the destination.
+// When the PROXY protocol is enabled, the client address observed by the server is forwarded in its header.
+// The original peer address received as stream metadata is forwarded instead when its source is trusted.
+func (s *Server) pipe(sc net.Conn) (*snet.Pipe, error) {
+	if s.tun.ProxyProtocol == 0 {
+		return snet.NewPipeEndpoint(sc, s.tun.Destination) // TODO: allow UDP too
+	}
+
+	src, dst := s.tun.Peer, s.tun.Local
+	if s.tun.Metadata {
+		var h *proxyproto.Header
+		var err error
+
+		sc, h, err = snet.ReadProxyProtocol(sc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stream metadata: %w", err)
+		}
+		if h == nil {
+			return nil, errors.New("missing stream metadata")
+		}
+
+		if s.tun.Trusted || snet.Trusted(h.Source, s.tun.Sources) {
+			src, dst = h.Source, h.Destination
+		}
+	}
+
+	rc, err := snet.DialEndpoint(s.tun.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote: %w", err)
+	}
+
+	if err = snet.WriteProxyProtocol(rc, s.tun.ProxyProtocol, src, dst); err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to send PROXY protocol header: %w", err)
+	}
+
+	return snet.NewPipe(sc, rc)
+}
+
+// Drain tells the peer to stop opening new streams and waits for the live streams to be done.
+func (s *Server) Drain() {
+	s.log.Info("Draining session")
+	drain(s.session)
+}
+
 // Close implements io.Close.
 func (s *Server) Close() {
 	s.session.Close() // Closes also the given conn to Yamux. Use snet.NopConnCloser to avoid it.
@@ -0,0 +1,136 @@
+package smux
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/yamux"
+	"github.com/mdouchement/seikan/internal/snet"
+)
+
+// A Session multiplexes streams over an established tunnel.
+// It is implemented by *yamux.Session.
+type Session interface {
+	Open() (net.Conn, error)
+	Accept() (net.Conn, error)
+	// GoAway tells the peer to stop opening new streams.
+	GoAway() error
+	NumStreams() int
+	CloseChan() <-chan struct{}
+	Close() error
+}
+
+// newSession returns a Session over rc.
+// Transports with native stream multiplexing are used as is, otherwise Yamux is used.
+// Closing the session does not close rc.
+func newSession(rc net.Conn, server bool) (Session, error) {
+	if m, ok := snet.AsMultiplexer(rc); ok {
+		s := &nativeSession{m: m}
+		if !server {
+			go s.watch() // The client side only opens streams, the GoAway of the peer is accepted as a stream.
+		}
+		return s, nil
+	}
+
+	cfg := yamux.DefaultConfig()
+	cfg.EnableKeepAlive = false
+
+	if server {
+		return yamux.Server(snet.NopConnCloser(rc), cfg)
+	}
+	return yamux.Client(snet.NopConnCloser(rc), cfg)
+}
+
+// A nativeSession is a Session over a native multiplexer, it counts its live streams.
+type nativeSession struct {
+	m       snet.Multiplexer
+	streams atomic.Int64
+	goaway  atomic.Bool
+}
+
+func (s *nativeSession) Open() (net.Conn, error) {
+	if s.goaway.Load() {
+		return nil, yamux.ErrRemoteGoAway
+	}
+
+	c, err := s.m.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return s.track(c), nil
+}
+
+func (s *nativeSession) Accept() (net.Conn, error) {
+	for {
+		c, err := s.m.AcceptStream()
+		if errors.Is(err, snet.ErrGoAway) {
+			s.goaway.Store(true)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s.track(c), nil
+	}
+}
+
+func (s *nativeSession) GoAway() error {
+	return s.m.GoAway()
+}
+
+func (s *nativeSession) NumStreams() int {
+	return int(s.streams.Load())
+}
+
+func (s *nativeSession) CloseChan() <-chan struct{} {
+	return s.m.CloseChan()
+}
+
+func (s *nativeSession) Close() error {
+	return nil // The session lives as long as the underlying connection.
+}
+
+// track counts the given stream until it is closed.
+func (s *nativeSession) track(c net.Conn) net.Conn {
+	s.streams.Add(1)
+
+	var once sync.Once
+	return snet.CustomConnCloser(c, func() error {
+		once.Do(func() { s.streams.Add(-1) })
+		return c.Close()
+	})
+}
+
+// watch accepts the streams opened by the peer until the session is closed, only its GoAway is expected.
+func (s *nativeSession) watch() {
+	for {
+		c, err := s.Accept()
+		if err != nil {
+			return
+		}
+		c.Close()
+	}
+}
+
+// drainPeriod is the interval between checks of the live streams of a draining session.
+const drainPeriod = 100 * time.Millisecond
+
+// drain tells the peer to stop opening streams and waits for the live streams to be done.
+// The session is not closed, closing the underlying connection ends it.
+func drain(session Session) {
+	session.GoAway()
+
+	ticker := time.NewTicker(drainPeriod)
+	defer ticker.Stop()
+
+	for session.NumStreams() > 0 {
+		select {
+		case <-session.CloseChan():
+			return
+		case <-ticker.C:
+		}
+	}
+}
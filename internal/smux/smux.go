@@ -2,6 +2,7 @@ package smux
 
 import (
 	"fmt"
+	"net"
 	"regexp"
 )
 
@@ -11,6 +12,18 @@ type Tunnel struct {
 	Remote       string
 	Destination  string
 	IgnoreErrors []*regexp.Regexp
+	// ProxyProtocol is the PROXY protocol version (1 or 2) sent to the destination, 0 to disable it.
+	// Client side, when enabled, each stream starts with the original peer address as metadata.
+	ProxyProtocol int
+	// Metadata tells the server that each stream starts with the original peer address sent by the client.
+	Metadata bool
+	// Peer and Local are the addresses of the client connection observed by the server,
+	// sent to the destination instead of the metadata whose source does not belong to Sources.
+	Peer    net.Addr
+	Local   net.Addr
+	Sources []*net.IPNet
+	// Trusted tells the server that the metadata is always forwarded, e.g. when it is sent by the seikan server.
+	Trusted bool
 }
 
 func (t Tunnel) String() string {
@@ -0,0 +1,78 @@
+package smux_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/logger"
+	"github.com/mdouchement/seikan/internal/smux"
+	"github.com/mdouchement/seikan/pkg/proxyproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyProtocol_Inbound(t *testing.T) {
+	for _, version := range []int{proxyproto.V1, proxyproto.V2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			destination, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer destination.Close()
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer l.Close()
+
+			server, client := net.Pipe()
+
+			// Server side, the outbound listener sends the original peer address as stream metadata.
+			outbound, err := smux.NewClient(logger.NewNullLogger(), smux.Tunnel{
+				Source:        l.Addr().String(),
+				Destination:   destination.Addr().String(),
+				ProxyProtocol: version,
+			}, smux.NewDropListener(logger.NewNullLogger(), l.Addr().String(), l), server)
+			assert.NoError(t, err)
+			defer outbound.Close()
+			go outbound.Establish()
+
+			// Client side, the inbound forwards the metadata sent by the server.
+			inbound, err := smux.NewServer(logger.NewNullLogger(), smux.Tunnel{
+				Destination:   destination.Addr().String(),
+				ProxyProtocol: version,
+				Metadata:      true,
+				Trusted:       true,
+			}, client)
+			assert.NoError(t, err)
+			defer inbound.Close()
+			defer client.Close() // Unblocks the session's reader.
+			go inbound.Listen()
+
+			peer, err := net.Dial("tcp", l.Addr().String())
+			assert.NoError(t, err)
+			defer peer.Close()
+
+			_, err = io.WriteString(peer, "payload")
+			assert.NoError(t, err)
+
+			c, err := destination.Accept()
+			assert.NoError(t, err)
+			defer c.Close()
+			c.SetDeadline(time.Now().Add(5 * time.Second))
+
+			r := bufio.NewReader(c)
+			h, err := proxyproto.Read(r)
+			assert.NoError(t, err)
+			if assert.NotNil(t, h) {
+				assert.Equal(t, peer.LocalAddr().String(), h.Source.String())
+				assert.Equal(t, peer.RemoteAddr().String(), h.Destination.String())
+			}
+
+			p := make([]byte, len("payload"))
+			_, err = io.ReadFull(r, p)
+			assert.NoError(t, err)
+			assert.Equal(t, "payload", string(p))
+		})
+	}
+}
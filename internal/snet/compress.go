@@ -49,6 +49,16 @@ func (c *CompressConn) Write(p []byte) (n int, err error) {
 	return c.w.Write(p)
 }
 
+// NetConn returns the underlying connection.
+func (c *CompressConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Compression returns the compression of the connection, the zero value.
+func (c *CompressConn) Compression() Compression {
+	return Compression{}
+}
+
 // Close implements io.Close.
 func (c *CompressConn) Close() error {
 	c.r.Close()
@@ -0,0 +1,471 @@
+package snet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// Compression algorithms negotiated by the peers.
+const (
+	CompressionNone = "none"
+	CompressionZstd = "zstd"
+	CompressionLZ4  = "lz4"
+	CompressionS2   = "s2"
+)
+
+// maxLevels are the maximum levels of the compression algorithms, zero selects the default level.
+var maxLevels = map[string]int{
+	CompressionNone: 0,
+	CompressionZstd: 22,
+	CompressionLZ4:  9,
+	CompressionS2:   3,
+}
+
+// A Compression is the compression of a session negotiated by the peers.
+// The zero value is the zstd stream used by the previous versions.
+type Compression struct {
+	Algorithm string
+	Level     int
+	// Adaptive stops compressing while the measured ratio stays poor.
+	Adaptive bool
+}
+
+// ParseCompression returns the compression of the given `algorithm[:level][+adaptive]' form (e.g. `zstd:3+adaptive').
+// An empty form selects the zstd stream of the previous versions.
+func ParseCompression(s string) (Compression, error) {
+	var compression Compression
+	if s == "" {
+		return compression, nil
+	}
+
+	s, compression.Adaptive = strings.CutSuffix(s, "+adaptive")
+	algorithm, level, leveled := strings.Cut(s, ":")
+
+	max, ok := maxLevels[algorithm]
+	if !ok {
+		return compression, fmt.Errorf("unsupported compression %s", algorithm)
+	}
+	compression.Algorithm = algorithm
+
+	if leveled {
+		l, err := strconv.Atoi(level)
+		if err != nil || l < 1 || l > max {
+			return compression, fmt.Errorf("unsupported %s compression level %s", algorithm, level)
+		}
+		compression.Level = l
+	}
+
+	if compression.Adaptive && algorithm == CompressionNone {
+		return compression, errors.New("adaptive compression requires a compression algorithm")
+	}
+
+	return compression, nil
+}
+
+// String returns the `algorithm[:level][+adaptive]' form of the compression.
+func (c Compression) String() string {
+	s := c.Algorithm
+	if c.Level > 0 {
+		s += ":" + strconv.Itoa(c.Level)
+	}
+	if c.Adaptive {
+		s += "+adaptive"
+	}
+	return s
+}
+
+// CompressWith returns c compressed with the given compression.
+// Except for the zero value (see Compress), the written data are split in blocks compressed independently,
+// a block is sent uncompressed when it does not shrink.
+// The returned net.Conn does not close c.
+func CompressWith(c net.Conn, compression Compression) (net.Conn, error) {
+	switch compression.Algorithm {
+	case "":
+		return Compress(c)
+	case CompressionNone:
+		return NopConnCloser(c), nil
+	}
+
+	codec, err := newCodec(compression)
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &BlockConn{
+		Conn:        c,
+		r:           bufio.NewReader(c),
+		codec:       codec,
+		compression: compression,
+	}
+	if compression.Adaptive {
+		bc.adaptive = &adaptive{backoff: adaptiveBackoff}
+	}
+
+	return bc, nil
+}
+
+// Block framing constants.
+const (
+	// maxBlockSize is the maximum uncompressed size of a block.
+	maxBlockSize = 64 << 10
+	// minBlockSize is the size under which a block is not worth compressing.
+	minBlockSize = 64
+
+	blockRaw        byte = 0x00
+	blockCompressed byte = 0x01
+)
+
+// A BlockConn compresses the blocks of data written on a net Conn.
+// A block is framed as a type byte, the uvarint size of the uncompressed data,
+// the uvarint size of the compressed data (compressed blocks only) and the data.
+// It does not close its given net.Conn.
+type BlockConn struct {
+	net.Conn
+	r           *bufio.Reader
+	codec       codec
+	compression Compression
+	adaptive    *adaptive // nil when disabled
+
+	pending []byte // Decompressed data not read yet
+	rbuf    []byte
+	dbuf    []byte
+	wbuf    []byte
+}
+
+func (c *BlockConn) Read(p []byte) (n int, err error) {
+	if len(c.pending) == 0 {
+		if err = c.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n = copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// next reads the next block.
+func (c *BlockConn) next() error {
+	kind, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	size, err := binary.ReadUvarint(c.r)
+	if err != nil {
+		return unexpected(err)
+	}
+	if size == 0 || size > maxBlockSize {
+		return fmt.Errorf("compression: invalid block size %d", size)
+	}
+
+	switch kind {
+	case blockRaw:
+		c.rbuf = grow(c.rbuf, int(size))
+		if _, err = io.ReadFull(c.r, c.rbuf); err != nil {
+			return unexpected(err)
+		}
+		c.pending = c.rbuf
+	case blockCompressed:
+		compressed, err := binary.ReadUvarint(c.r)
+		if err != nil {
+			return unexpected(err)
+		}
+		if compressed == 0 || compressed >= size {
+			return fmt.Errorf("compression: invalid compressed block size %d", compressed)
+		}
+
+		c.rbuf = grow(c.rbuf, int(compressed))
+		if _, err = io.ReadFull(c.r, c.rbuf); err != nil {
+			return unexpected(err)
+		}
+
+		c.dbuf = grow(c.dbuf, int(size))
+		if err = c.codec.decompress(c.dbuf, c.rbuf); err != nil {
+			return fmt.Errorf("compression: %w", err)
+		}
+		c.pending = c.dbuf
+	default:
+		return fmt.Errorf("compression: invalid block type %d", kind)
+	}
+
+	return nil
+}
+
+func (c *BlockConn) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		block := p[:min(len(p), maxBlockSize)]
+
+		if err = c.write(block); err != nil {
+			return n, err
+		}
+
+		n += len(block)
+		p = p[len(block):]
+	}
+
+	return n, nil
+}
+
+// write sends the given block, compressed when it shrinks.
+func (c *BlockConn) write(block []byte) error {
+	if len(block) >= minBlockSize && c.adaptive.enabled(len(block)) {
+		compressed := c.codec.compress(block)
+		c.adaptive.measure(len(block), len(compressed))
+
+		if compressed != nil {
+			c.wbuf = append(c.wbuf[:0], blockCompressed)
+			c.wbuf = binary.AppendUvarint(c.wbuf, uint64(len(block)))
+			c.wbuf = binary.AppendUvarint(c.wbuf, uint64(len(compressed)))
+			c.wbuf = append(c.wbuf, compressed...)
+
+			_, err := c.Conn.Write(c.wbuf)
+			return err
+		}
+	}
+
+	c.wbuf = append(c.wbuf[:0], blockRaw)
+	c.wbuf = binary.AppendUvarint(c.wbuf, uint64(len(block)))
+	c.wbuf = append(c.wbuf, block...)
+
+	_, err := c.Conn.Write(c.wbuf)
+	return err
+}
+
+// NetConn returns the underlying connection.
+func (c *BlockConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Compression returns the compression of the connection.
+func (c *BlockConn) Compression() Compression {
+	return c.compression
+}
+
+// Close implements io.Close.
+func (c *BlockConn) Close() error {
+	return nil // The codecs do not hold any goroutine
+}
+
+func grow(p []byte, n int) []byte {
+	if cap(p) < n {
+		return make([]byte, n)
+	}
+	return p[:n]
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+//
+// Codecs
+//
+
+// A codec compresses and decompresses independent blocks.
+type codec interface {
+	// compress returns the compressed src, valid until the next call, or nil when src does not shrink.
+	compress(src []byte) []byte
+	// decompress fills dst with the decompressed src.
+	decompress(dst, src []byte) error
+}
+
+func newCodec(compression Compression) (codec, error) {
+	switch compression.Algorithm {
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if compression.Level > 0 {
+			level = zstd.EncoderLevelFromZstd(compression.Level)
+		}
+
+		w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(maxBlockSize))
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true), zstd.WithDecoderMaxMemory(maxBlockSize))
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+
+		return &zstdCodec{w: w, r: r}, nil
+	case CompressionLZ4:
+		if compression.Level > 0 {
+			return &lz4Codec{hc: &lz4.CompressorHC{Level: lz4.CompressionLevel(1 << (8 + compression.Level))}}, nil
+		}
+		return &lz4Codec{fast: &lz4.Compressor{}}, nil
+	case CompressionS2:
+		encode := s2.Encode
+		switch {
+		case compression.Level == 2:
+			encode = s2.EncodeBetter
+		case compression.Level >= 3:
+			encode = s2.EncodeBest
+		}
+		return &s2Codec{encode: encode}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", compression.Algorithm)
+	}
+}
+
+type zstdCodec struct {
+	w   *zstd.Encoder
+	r   *zstd.Decoder
+	buf []byte
+}
+
+func (c *zstdCodec) compress(src []byte) []byte {
+	c.buf = c.w.EncodeAll(src, c.buf[:0])
+	if len(c.buf) >= len(src) {
+		return nil
+	}
+	return c.buf
+}
+
+func (c *zstdCodec) decompress(dst, src []byte) error {
+	p, err := c.r.DecodeAll(src, dst[:0])
+	if err != nil {
+		return err
+	}
+	if len(p) != len(dst) {
+		return errors.New("invalid decompressed size")
+	}
+	return nil
+}
+
+type lz4Codec struct {
+	fast *lz4.Compressor
+	hc   *lz4.CompressorHC
+	buf  []byte
+}
+
+func (c *lz4Codec) compress(src []byte) []byte {
+	// A destination smaller than src stops the compression of a block that does not shrink.
+	c.buf = grow(c.buf, len(src)-1)
+
+	var n int
+	var err error
+	if c.hc != nil {
+		n, err = c.hc.CompressBlock(src, c.buf)
+	} else {
+		n, err = c.fast.CompressBlock(src, c.buf)
+	}
+	if err != nil || n == 0 {
+		return nil
+	}
+	return c.buf[:n]
+}
+
+func (c *lz4Codec) decompress(dst, src []byte) error {
+	n, err := lz4.UncompressBlock(src, dst)
+	if err != nil {
+		return err
+	}
+	if n != len(dst) {
+		return errors.New("invalid decompressed size")
+	}
+	return nil
+}
+
+type s2Codec struct {
+	encode func(dst, src []byte) []byte
+	buf    []byte
+}
+
+func (c *s2Codec) compress(src []byte) []byte {
+	c.buf = grow(c.buf, s2.MaxEncodedLen(len(src)))
+	compressed := c.encode(c.buf, src)
+	if len(compressed) >= len(src) {
+		return nil
+	}
+	return compressed
+}
+
+func (c *s2Codec) decompress(dst, src []byte) error {
+	n, err := s2.DecodedLen(src)
+	if err != nil {
+		return err
+	}
+	if n != len(dst) {
+		return errors.New("invalid decompressed size")
+	}
+
+	_, err = s2.Decode(dst, src)
+	return err
+}
+
+//
+// Adaptive
+//
+
+// Adaptive compression constants.
+const (
+	// adaptiveWindow is the amount of compressed data of a ratio measure.
+	adaptiveWindow = 256 << 10
+	// adaptiveRatio is the compression ratio over which the compression is poor.
+	adaptiveRatio = 0.9
+	// adaptiveBackoff is the amount of data sent uncompressed after a first poor measure,
+	// it doubles for each consecutive poor measure up to maxAdaptiveBackoff.
+	adaptiveBackoff    = 1 << 20
+	maxAdaptiveBackoff = 64 << 20
+)
+
+// An adaptive stops the compression while the measured ratio stays poor.
+// The compression is probed again for a window once the backoff is sent.
+type adaptive struct {
+	in, out int // Sizes of the measured blocks
+	skip    int // Remaining size sent uncompressed
+	backoff int
+}
+
+// enabled returns true when the block of the given size must be compressed.
+func (a *adaptive) enabled(size int) bool {
+	if a == nil {
+		return true
+	}
+
+	if a.skip > 0 {
+		a.skip -= size
+		return false
+	}
+	return true
+}
+
+// measure records the sizes of a block before and after its compression, out is zero when it does not shrink.
+func (a *adaptive) measure(in, out int) {
+	if a == nil {
+		return
+	}
+
+	if out == 0 {
+		out = in
+	}
+	a.in += in
+	a.out += out
+
+	if a.in < adaptiveWindow {
+		return
+	}
+
+	if float64(a.out) > adaptiveRatio*float64(a.in) {
+		a.skip = a.backoff
+		a.backoff = min(2*a.backoff, maxAdaptiveBackoff)
+	} else {
+		a.backoff = adaptiveBackoff
+	}
+	a.in, a.out = 0, 0
+}
@@ -0,0 +1,144 @@
+package snet_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCompression(t *testing.T) {
+	for _, tc := range []struct {
+		form     string
+		expected snet.Compression
+		err      string
+	}{
+		{form: "", expected: snet.Compression{}},
+		{form: "none", expected: snet.Compression{Algorithm: snet.CompressionNone}},
+		{form: "zstd", expected: snet.Compression{Algorithm: snet.CompressionZstd}},
+		{form: "zstd:19+adaptive", expected: snet.Compression{Algorithm: snet.CompressionZstd, Level: 19, Adaptive: true}},
+		{form: "lz4:9", expected: snet.Compression{Algorithm: snet.CompressionLZ4, Level: 9}},
+		{form: "s2+adaptive", expected: snet.Compression{Algorithm: snet.CompressionS2, Adaptive: true}},
+		{form: "gzip", err: "unsupported compression gzip"},
+		{form: "lz4:10", err: "unsupported lz4 compression level 10"},
+		{form: "zstd:fast", err: "unsupported zstd compression level fast"},
+		{form: "none:1", err: "unsupported none compression level 1"},
+		{form: "none+adaptive", err: "adaptive compression requires a compression algorithm"},
+	} {
+		compression, err := snet.ParseCompression(tc.form)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, tc.form)
+			continue
+		}
+
+		assert.NoError(t, err, tc.form)
+		assert.Equal(t, tc.expected, compression, tc.form)
+		assert.Equal(t, tc.form, compression.String())
+	}
+}
+
+func TestCompressWith(t *testing.T) {
+	random := make([]byte, 100<<10)
+	rand.Read(random)
+
+	text := bytes.Repeat([]byte("seikan tunnels TCP over encrypted sessions. "), 4<<10)
+	payload := append(append([]byte("hello"), random...), text...)
+
+	for _, form := range []string{"none", "zstd", "zstd:19", "lz4", "lz4:9", "s2", "s2:3", "zstd+adaptive"} {
+		compression, err := snet.ParseCompression(form)
+		assert.NoError(t, err)
+
+		c1, c2 := net.Pipe()
+		counter := &counterConn{Conn: c1}
+
+		w, err := snet.CompressWith(counter, compression)
+		assert.NoError(t, err)
+		r, err := snet.CompressWith(c2, compression)
+		assert.NoError(t, err)
+
+		go func() {
+			w.Write(payload[:5])
+			w.Write(payload[5:])
+			w.Close()
+			c1.Close()
+		}()
+
+		p, err := io.ReadAll(r)
+		assert.NoError(t, err, form)
+		assert.Equal(t, payload, p, form)
+
+		if form == "none" {
+			assert.EqualValues(t, len(payload), counter.n.Load(), form)
+		} else {
+			assert.Less(t, counter.n.Load(), int64(len(random)+len(text)/2), form)
+		}
+
+		r.Close()
+		c2.Close()
+	}
+}
+
+func TestCompressWith_Adaptive(t *testing.T) {
+	random := make([]byte, 512<<10)
+	rand.Read(random)
+	zeros := make([]byte, 64<<10)
+
+	for _, adaptive := range []bool{false, true} {
+		c1, c2 := net.Pipe()
+		counter := &counterConn{Conn: c1}
+
+		w, err := snet.CompressWith(counter, snet.Compression{Algorithm: snet.CompressionLZ4, Adaptive: adaptive})
+		assert.NoError(t, err)
+		r, err := snet.CompressWith(c2, snet.Compression{Algorithm: snet.CompressionLZ4})
+		assert.NoError(t, err)
+
+		go io.Copy(io.Discard, r)
+
+		_, err = w.Write(random)
+		assert.NoError(t, err)
+
+		sent := counter.n.Load()
+		_, err = w.Write(zeros)
+		assert.NoError(t, err)
+
+		if adaptive {
+			// The compression is stopped after a poor ratio.
+			assert.Greater(t, counter.n.Load()-sent, int64(len(zeros)))
+		} else {
+			assert.Less(t, counter.n.Load()-sent, int64(len(zeros)/10))
+		}
+
+		c1.Close()
+		c2.Close()
+	}
+}
+
+func TestCompressWith_InvalidBlock(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	r, err := snet.CompressWith(c2, snet.Compression{Algorithm: snet.CompressionS2})
+	assert.NoError(t, err)
+
+	go c1.Write([]byte{0x01, 0x10, 0x20})
+
+	_, err = r.Read(make([]byte, 16))
+	assert.EqualError(t, err, "compression: invalid compressed block size 32")
+}
+
+type counterConn struct {
+	net.Conn
+	n atomic.Int64
+}
+
+func (c *counterConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -28,6 +28,10 @@ type conncloser struct {
 	close func() error
 }
 
+func (c *conncloser) NetConn() net.Conn {
+	return c.Conn
+}
+
 func (c *conncloser) Close() error {
 	return c.close()
 }
@@ -1,52 +1,63 @@
 package snet
 
 import (
-	"errors"
 	"net"
-	"net/url"
 
-	mnet "github.com/mendsley/gomnet"
+	"github.com/mdouchement/seikan/pkg/transport"
 )
 
 // EnableKeepAlive enables keep alive if the connection allows it.
 func EnableKeepAlive(c net.Conn) {
-	if tcpc, ok := c.(*net.TCPConn); ok {
-		tcpc.SetKeepAlive(true)
+	for c != nil {
+		if tcpc, ok := c.(*net.TCPConn); ok {
+			tcpc.SetKeepAlive(true)
+			return
+		}
+
+		u, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return
+		}
+		c = u.NetConn()
 	}
 }
 
-// Listen announces on the local network address.
+// Listen announces on the local network address using the transport registered for its scheme.
 func Listen(netaddr string) (net.Listener, error) {
-	url, err := url.Parse(netaddr)
+	t, u, err := transport.Resolve(netaddr)
 	if err != nil {
 		return nil, err
 	}
 
-	switch url.Scheme {
-	case "tcp", "tcp4", "tcp6":
-		return net.Listen(url.Scheme, url.Host)
-	case "mnet":
-		// Experitmental support of reliable-ordered transport over udp.
-		return mnet.Listen("udp", url.Host)
+	return t.Listen(u)
+}
+
+// Dial connects to the address using the transport registered for its scheme.
+func Dial(netaddr string) (net.Conn, error) {
+	t, u, err := transport.Resolve(netaddr)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("unsupported protocol scheme")
+	return t.Dial(u, nil)
 }
 
-// Dial connects to the address on the named network.
-func Dial(netaddr string) (net.Conn, error) {
-	url, err := url.Parse(netaddr)
+// DialThrough connects to the address on the named network through the given upstream proxy.
+// An empty proxyURL is the same as Dial. Only TCP based transports can be proxied.
+func DialThrough(netaddr, proxyURL string) (net.Conn, error) {
+	if proxyURL == "" {
+		return Dial(netaddr)
+	}
+
+	t, u, err := transport.Resolve(netaddr)
 	if err != nil {
 		return nil, err
 	}
 
-	switch url.Scheme {
-	case "tcp", "tcp4", "tcp6":
-		return net.Dial(url.Scheme, url.Host)
-	case "mnet":
-		// Experitmental support of reliable-ordered transport over udp.
-		return mnet.Dial("udp", url.Host)
+	dialer, err := NewProxyDialer(proxyURL)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("unsupported protocol scheme")
+	return t.Dial(u, dialer)
 }
@@ -30,6 +30,10 @@ func (d *dumper) Write(p []byte) (n int, err error) {
 	return d.Conn.Write(p)
 }
 
+func (d *dumper) NetConn() net.Conn {
+	return d.Conn
+}
+
 func (d *dumper) Close() error {
 	return d.Conn.Close()
 }
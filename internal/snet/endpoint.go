@@ -0,0 +1,46 @@
+package snet
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// IsUnixEndpoint returns true if the tunnel endpoint address is a Unix domain socket.
+func IsUnixEndpoint(address string) bool {
+	return strings.HasPrefix(address, "unix://")
+}
+
+// ListenEndpoint announces on a tunnel endpoint address (outbound source).
+// It accepts `host:port' for TCP and `unix:///path' for Unix domain sockets (see ListenUnix for options).
+func ListenEndpoint(address string) (net.Listener, error) {
+	if IsUnixEndpoint(address) {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		return ListenUnix(u)
+	}
+
+	return listenStream("tcp", address, nil)
+}
+
+// DialEndpoint connects to a tunnel endpoint address (outbound destination).
+// It accepts `host:port' for TCP and `unix:///path' for Unix domain sockets.
+func DialEndpoint(address string) (net.Conn, error) {
+	if IsUnixEndpoint(address) {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		return DialUnix(u)
+	}
+
+	c, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	EnableKeepAlive(c)
+
+	return c, nil
+}
@@ -0,0 +1,228 @@
+package snet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/mdouchement/seikan/pkg/transport"
+)
+
+// Environment variables used to pass listeners to a process.
+const (
+	// EnvListenFDs is the number of listeners inherited from a parent seikan process.
+	EnvListenFDs = "SEIKAN_LISTEN_FDS"
+
+	envSystemdFDs = "LISTEN_FDS"
+	envSystemdPID = "LISTEN_PID"
+	envSystemdFDN = "LISTEN_FDNAMES"
+)
+
+// listenFDsStart is the first inherited file descriptor.
+const listenFDsStart = 3
+
+var listeners = struct {
+	mu        sync.Mutex
+	inherited map[string]net.Listener
+	active    map[*trackedListener]struct{}
+}{
+	inherited: map[string]net.Listener{},
+	active:    map[*trackedListener]struct{}{},
+}
+
+// InheritListeners loads the listeners passed by systemd socket activation (LISTEN_FDS)
+// or by a parent seikan process during a restart (SEIKAN_LISTEN_FDS).
+// Inherited listeners are used instead of new sockets by the TCP based and Unix domain socket transports
+// listening on the same address. It returns the number of inherited listeners.
+func InheritListeners() (int, error) {
+	n, err := listenFDs()
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	listeners.mu.Lock()
+	defer listeners.mu.Unlock()
+
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "listener-"+strconv.Itoa(fd))
+		l, err := net.FileListener(f) // Duplicates the file descriptor
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("inherited file descriptor %d: %w", fd, err)
+		}
+
+		listeners.inherited[addrKey(l.Addr())] = l
+	}
+
+	return n, nil
+}
+
+// CloseUnusedListeners closes the inherited listeners not used by any transport.
+func CloseUnusedListeners() {
+	listeners.mu.Lock()
+	defer listeners.mu.Unlock()
+
+	for key, l := range listeners.inherited {
+		l.Close()
+		delete(listeners.inherited, key)
+	}
+}
+
+// ListenerFiles returns a duplicate of the file descriptors of the opened listeners, to be passed to a new process.
+// The listeners are left unchanged until HandOverListeners is called.
+func ListenerFiles() ([]*os.File, error) {
+	listeners.mu.Lock()
+	defer listeners.mu.Unlock()
+
+	var files []*os.File
+	for tl := range listeners.active {
+		l, ok := tl.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+
+		f, err := l.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, fmt.Errorf("listener %s: %w", tl.Addr(), err)
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// HandOverListeners is called once a new process is ready with the listeners returned by ListenerFiles.
+// From now on, closing a Unix domain socket listener does not remove its socket file used by the new process.
+func HandOverListeners() {
+	listeners.mu.Lock()
+	defer listeners.mu.Unlock()
+
+	for tl := range listeners.active {
+		if ul, ok := tl.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// Inheritable returns false when the listener of the given address cannot be handed over to a new process,
+// that is the case of the UDP based transports.
+func Inheritable(netaddr string) bool {
+	t, _, err := transport.Resolve(netaddr)
+	if err != nil {
+		return false
+	}
+
+	switch t.(type) {
+	case quicTransport, rudpTransport:
+		return false
+	}
+	return true
+}
+
+// listenStream announces on the local stream network address, using an inherited listener when available.
+// The optional prepare function is called before creating a new socket.
+func listenStream(network, address string, prepare func() error) (l net.Listener, err error) {
+	key, err := listenKey(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	listeners.mu.Lock()
+	l, inherited := listeners.inherited[key]
+	delete(listeners.inherited, key)
+	listeners.mu.Unlock()
+
+	if !inherited {
+		if prepare != nil {
+			if err = prepare(); err != nil {
+				return nil, err
+			}
+		}
+
+		l, err = net.Listen(network, address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tl := &trackedListener{Listener: l}
+
+	listeners.mu.Lock()
+	listeners.active[tl] = struct{}{}
+	listeners.mu.Unlock()
+
+	return tl, nil
+}
+
+// listenFDs returns the number of listeners passed to the process.
+func listenFDs() (int, error) {
+	if v := os.Getenv(EnvListenFDs); v != "" {
+		os.Unsetenv(EnvListenFDs)
+		return strconv.Atoi(v)
+	}
+
+	v := os.Getenv(envSystemdFDs)
+	if v == "" {
+		return 0, nil
+	}
+
+	pid, err := strconv.Atoi(os.Getenv(envSystemdPID))
+	if err != nil || pid != os.Getpid() {
+		return 0, nil // Not for us
+	}
+
+	os.Unsetenv(envSystemdFDs)
+	os.Unsetenv(envSystemdPID)
+	os.Unsetenv(envSystemdFDN)
+	return strconv.Atoi(v)
+}
+
+// listenKey returns the key of the given listening address.
+func listenKey(network, address string) (string, error) {
+	switch network {
+	case "unix":
+		return addrKey(&net.UnixAddr{Net: network, Name: address}), nil
+	case "tcp", "tcp4", "tcp6":
+		addr, err := net.ResolveTCPAddr(network, address)
+		if err != nil {
+			return "", err
+		}
+		return addrKey(addr), nil
+	}
+
+	return "", errors.New("unsupported stream network " + network)
+}
+
+// addrKey returns the key of a listener address, any unspecified IP is considered the same.
+func addrKey(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		if a.IP == nil || a.IP.IsUnspecified() {
+			return "tcp:" + strconv.Itoa(a.Port)
+		}
+		return "tcp:" + a.String()
+	case *net.UnixAddr:
+		return "unix:" + a.Name
+	}
+
+	return addr.Network() + ":" + addr.String()
+}
+
+// A trackedListener is a listener that can be passed to a new process until it is closed.
+type trackedListener struct {
+	net.Listener
+}
+
+func (l *trackedListener) Close() error {
+	listeners.mu.Lock()
+	delete(listeners.active, l)
+	listeners.mu.Unlock()
+
+	return l.Listener.Close()
+}
@@ -0,0 +1,75 @@
+package snet_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenerFiles(t *testing.T) {
+	l, err := snet.Listen("tcp://127.0.0.1:0")
+	assert.NoError(t, err)
+
+	files, err := snet.ListenerFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// The duplicated listener accepts connections on the same socket.
+	fl, err := net.FileListener(files[0])
+	assert.NoError(t, err)
+	files[0].Close()
+	l.Close()
+	defer fl.Close()
+
+	c, err := net.Dial("tcp", fl.Addr().String())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	sc, err := fl.Accept()
+	assert.NoError(t, err)
+	sc.Close()
+
+	files, err = snet.ListenerFiles()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestInheritable(t *testing.T) {
+	assert.True(t, snet.Inheritable("tcp://127.0.0.1:4242"))
+	assert.True(t, snet.Inheritable("wss://127.0.0.1:4242"))
+	assert.True(t, snet.Inheritable("unix:///run/seikan.sock"))
+	assert.False(t, snet.Inheritable("quic://127.0.0.1:4242"))
+	assert.False(t, snet.Inheritable("rudp://127.0.0.1:4242"))
+}
+
+func TestHandOverListeners(t *testing.T) {
+	for _, handover := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "seikan.sock")
+
+		l, err := snet.Listen("unix://" + path)
+		assert.NoError(t, err)
+
+		files, err := snet.ListenerFiles()
+		assert.NoError(t, err)
+		for _, f := range files {
+			f.Close()
+		}
+
+		if handover {
+			snet.HandOverListeners()
+		}
+		l.Close()
+
+		// The socket file is only kept for the new process once the handover is committed.
+		_, err = os.Stat(path)
+		if handover {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, os.ErrNotExist)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package snet
+
+import (
+	"errors"
+	"net"
+)
+
+// ErrGoAway is returned by AcceptStream when the peer tells to stop opening new streams.
+var ErrGoAway = errors.New("peer going away")
+
+// A Multiplexer is a connection whose transport natively multiplexes streams (e.g. QUIC).
+// Tunnels established over a Multiplexer do not need Yamux.
+type Multiplexer interface {
+	OpenStream() (net.Conn, error)
+	AcceptStream() (net.Conn, error)
+	// GoAway tells the peer to stop opening new streams.
+	GoAway() error
+	CloseChan() <-chan struct{}
+}
+
+// AsMultiplexer unwraps c until a Multiplexer is found.
+// Wrappers expose their underlying connection with a `NetConn() net.Conn' method.
+// When c is compressed, the streams of the returned Multiplexer are compressed the same way.
+func AsMultiplexer(c net.Conn) (Multiplexer, bool) {
+	var compressor interface{ Compression() Compression }
+	for c != nil {
+		if m, ok := c.(Multiplexer); ok {
+			if compressor != nil {
+				return &compressedMultiplexer{Multiplexer: m, compression: compressor.Compression()}, true
+			}
+			return m, true
+		}
+
+		if cc, ok := c.(interface{ Compression() Compression }); ok && compressor == nil {
+			compressor = cc
+		}
+
+		u, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil, false
+		}
+		c = u.NetConn()
+	}
+
+	return nil, false
+}
+
+// A compressedMultiplexer compresses the streams of a Multiplexer.
+type compressedMultiplexer struct {
+	Multiplexer
+	compression Compression
+}
+
+// OpenStream implements Multiplexer.
+func (m *compressedMultiplexer) OpenStream() (net.Conn, error) {
+	stream, err := m.Multiplexer.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return m.compress(stream)
+}
+
+// AcceptStream implements Multiplexer.
+func (m *compressedMultiplexer) AcceptStream() (net.Conn, error) {
+	stream, err := m.Multiplexer.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return m.compress(stream)
+}
+
+// compress returns the compressed stream, closing it also closes the given stream.
+func (m *compressedMultiplexer) compress(stream net.Conn) (net.Conn, error) {
+	c, err := CompressWith(stream, m.compression)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return CustomConnCloser(c, func() error {
+		c.Close()
+		return stream.Close()
+	}), nil
+}
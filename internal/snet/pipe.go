@@ -11,13 +11,13 @@ type Pipe struct {
 	c  net.Conn
 }
 
-// NewPipeTCP returns a new Pipe by opening a new TCP connection on remote.
-func NewPipeTCP(c net.Conn, remote string) (*Pipe, error) {
-	rc, err := net.Dial("tcp", remote)
+// NewPipeEndpoint returns a new Pipe by opening a new connection on the remote endpoint.
+// The remote is either a TCP `host:port' or a `unix:///path' socket.
+func NewPipeEndpoint(c net.Conn, remote string) (*Pipe, error) {
+	rc, err := DialEndpoint(remote)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to remote: %w", err)
 	}
-	rc.(*net.TCPConn).SetKeepAlive(true)
 
 	return NewPipe(c, rc)
 }
@@ -0,0 +1,111 @@
+package snet
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/mdouchement/seikan/pkg/transport"
+	"golang.org/x/net/proxy"
+)
+
+// NewProxyDialer returns a transport.ContextDialer reaching addresses through the given upstream proxy URL.
+//
+// Supported proxies:
+//   - http://[user:password@]host:port using the CONNECT method with basic authentication
+//   - socks5://[user:password@]host:port
+func NewProxyDialer(proxyURL string) (transport.ContextDialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		return &connectDialer{proxy: u}, nil
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{
+				User:     u.User.Username(),
+				Password: password,
+			}
+		}
+
+		d, err := proxy.SOCKS5("tcp", u.Host, auth, &net.Dialer{})
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		return d.(transport.ContextDialer), nil
+	}
+
+	return nil, errors.New("proxy: unsupported protocol scheme")
+}
+
+// A connectDialer tunnels TCP connections through an HTTP proxy using the CONNECT method.
+type connectDialer struct {
+	proxy *url.URL
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := (&net.Dialer{}).DialContext(ctx, "tcp", d.proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if d.proxy.User != nil {
+		password, _ := d.proxy.User.Password()
+		credentials := d.proxy.User.Username() + ":" + password
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	if err = req.Write(c); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+
+	br := bufio.NewReader(c)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		c.Close()
+		return nil, fmt.Errorf("proxy: CONNECT %s: %s", address, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		// The proxy already relayed bytes from the server, they must not be lost.
+		return &bufferedConn{Conn: c, r: br}, nil
+	}
+
+	return c, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
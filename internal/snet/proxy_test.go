@@ -0,0 +1,262 @@
+package snet_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialThroughHTTPProxy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		echo(t, c)
+	}()
+
+	proxy := connectProxy(t, "user:secret")
+	defer proxy.Close()
+
+	c, err := snet.DialThrough("tcp://"+l.Addr().String(), "http://user:secret@"+proxy.Addr().String())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	p := make([]byte, 4)
+	_, err = io.ReadFull(c, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+}
+
+func TestDialThroughHTTPProxyUnauthorized(t *testing.T) {
+	proxy := connectProxy(t, "user:secret")
+	defer proxy.Close()
+
+	_, err := snet.DialThrough("tcp://127.0.0.1:1", "http://user:wrong@"+proxy.Addr().String())
+	assert.ErrorContains(t, err, "407")
+}
+
+func TestDialThroughSOCKS5Proxy(t *testing.T) {
+	for name, credentials := range map[string]string{"anonymous": "", "authenticated": "user:secret"} {
+		t.Run(name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer l.Close()
+
+			go func() {
+				c, err := l.Accept()
+				assert.NoError(t, err, "server")
+				defer c.Close()
+
+				echo(t, c)
+			}()
+
+			proxy := socks5Proxy(t, credentials)
+			defer proxy.Close()
+
+			userinfo := ""
+			if credentials != "" {
+				userinfo = credentials + "@"
+			}
+
+			c, err := snet.DialThrough("tcp://"+l.Addr().String(), "socks5://"+userinfo+proxy.Addr().String())
+			assert.NoError(t, err)
+			defer c.Close()
+
+			_, err = c.Write([]byte("ping"))
+			assert.NoError(t, err)
+
+			p := make([]byte, 4)
+			_, err = io.ReadFull(c, p)
+			assert.NoError(t, err)
+			assert.Equal(t, "ping", string(p))
+		})
+	}
+}
+
+func TestDialThroughSOCKS5ProxyUnauthorized(t *testing.T) {
+	proxy := socks5Proxy(t, "user:secret")
+	defer proxy.Close()
+
+	_, err := snet.DialThrough("tcp://127.0.0.1:1", "socks5://user:wrong@"+proxy.Addr().String())
+	assert.ErrorContains(t, err, "authentication failed")
+
+	_, err = snet.DialThrough("tcp://127.0.0.1:1", "socks5://"+proxy.Addr().String())
+	assert.ErrorContains(t, err, "no acceptable authentication methods")
+}
+
+func TestDialThroughUnsupported(t *testing.T) {
+	_, err := snet.DialThrough("tcp://127.0.0.1:1", "ftp://127.0.0.1:21")
+	assert.EqualError(t, err, "proxy: unsupported protocol scheme")
+
+	_, err = snet.DialThrough("quic://127.0.0.1:1", "http://127.0.0.1:3128")
+	assert.EqualError(t, err, "unsupported protocol scheme through proxy")
+}
+
+// connectProxy is a minimal HTTP CONNECT proxy stand-in.
+func connectProxy(t *testing.T, credentials string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+
+				req, err := http.ReadRequest(bufio.NewReader(c))
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+
+				if req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)) {
+					io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+
+				rc, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer rc.Close()
+
+				io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+				snet.Relay(c, rc)
+			}()
+		}
+	}()
+
+	return l
+}
+
+// socks5Proxy is a minimal SOCKS5 proxy stand-in (RFC 1928), the username/password authentication (RFC 1929)
+// is required when credentials are given.
+func socks5Proxy(t *testing.T, credentials string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+
+				// Method selection
+				hdr := make([]byte, 2)
+				if _, err := io.ReadFull(r, hdr); err != nil || hdr[0] != 0x05 {
+					return
+				}
+				methods := make([]byte, hdr[1])
+				if _, err := io.ReadFull(r, methods); err != nil {
+					return
+				}
+
+				method := byte(0x00)
+				if credentials != "" {
+					method = 0x02
+				}
+				if !slices.Contains(methods, method) {
+					c.Write([]byte{0x05, 0xFF})
+					return
+				}
+				c.Write([]byte{0x05, method})
+
+				// Username/password authentication
+				if method == 0x02 {
+					if _, err := io.ReadFull(r, hdr); err != nil || hdr[0] != 0x01 {
+						return
+					}
+					username := make([]byte, hdr[1])
+					if _, err := io.ReadFull(r, username); err != nil {
+						return
+					}
+					size, err := r.ReadByte()
+					if err != nil {
+						return
+					}
+					password := make([]byte, size)
+					if _, err := io.ReadFull(r, password); err != nil {
+						return
+					}
+
+					if string(username)+":"+string(password) != credentials {
+						c.Write([]byte{0x01, 0x01})
+						return
+					}
+					c.Write([]byte{0x01, 0x00})
+				}
+
+				// CONNECT request
+				req := make([]byte, 4)
+				if _, err := io.ReadFull(r, req); err != nil || req[1] != 0x01 {
+					return
+				}
+
+				var host string
+				switch req[3] {
+				case 0x01:
+					ip := make([]byte, net.IPv4len)
+					if _, err := io.ReadFull(r, ip); err != nil {
+						return
+					}
+					host = net.IP(ip).String()
+				case 0x03:
+					size, err := r.ReadByte()
+					if err != nil {
+						return
+					}
+					name := make([]byte, size)
+					if _, err := io.ReadFull(r, name); err != nil {
+						return
+					}
+					host = string(name)
+				default:
+					return
+				}
+
+				port := make([]byte, 2)
+				if _, err := io.ReadFull(r, port); err != nil {
+					return
+				}
+
+				rc, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+				if err != nil {
+					c.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0}) // Connection refused
+					return
+				}
+				defer rc.Close()
+
+				c.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				snet.Relay(c, rc)
+			}()
+		}
+	}()
+
+	return l
+}
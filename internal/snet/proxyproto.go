@@ -0,0 +1,98 @@
+package snet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/mdouchement/seikan/pkg/proxyproto"
+)
+
+// A ProxyProtocolConn is a connection whose remote address was recovered from a PROXY protocol header.
+type ProxyProtocolConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+// AcceptProxyProtocol reads the optional PROXY protocol header (v1 or v2) of c
+// when its peer belongs to one of the trusted networks, c is returned unchanged otherwise.
+// A Unix socket peer is trusted when any network is, the access to the socket is restricted by its file mode.
+// The returned connection reports the recovered client address as RemoteAddr.
+func AcceptProxyProtocol(c net.Conn, trusted []*net.IPNet) (net.Conn, error) {
+	if _, unix := c.RemoteAddr().(*net.UnixAddr); !(unix && len(trusted) > 0) && !Trusted(c.RemoteAddr(), trusted) {
+		return c, nil
+	}
+
+	pc, _, err := ReadProxyProtocol(c)
+	return pc, err
+}
+
+// ReadProxyProtocol reads the optional PROXY protocol header (v1 or v2) at the beginning of c.
+// The returned header is nil when c does not start by a PROXY protocol header.
+// The returned connection reports the recovered client address as RemoteAddr.
+func ReadProxyProtocol(c net.Conn) (net.Conn, *proxyproto.Header, error) {
+	r := bufio.NewReader(c)
+	h, err := proxyproto.Read(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read PROXY protocol header: %w", err)
+	}
+
+	pc := &ProxyProtocolConn{
+		Conn:   c,
+		r:      r,
+		remote: c.RemoteAddr(),
+	}
+	if h != nil && !h.Local && h.Source != nil {
+		pc.remote = h.Source
+	}
+
+	return pc, h, nil
+}
+
+// WriteProxyProtocol writes a PROXY protocol header of the given version
+// describing a connection from src to dst.
+func WriteProxyProtocol(w io.Writer, version int, src, dst net.Addr) error {
+	h := &proxyproto.Header{
+		Source:      src,
+		Destination: dst,
+	}
+
+	p, err := h.Format(version)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(p)
+	return err
+}
+
+// Trusted returns true if addr is a TCP address belonging to one of the given networks.
+func Trusted(addr net.Addr, trusted []*net.IPNet) bool {
+	a, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(a.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ProxyProtocolConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the client address sent by the proxy.
+func (c *ProxyProtocolConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// NetConn returns the underlying connection.
+func (c *ProxyProtocolConn) NetConn() net.Conn {
+	return c.Conn
+}
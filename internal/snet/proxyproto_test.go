@@ -0,0 +1,99 @@
+package snet_test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcceptProxyProtocol(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, other, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for _, tc := range []struct {
+		name     string
+		trusted  []*net.IPNet
+		remote   string
+		expected string
+	}{
+		{name: "trusted", trusted: []*net.IPNet{other, loopback}, remote: "192.0.2.1:56324", expected: "payload"},
+		{name: "untrusted", trusted: []*net.IPNet{other}, expected: "PROXY TCP4 192.0.2.1 127.0.0.1 56324 4242\r\npayload"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			defer l.Close()
+
+			go func() {
+				c, err := net.Dial("tcp", l.Addr().String())
+				assert.NoError(t, err)
+				defer c.Close()
+
+				io.WriteString(c, "PROXY TCP4 192.0.2.1 127.0.0.1 56324 4242\r\npayload")
+			}()
+
+			c, err := l.Accept()
+			assert.NoError(t, err)
+			defer c.Close()
+
+			pc, err := snet.AcceptProxyProtocol(c, tc.trusted)
+			assert.NoError(t, err)
+
+			if tc.remote == "" {
+				assert.Equal(t, c, pc)
+			} else {
+				assert.Equal(t, tc.remote, pc.RemoteAddr().String())
+			}
+
+			p, err := io.ReadAll(pc)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(p))
+		})
+	}
+}
+
+func TestAcceptProxyProtocol_Unix(t *testing.T) {
+	_, other, _ := net.ParseCIDR("10.0.0.0/8")
+
+	for _, tc := range []struct {
+		name     string
+		trusted  []*net.IPNet
+		expected string
+	}{
+		{name: "trusted", trusted: []*net.IPNet{other}, expected: "payload"},
+		{name: "untrusted", expected: "PROXY TCP4 192.0.2.1 127.0.0.1 56324 4242\r\npayload"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := net.Listen("unix", filepath.Join(t.TempDir(), "seikan.sock"))
+			assert.NoError(t, err)
+			defer l.Close()
+
+			go func() {
+				c, err := net.Dial("unix", l.Addr().String())
+				assert.NoError(t, err)
+				defer c.Close()
+
+				io.WriteString(c, "PROXY TCP4 192.0.2.1 127.0.0.1 56324 4242\r\npayload")
+			}()
+
+			c, err := l.Accept()
+			assert.NoError(t, err)
+			defer c.Close()
+
+			pc, err := snet.AcceptProxyProtocol(c, tc.trusted)
+			assert.NoError(t, err)
+
+			if len(tc.trusted) > 0 {
+				assert.Equal(t, "192.0.2.1:56324", pc.RemoteAddr().String())
+			}
+
+			p, err := io.ReadAll(pc)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(p))
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package snet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	quicProtocol       = "seikan"
+	quicExporterLabel  = "EXPORTER-seikan-quic"
+	quicStreamPreamble = 0x01
+	quicGoAwayPreamble = 0x02
+)
+
+var quicConfig = &quic.Config{
+	KeepAlivePeriod: 15 * time.Second,
+	MaxIdleTimeout:  60 * time.Second,
+}
+
+// A QUICListener implements a net.Listener over QUIC.
+// Accepted connections are bound to the first stream opened by the peer.
+type QUICListener struct {
+	l      *quic.Listener
+	connCh chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+// ListenQUIC announces on the host of the given quic:// URL.
+//
+// The TLS certificate is a throwaway self-signed one, it carries no trust.
+// Peers are authenticated by the Noise handshake which is bound to the TLS session (see QUICConn.ChannelBinding).
+func ListenQUIC(u *url.URL) (net.Listener, error) {
+	cert, err := throwawayCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := quic.ListenAddr(u.Host, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{quicProtocol},
+		MinVersion:   tls.VersionTLS13,
+	}, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ql := &QUICListener{
+		l:      l,
+		connCh: make(chan net.Conn),
+		done:   make(chan struct{}),
+	}
+
+	go ql.serve()
+	return ql, nil
+}
+
+// Accept implements net.Listener.
+func (l *QUICListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.connCh:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *QUICListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return l.l.Close()
+}
+
+// Addr implements net.Listener.
+func (l *QUICListener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+func (l *QUICListener) serve() {
+	for {
+		conn, err := l.l.Accept(context.Background())
+		if err != nil {
+			l.Close()
+			return
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(conn.Context(), 10*time.Second)
+			defer cancel()
+
+			stream, err := acceptQUICStream(ctx, conn)
+			if err != nil { // Including a GoAway before the first stream
+				conn.CloseWithError(0, "")
+				return
+			}
+
+			select {
+			case l.connCh <- &QUICConn{Stream: stream, conn: conn}:
+			case <-l.done:
+				conn.CloseWithError(0, "")
+			}
+		}()
+	}
+}
+
+// DialQUIC connects to the given quic:// URL.
+func DialQUIC(u *url.URL) (net.Conn, error) {
+	conn, err := quic.DialAddr(context.Background(), u.Host, &tls.Config{
+		InsecureSkipVerify: true, // The Noise handshake authenticates the peers.
+		NextProtos:         []string{quicProtocol},
+		MinVersion:         tls.VersionTLS13,
+	}, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := openQUICStream(context.Background(), conn, quicStreamPreamble)
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return nil, err
+	}
+
+	return &QUICConn{Stream: stream, conn: conn}, nil
+}
+
+// A QUICConn is the net.Conn of the first stream of a QUIC connection.
+// It is used for the handshake and controls, next streams are natively multiplexed by QUIC.
+type QUICConn struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+// LocalAddr implements net.Conn.
+func (c *QUICConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (c *QUICConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Close closes the whole QUIC connection.
+func (c *QUICConn) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+// ChannelBinding returns keying material exported from the TLS session of the QUIC connection.
+// Mixed into the Noise handshake, it prevents a man-in-the-middle from terminating the throwaway TLS.
+func (c *QUICConn) ChannelBinding() []byte {
+	state := c.conn.ConnectionState().TLS
+	p, err := state.ExportKeyingMaterial(quicExporterLabel, nil, 32)
+	if err != nil {
+		return nil
+	}
+	return p
+}
+
+// OpenStream implements Multiplexer.
+func (c *QUICConn) OpenStream() (net.Conn, error) {
+	stream, err := openQUICStream(c.conn.Context(), c.conn, quicStreamPreamble)
+	if err != nil {
+		return nil, c.closed(err)
+	}
+
+	return &quicStream{Stream: stream, conn: c.conn}, nil
+}
+
+// AcceptStream implements Multiplexer.
+func (c *QUICConn) AcceptStream() (net.Conn, error) {
+	stream, err := acceptQUICStream(c.conn.Context(), c.conn)
+	if errors.Is(err, ErrGoAway) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, c.closed(err)
+	}
+
+	return &quicStream{Stream: stream, conn: c.conn}, nil
+}
+
+// GoAway implements Multiplexer.
+// It opens a stream with the GoAway preamble, the peer gets ErrGoAway from AcceptStream.
+func (c *QUICConn) GoAway() error {
+	stream, err := openQUICStream(c.conn.Context(), c.conn, quicGoAwayPreamble)
+	if err != nil {
+		return c.closed(err)
+	}
+
+	return stream.Close()
+}
+
+// CloseChan implements Multiplexer.
+func (c *QUICConn) CloseChan() <-chan struct{} {
+	return c.conn.Context().Done()
+}
+
+func (c *QUICConn) closed(err error) error {
+	if c.conn.Context().Err() != nil {
+		return io.EOF
+	}
+	return err
+}
+
+// openQUICStream opens a new stream and sends the given preamble.
+// The peer only learns about a stream when data is sent on it.
+func openQUICStream(ctx context.Context, conn *quic.Conn, preamble byte) (*quic.Stream, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = stream.Write([]byte{preamble}); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// acceptQUICStream accepts a new stream and checks its preamble.
+// ErrGoAway is returned when the stream is a GoAway one.
+func acceptQUICStream(ctx context.Context, conn *quic.Conn) (*quic.Stream, error) {
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	preamble := make([]byte, 1)
+	_, err = io.ReadFull(stream, preamble)
+	if err == nil && preamble[0] == quicStreamPreamble {
+		return stream, nil
+	}
+
+	stream.CancelRead(0)
+	stream.Close()
+	if err == nil && preamble[0] == quicGoAwayPreamble {
+		return nil, ErrGoAway
+	}
+	return nil, errors.New("quic: invalid stream preamble")
+}
+
+type quicStream struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+func (s *quicStream) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *quicStream) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// Close closes both directions of the stream.
+func (s *quicStream) Close() error {
+	s.CancelRead(0)
+	return s.Stream.Close()
+}
+
+func throwawayCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: quicProtocol},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(10 * 365 * 24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
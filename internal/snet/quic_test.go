@@ -0,0 +1,176 @@
+package snet_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/noise"
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQUIC(t *testing.T) {
+	l, err := snet.Listen("quic://127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+
+	done := make(chan bool)
+	go func() {
+		defer func() { done <- true }()
+
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		nc, err := noise.Handshake(c, server, noise.Peer{Pattern: noise.PatternIK, Public: client.Public}, true, noise.SessionOptions{})
+		assert.NoError(t, err, "server")
+
+		m, ok := snet.AsMultiplexer(nc)
+		assert.True(t, ok, "server")
+
+		stream, err := m.AcceptStream()
+		assert.NoError(t, err, "server")
+		defer stream.Close()
+
+		echo(t, stream)
+		<-done // Wait for the client to read the echo before closing the connection.
+	}()
+
+	c, err := snet.Dial("quic://" + l.Addr().String())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	nc, err := noise.Handshake(c, client, noise.Peer{Pattern: noise.PatternIK, Public: server.Public}, false, noise.SessionOptions{})
+	assert.NoError(t, err)
+
+	m, ok := snet.AsMultiplexer(nc)
+	assert.True(t, ok)
+
+	stream, err := m.OpenStream()
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	_, err = stream.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	p := make([]byte, 4)
+	_, err = io.ReadFull(stream, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+
+	done <- true
+	<-done
+}
+
+func TestQUIC_Compression(t *testing.T) {
+	l, err := snet.Listen("quic://127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	server := noise.GenerateIdentity()
+	client := noise.GenerateIdentity()
+
+	compression, err := snet.ParseCompression("zstd:3+adaptive")
+	assert.NoError(t, err)
+
+	payload := bytes.Repeat([]byte("seikan"), 32<<10)
+
+	done := make(chan bool)
+	go func() {
+		defer func() { done <- true }()
+
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		nc, err := noise.Handshake(c, server, noise.Peer{Pattern: noise.PatternIK, Public: client.Public}, true, noise.SessionOptions{})
+		assert.NoError(t, err, "server")
+
+		cc, err := snet.CompressWith(nc, compression)
+		assert.NoError(t, err, "server")
+
+		m, ok := snet.AsMultiplexer(cc)
+		assert.True(t, ok, "server")
+
+		stream, err := m.AcceptStream()
+		assert.NoError(t, err, "server")
+		defer stream.Close()
+
+		p := make([]byte, len(payload))
+		_, err = io.ReadFull(stream, p)
+		assert.NoError(t, err, "server")
+		assert.Equal(t, payload, p, "server")
+
+		// The peer stops opening streams once told to go away.
+		assert.NoError(t, m.GoAway(), "server")
+		<-done
+	}()
+
+	c, err := snet.Dial("quic://" + l.Addr().String())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	nc, err := noise.Handshake(c, client, noise.Peer{Pattern: noise.PatternIK, Public: server.Public}, false, noise.SessionOptions{})
+	assert.NoError(t, err)
+
+	cc, err := snet.CompressWith(nc, compression)
+	assert.NoError(t, err)
+
+	m, ok := snet.AsMultiplexer(cc)
+	assert.True(t, ok)
+
+	stream, err := m.OpenStream()
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	// The streams are compressed like the session.
+	bc, ok := stream.(interface{ NetConn() net.Conn }).NetConn().(*snet.BlockConn)
+	if assert.True(t, ok) {
+		assert.Equal(t, compression, bc.Compression())
+	}
+
+	_, err = stream.Write(payload)
+	assert.NoError(t, err)
+
+	_, err = m.AcceptStream()
+	assert.ErrorIs(t, err, snet.ErrGoAway)
+
+	done <- true
+	<-done
+}
+
+func TestQUICChannelBinding(t *testing.T) {
+	l, err := snet.Listen("quic://127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	bindings := make(chan []byte, 1)
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		bindings <- c.(interface{ ChannelBinding() []byte }).ChannelBinding()
+	}()
+
+	c, err := snet.Dial("quic://" + l.Addr().String())
+	assert.NoError(t, err)
+	defer c.Close()
+
+	binding := c.(interface{ ChannelBinding() []byte }).ChannelBinding()
+	assert.Len(t, binding, 32)
+	assert.Equal(t, binding, <-bindings)
+}
+
+func echo(t *testing.T, c net.Conn) {
+	p := make([]byte, 4)
+	_, err := io.ReadFull(c, p)
+	assert.NoError(t, err)
+	_, err = c.Write(p)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,67 @@
+package snet
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/mdouchement/seikan/pkg/rudp"
+)
+
+// ListenRUDP announces on the given rudp://host:port URL.
+// See RUDPConfig for the supported query parameters.
+func ListenRUDP(u *url.URL) (net.Listener, error) {
+	config, err := RUDPConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return rudp.Listen(u.Host, config)
+}
+
+// DialRUDP connects to the given rudp://host:port URL.
+// See RUDPConfig for the supported query parameters.
+func DialRUDP(u *url.URL) (net.Conn, error) {
+	config, err := RUDPConfig(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return rudp.Dial(u.Host, config)
+}
+
+// RUDPConfig parses the reliable UDP options from the URL query parameters.
+//
+// Supported query parameters:
+//   - mtu: the maximum size of an UDP payload (default 1350)
+//   - window: the send and receive window in segments (default 256)
+//   - data_shards & parity_shards: the forward error correction shards (disabled by default),
+//     both peers must use the same values
+func RUDPConfig(u *url.URL) (rudp.Config, error) {
+	var config rudp.Config
+	query := u.Query()
+
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{name: "mtu", value: &config.MTU},
+		{name: "window", value: &config.Window},
+		{name: "data_shards", value: &config.DataShards},
+		{name: "parity_shards", value: &config.ParityShards},
+	} {
+		v := query.Get(p.name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return config, fmt.Errorf("rudp: invalid %s %q: %w", p.name, v, err)
+		}
+		*p.value = n
+	}
+
+	return config, config.Validate()
+}
@@ -0,0 +1,89 @@
+package snet_test
+
+import (
+	"io"
+	"net/url"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRUDP(t *testing.T) {
+	l, err := snet.Listen("rudp://127.0.0.1:0?mtu=1200&data_shards=10&parity_shards=3")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	done := make(chan bool)
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		echo(t, c)
+		<-done
+	}()
+
+	c, err := snet.Dial("rudp://" + l.Addr().String() + "?mtu=1200&data_shards=10&parity_shards=3")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	p := make([]byte, 4)
+	_, err = io.ReadFull(c, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+
+	done <- true
+}
+
+func TestMNet(t *testing.T) {
+	l, err := snet.Listen("mnet://127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	done := make(chan bool)
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		echo(t, c)
+		<-done
+	}()
+
+	c, err := snet.Dial("mnet://" + l.Addr().String())
+	assert.NoError(t, err)
+
+	_, err = c.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	p := make([]byte, 4)
+	_, err = io.ReadFull(c, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+
+	// mnet may deadlock when both peers shut the connection down at the same time.
+	c.Close()
+	done <- true
+}
+
+func TestRUDPConfig(t *testing.T) {
+	u, _ := url.Parse("rudp://127.0.0.1:4242?mtu=1400&window=512&data_shards=10&parity_shards=3")
+	config, err := snet.RUDPConfig(u)
+	assert.NoError(t, err)
+	assert.Equal(t, 1400, config.MTU)
+	assert.Equal(t, 512, config.Window)
+	assert.Equal(t, 10, config.DataShards)
+	assert.Equal(t, 3, config.ParityShards)
+
+	u, _ = url.Parse("rudp://127.0.0.1:4242?mtu=big")
+	_, err = snet.RUDPConfig(u)
+	assert.ErrorContains(t, err, `rudp: invalid mtu "big"`)
+
+	u, _ = url.Parse("rudp://127.0.0.1:4242?mtu=64")
+	_, err = snet.RUDPConfig(u)
+	assert.EqualError(t, err, "rudp: mtu must be between 128 and 9000")
+}
@@ -0,0 +1,91 @@
+package snet_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTLS(t *testing.T) {
+	cert, key := certificate(t)
+
+	l, err := snet.Listen("tls://127.0.0.1:0?cert=" + cert + "&key=" + key)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	states := make(chan tls.ConnectionState, 1)
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		echo(t, c)
+		states <- c.(*tls.Conn).ConnectionState()
+	}()
+
+	c, err := snet.Dial("tls://" + l.Addr().String() + "?sni=www.example.com")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	p := make([]byte, 4)
+	_, err = io.ReadFull(c, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+
+	state := <-states
+	assert.Equal(t, "www.example.com", state.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	assert.Equal(t, "http/1.1", state.NegotiatedProtocol)
+}
+
+func TestTLSMissingCertificate(t *testing.T) {
+	_, err := snet.Listen("tls://127.0.0.1:0")
+	assert.Error(t, err)
+}
+
+// certificate writes a self-signed certificate and its key in PEM files.
+func certificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "www.example.com"},
+		DNSNames:     []string{"www.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	keyfile := filepath.Join(dir, "key.pem")
+
+	err = os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.NoError(t, err)
+	err = os.WriteFile(keyfile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), 0600)
+	assert.NoError(t, err)
+
+	return cert, keyfile
+}
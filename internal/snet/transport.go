@@ -0,0 +1,113 @@
+package snet
+
+import (
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/mdouchement/seikan/pkg/transport"
+	mnet "github.com/mendsley/gomnet"
+)
+
+func init() {
+	transport.Register(tcpTransport{}, "tcp", "tcp4", "tcp6")
+	transport.Register(websocketTransport{}, "ws", "wss")
+	transport.Register(quicTransport{}, "quic")
+	transport.Register(unixTransport{}, "unix")
+	transport.Register(tlsTransport{}, "tls")
+	transport.Register(rudpTransport{}, "rudp")
+	transport.Register(mnetTransport{}, "mnet")
+}
+
+//
+// Built-in transports
+//
+
+type tcpTransport struct{}
+
+func (tcpTransport) Listen(u *url.URL) (net.Listener, error) {
+	return listenStream(u.Scheme, u.Host, nil)
+}
+
+func (tcpTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	return d.DialContext(context.Background(), u.Scheme, u.Host)
+}
+
+type websocketTransport struct{}
+
+func (websocketTransport) Listen(u *url.URL) (net.Listener, error) {
+	return ListenWebSocket(u)
+}
+
+func (websocketTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	return DialWebSocket(u, d)
+}
+
+type quicTransport struct{}
+
+func (quicTransport) Listen(u *url.URL) (net.Listener, error) {
+	return ListenQUIC(u)
+}
+
+func (quicTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	if d != nil {
+		return nil, transport.ErrProxyUnsupported
+	}
+	return DialQUIC(u)
+}
+
+type unixTransport struct{}
+
+func (unixTransport) Listen(u *url.URL) (net.Listener, error) {
+	return ListenUnix(u)
+}
+
+func (unixTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	if d != nil {
+		return nil, transport.ErrProxyUnsupported
+	}
+	return DialUnix(u)
+}
+
+type tlsTransport struct{}
+
+func (tlsTransport) Listen(u *url.URL) (net.Listener, error) {
+	return ListenTLS(u)
+}
+
+func (tlsTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	return DialTLS(u, d)
+}
+
+type rudpTransport struct{}
+
+func (rudpTransport) Listen(u *url.URL) (net.Listener, error) {
+	return ListenRUDP(u)
+}
+
+func (rudpTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	if d != nil {
+		return nil, transport.ErrProxyUnsupported
+	}
+	return DialRUDP(u)
+}
+
+// mnetTransport is the experimental reliable-ordered transport over UDP of the previous versions,
+// kept for their peers.
+//
+// Deprecated: use the rudp transport instead, both peers must be updated.
+type mnetTransport struct{}
+
+func (mnetTransport) Listen(u *url.URL) (net.Listener, error) {
+	return mnet.Listen("udp", u.Host)
+}
+
+func (mnetTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	if d != nil {
+		return nil, transport.ErrProxyUnsupported
+	}
+	return mnet.Dial("udp", u.Host)
+}
@@ -0,0 +1,24 @@
+package snet_test
+
+import (
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveTransport(t *testing.T) {
+	assert.Subset(t, transport.Schemes(), []string{"tcp", "tcp4", "tcp6", "ws", "wss", "quic", "unix", "tls", "rudp"})
+
+	_, u, err := transport.Resolve("rudp://127.0.0.1:4242?mtu=1400")
+	assert.NoError(t, err)
+	assert.Equal(t, "1400", u.Query().Get("mtu"))
+
+	// The deprecated transport of the previous versions.
+	_, _, err = transport.Resolve("mnet://127.0.0.1:4242")
+	assert.NoError(t, err)
+
+	_, err = snet.Dial("unknown://127.0.0.1:4242")
+	assert.ErrorIs(t, err, transport.ErrUnsupportedScheme)
+}
@@ -0,0 +1,115 @@
+package snet
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ListenUnix announces on the Unix domain socket of the given unix:///path URL.
+//
+// Supported query parameters:
+//   - mode: the octal file mode of the socket (e.g. 0660)
+//   - owner: the owner of the socket as user, user:group or :group (names or numeric IDs)
+//
+// A stale socket file left by a previous run is removed, unless the listener is inherited (see InheritListeners).
+// A socket file still accepting connections is never removed.
+func ListenUnix(u *url.URL) (net.Listener, error) {
+	path := u.Path
+	if path == "" {
+		return nil, fmt.Errorf("unix: missing socket path in %q", u)
+	}
+
+	l, err := listenStream("unix", path, func() error {
+		if fi, err := os.Lstat(path); err != nil || fi.Mode().Type() != fs.ModeSocket {
+			return nil
+		}
+
+		// The socket is only stale when nothing listens on it anymore.
+		c, err := net.Dial("unix", path)
+		if err == nil {
+			c.Close()
+			return fmt.Errorf("unix: socket %s is in use", path)
+		}
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return fmt.Errorf("unix: check stale socket: %w", err)
+		}
+
+		if err = os.Remove(path); err != nil {
+			return fmt.Errorf("unix: remove stale socket: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mode := u.Query().Get("mode"); mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("unix: invalid mode %q: %w", mode, err)
+		}
+
+		if err = os.Chmod(path, fs.FileMode(perm)); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("unix: chmod: %w", err)
+		}
+	}
+
+	if owner := u.Query().Get("owner"); owner != "" {
+		uid, gid, err := lookupOwner(owner)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("unix: invalid owner %q: %w", owner, err)
+		}
+
+		if err = os.Chown(path, uid, gid); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("unix: chown: %w", err)
+		}
+	}
+
+	return l, nil
+}
+
+// DialUnix connects to the Unix domain socket of the given unix:///path URL.
+func DialUnix(u *url.URL) (net.Conn, error) {
+	return net.Dial("unix", u.Path)
+}
+
+// lookupOwner returns the uid and gid of the `user:group' owner.
+// An omitted part is returned as -1 to be left unchanged by os.Chown.
+func lookupOwner(owner string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+	name, group, _ := strings.Cut(owner, ":")
+
+	if name != "" {
+		if uid, err = strconv.Atoi(name); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return 0, 0, err
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+
+	if group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, err
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
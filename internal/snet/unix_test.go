@@ -0,0 +1,82 @@
+package snet_test
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixEndpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seikan.sock")
+	address := fmt.Sprintf("unix://%s?mode=0600&owner=%d:%d", path, os.Getuid(), os.Getgid())
+
+	l, err := snet.ListenEndpoint(address)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, fs.ModeSocket, fi.Mode().Type())
+	assert.Equal(t, fs.FileMode(0600), fi.Mode().Perm())
+
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		echo(t, c)
+	}()
+
+	c, err := snet.DialEndpoint("unix://" + path)
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("ping"))
+	assert.NoError(t, err)
+
+	p := make([]byte, 4)
+	_, err = c.Read(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+}
+
+func TestUnixEndpointStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seikan.sock")
+
+	// Simulate a crashed process leaving its socket behind.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	assert.NoError(t, err)
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := snet.ListenEndpoint("unix://" + path)
+	assert.NoError(t, err)
+	l.Close()
+}
+
+func TestUnixEndpointInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seikan.sock")
+
+	l, err := snet.ListenEndpoint("unix://" + path)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	_, err = snet.ListenEndpoint("unix://" + path)
+	assert.EqualError(t, err, "unix: socket "+path+" is in use")
+
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestUnixEndpointInvalidMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seikan.sock")
+
+	_, err := snet.ListenEndpoint("unix://" + path + "?mode=rw")
+	assert.ErrorContains(t, err, "invalid mode")
+}
@@ -0,0 +1,171 @@
+package snet
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/mdouchement/seikan/pkg/transport"
+)
+
+// Timeouts of the HTTP requests preceding the WebSocket upgrades, the upgraded connections are not affected.
+const (
+	websocketReadHeaderTimeout = 10 * time.Second
+	websocketIdleTimeout       = time.Minute
+)
+
+// A WebSocketListener implements a net.Listener accepting WebSocket upgrades on a given path.
+// Each accepted WebSocket is exposed as a net.Conn carrying binary frames.
+type WebSocketListener struct {
+	net.Listener
+	server *http.Server
+	connCh chan net.Conn
+	done   chan struct{}
+	once   sync.Once
+}
+
+// ListenWebSocket announces on the host of the given ws:// or wss:// URL
+// and accepts WebSocket upgrades on its path.
+//
+// A wss:// URL requires the `cert` and `key` query parameters pointing to PEM files.
+// Use ws:// when TLS is terminated by a reverse proxy.
+func ListenWebSocket(u *url.URL) (net.Listener, error) {
+	var config *tls.Config
+	if u.Scheme == "wss" {
+		cert, err := tls.LoadX509KeyPair(u.Query().Get("cert"), u.Query().Get("key"))
+		if err != nil {
+			return nil, err
+		}
+
+		config = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	l, err := listenStream("tcp", u.Host, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	wsl := &WebSocketListener{
+		Listener: l,
+		connCh:   make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(websocketPath(u), wsl.upgrade)
+	wsl.server = &http.Server{
+		Handler:           mux,
+		TLSConfig:         config,
+		ReadHeaderTimeout: websocketReadHeaderTimeout,
+		IdleTimeout:       websocketIdleTimeout,
+	}
+
+	go func() {
+		if config != nil {
+			wsl.server.ServeTLS(l, "", "")
+			return
+		}
+		wsl.server.Serve(l)
+	}()
+
+	return wsl, nil
+}
+
+// Accept implements net.Listener.
+func (l *WebSocketListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.connCh:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+func (l *WebSocketListener) Close() error {
+	l.once.Do(func() {
+		close(l.done)
+	})
+	return l.server.Close()
+}
+
+func (l *WebSocketListener) upgrade(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return // Accept already wrote the HTTP error.
+	}
+
+	c := &websocketConn{
+		Conn:   websocket.NetConn(context.Background(), ws, websocket.MessageBinary),
+		closed: make(chan struct{}),
+	}
+
+	select {
+	case l.connCh <- c:
+	case <-l.done:
+		c.Close()
+		return
+	}
+
+	// The handler keeps ownership of the request until the connection is released.
+	select {
+	case <-c.closed:
+	case <-l.done:
+	}
+}
+
+type websocketConn struct {
+	net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *websocketConn) Close() error {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+	return c.Conn.Close()
+}
+
+// DialWebSocket connects to the given ws:// or wss:// URL and returns the WebSocket as a net.Conn.
+// The optional dialer d is used to open the underlying TCP connection.
+func DialWebSocket(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	u = &url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   websocketPath(u),
+	}
+
+	var options *websocket.DialOptions
+	if d != nil {
+		options = &websocket.DialOptions{
+			HTTPClient: &http.Client{
+				Transport: &http.Transport{
+					DialContext: d.DialContext,
+				},
+			},
+		}
+	}
+
+	ws, _, err := websocket.Dial(context.Background(), u.String(), options)
+	if err != nil {
+		return nil, err
+	}
+
+	return websocket.NetConn(context.Background(), ws, websocket.MessageBinary), nil
+}
+
+func websocketPath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
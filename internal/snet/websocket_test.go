@@ -0,0 +1,68 @@
+package snet_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebSocketThroughProxy(t *testing.T) {
+	l, err := snet.Listen("ws://127.0.0.1:0/tunnel")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	// Reverse proxy stand-in in front of the server.
+	proxy := httptest.NewServer(httputil.NewSingleHostReverseProxy(&url.URL{
+		Scheme: "http",
+		Host:   l.Addr().String(),
+	}))
+	defer proxy.Close()
+
+	expected := make([]byte, 256<<10)
+	_, err = rand.Read(expected)
+	assert.NoError(t, err)
+
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		// Echo
+		p := make([]byte, len(expected))
+		_, err = io.ReadFull(c, p)
+		assert.NoError(t, err, "server")
+		_, err = c.Write(p)
+		assert.NoError(t, err, "server")
+	}()
+
+	u, err := url.Parse(proxy.URL)
+	assert.NoError(t, err)
+
+	c, err := snet.Dial("ws://" + u.Host + "/tunnel")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write(expected)
+	assert.NoError(t, err)
+
+	actual := make([]byte, len(expected))
+	_, err = io.ReadFull(c, actual)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(expected, actual))
+}
+
+func TestWebSocketWrongPath(t *testing.T) {
+	l, err := snet.Listen("ws://127.0.0.1:0/tunnel")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	_, err = snet.Dial("ws://" + l.Addr().String() + "/other")
+	assert.Error(t, err)
+}
@@ -36,7 +36,17 @@ func Encode(p []byte) string {
 }
 
 // Decode decodes the given base58 s into bytes.
+// It panics if s is not valid base58, see DecodeString for untrusted inputs.
 func Decode(s string) []byte {
+	p, err := DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// DecodeString decodes the given base58 s into bytes.
+func DecodeString(s string) ([]byte, error) {
 	decode := make([]int8, 128)
 	for i := range decode {
 		decode[i] = -1
@@ -64,12 +74,12 @@ func Decode(s string) []byte {
 
 	n := new(big.Int)
 	for i := range src[j:] {
-		c := decode[src[i]]
-		if c == -1 {
-			panic(fmt.Errorf("illegal base58 data at input index: %d", i))
+		if src[i] >= 128 || decode[src[i]] == -1 {
+			return nil, fmt.Errorf("illegal base58 data at input index: %d", i)
 		}
+		c := decode[src[i]]
 		n.Mul(n, bn58)
 		n.Add(n, big.NewInt(int64(c)))
 	}
-	return append(leading, n.Bytes()...)
+	return append(leading, n.Bytes()...), nil
 }
@@ -23,3 +23,17 @@ func TestBase58(t *testing.T) {
 		assert.Equal(t, p, pp)
 	}
 }
+
+func TestDecodeString(t *testing.T) {
+	p, err := base58.DecodeString(base58.Encode([]byte("trololo")))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("trololo"), p)
+
+	_, err = base58.DecodeString("tr0lolo")
+	assert.EqualError(t, err, "illegal base58 data at input index: 2")
+
+	_, err = base58.DecodeString("trololé")
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { base58.Decode("tr0lolo") })
+}
@@ -14,12 +14,23 @@ type ChunkedConn struct {
 // NewChunkedConn returns a noise chunked stream.
 // Given stream is encrypted by chunks of 0xFFFF max size.
 func NewChunkedConn(c net.Conn, cipher Cipher) net.Conn {
+	return NewChunkedConnWithOptions(c, cipher, StreamOptions{})
+}
+
+// NewChunkedConnWithOptions returns a noise chunked stream using the given options.
+// Given stream is encrypted by chunks of 0xFFFF max size.
+func NewChunkedConnWithOptions(c net.Conn, cipher Cipher, options StreamOptions) net.Conn {
 	return &ChunkedConn{
 		Conn: c,
-		cs:   NewChunkedStream(c, cipher),
+		cs:   NewChunkedStreamWithOptions(c, cipher, options),
 	}
 }
 
+// NetConn returns the underlying connection.
+func (c *ChunkedConn) NetConn() net.Conn {
+	return c.Conn
+}
+
 func (c *ChunkedConn) Read(p []byte) (n int, err error) {
 	return c.cs.Read(p)
 }
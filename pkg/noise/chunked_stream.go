@@ -4,41 +4,121 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"sync"
+	"time"
 )
 
 // nrekey is the n chunks before rekeying the stream.
 // It must be a power of 2 minus 1 because we use bitwise-and to compute modulus for more performance.
 const nrekey = 16<<10 - 1
 
+// A RekeyPolicy defines when a ChunkedStream rekeys its sending cipher, in addition to the implicit rekey every 16k chunks.
+// Each rekey is announced to the peer by a control message. A zero field disables its trigger.
+type RekeyPolicy struct {
+	// Interval is the maximum duration between two rekeys, checked when writing.
+	Interval time.Duration
+	// Bytes is the maximum number of bytes encrypted between two rekeys.
+	Bytes uint64
+	// Chunks is the maximum number of chunks encrypted between two rekeys.
+	Chunks uint64
+}
+
+// A StreamOptions describes the options of a ChunkedStream.
+// The peer must support control messages when any of them is set.
+type StreamOptions struct {
+	Rekey RekeyPolicy
+	// Rehandshake is the interval between two full handshakes performed over the stream, disabled when zero.
+	// It requires a Cipher returned by Handshake. The responder of the handshake asks the initiator to perform it.
+	Rehandshake time.Duration
+	// Obfuscation hides the size of the chunks, both peers must use it.
+	Obfuscation Obfuscation
+}
+
 // A ChunkedStream is able to encrypt/decrypt a stream by using chunked encryption.
+//
+// An empty chunk announces a control message in the next chunk (explicit rekey, re-handshake).
+// Control messages are only sent when enabled by the StreamOptions, but they are always handled.
 type ChunkedStream struct {
 	stream  io.ReadWriter
-	cipher  Cipher
+	options StreamOptions
 	maxsize int
-	bufw    []byte
-	iw      uint64
+
+	wmu        sync.Mutex // Guards the writing side.
+	wcipher    Cipher
+	bufw       []byte
+	iw         uint64
+	rekeyed    time.Time
+	nbytes     uint64
+	nchunks    uint64
+	handshaked time.Time
+	written    time.Time
+	cover      *time.Timer
+
+	rcipher Cipher
 	bufr    []byte
 	ir      uint64
 	chunk   []byte
+
+	hmu     sync.Mutex // Guards the re-handshake state.
+	session *cipher
+	rh      *rehandshake
 }
 
 // NewChunkedStream returns a noise chunked stream.
 // Given stream is encrypted by chunks of 0xFFFF max size.
 func NewChunkedStream(stream io.ReadWriter, cipher Cipher) io.ReadWriter {
-	return &ChunkedStream{
-		stream:  stream,
-		cipher:  cipher,
-		maxsize: ChunkSize - cipher.Overhead(),
-		bufw:    make([]byte, 0, ChunkSize+SizePrefixLength),
-		bufr:    make([]byte, 0, ChunkSize),
+	return NewChunkedStreamWithOptions(stream, cipher, StreamOptions{})
+}
+
+// NewChunkedStreamWithOptions returns a noise chunked stream using the given options.
+// Given stream is encrypted by chunks of 0xFFFF max size.
+func NewChunkedStreamWithOptions(stream io.ReadWriter, cipher Cipher, options StreamOptions) io.ReadWriter {
+	now := time.Now()
+	c := &ChunkedStream{
+		stream:     stream,
+		options:    options,
+		maxsize:    ChunkSize - cipher.Overhead(),
+		wcipher:    cipher,
+		bufw:       make([]byte, 0, SizePrefixLength+cipher.Overhead()+ChunkSize),
+		rekeyed:    now,
+		handshaked: now,
+		written:    now,
+		rcipher:    cipher,
+		bufr:       make([]byte, 0, ChunkSize),
+	}
+	c.session = session(cipher)
+
+	if options.Obfuscation.Enabled {
+		c.maxsize -= SizePrefixLength // Size of the data inside the padded plaintext
+
+		if options.Obfuscation.Cover > 0 {
+			c.wmu.Lock()
+			c.cover = time.AfterFunc(coverDelay(options.Obfuscation.Cover), c.sendCover)
+			c.wmu.Unlock()
+		}
 	}
+
+	return c
 }
 
 func (c *ChunkedStream) Read(p []byte) (n int, err error) {
-	if len(c.chunk) == 0 {
+	for len(c.chunk) == 0 {
 		if err = c.read(); err != nil {
 			return 0, err
 		}
+
+		if len(c.chunk) == 0 {
+			// Control message
+			if err = c.read(); err != nil {
+				return 0, err
+			}
+
+			err = c.control(c.chunk)
+			c.chunk = c.chunk[:0]
+			if err != nil {
+				return 0, err
+			}
+		}
 	}
 
 	l := len(p)
@@ -59,14 +139,18 @@ func (c *ChunkedStream) Read(p []byte) (n int, err error) {
 func (c *ChunkedStream) read() (err error) {
 	c.ir++
 	if c.ir&nrekey == 0 {
-		c.cipher.DecryptRekey()
+		c.rcipher.DecryptRekey()
+	}
+
+	if c.options.Obfuscation.Enabled {
+		return c.readObfuscated()
 	}
 
 	//
 
 	c.chunk = c.bufr[:]
 
-	_, err = c.stream.Read(c.chunk[:SizePrefixLength])
+	_, err = io.ReadFull(c.stream, c.chunk[:SizePrefixLength])
 	if err != nil {
 		return err
 	}
@@ -85,7 +169,7 @@ func (c *ChunkedStream) read() (err error) {
 		return errors.New("invalid read length")
 	}
 
-	chunk, err := c.cipher.Decrypt(c.chunk[:0], nil, c.chunk[:n])
+	chunk, err := c.rcipher.Decrypt(c.chunk[:0], nil, c.chunk[:n])
 	if err != nil {
 		return err
 	}
@@ -94,6 +178,13 @@ func (c *ChunkedStream) read() (err error) {
 }
 
 func (c *ChunkedStream) Write(p []byte) (n int, err error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if err = c.rehandshakeIfDue(); err != nil {
+		return 0, err
+	}
+
 	remaining := len(p)
 	var limit int
 	var nn int
@@ -102,6 +193,12 @@ func (c *ChunkedStream) Write(p []byte) (n int, err error) {
 	for remaining > 0 {
 		limit = min(remaining, c.maxsize)
 
+		if c.rekeyDue() {
+			if err = c.rekey(); err != nil {
+				return n, err
+			}
+		}
+
 		nn, err = c.write(p[n : n+limit])
 		if err != nil {
 			return n, err
@@ -109,16 +206,58 @@ func (c *ChunkedStream) Write(p []byte) (n int, err error) {
 
 		remaining -= nn
 		n += nn
+		c.nbytes += uint64(nn)
+		c.nchunks++
 	}
+	c.written = time.Now()
 
 	return n, nil
 }
 
+// rekeyDue returns true when the rekey policy is reached.
+func (c *ChunkedStream) rekeyDue() bool {
+	policy := c.options.Rekey
+	return policy.Interval > 0 && time.Since(c.rekeyed) >= policy.Interval ||
+		policy.Bytes > 0 && c.nbytes >= policy.Bytes ||
+		policy.Chunks > 0 && c.nchunks >= policy.Chunks
+}
+
+// rekey rekeys the sending cipher and tells the peer to do the same.
+func (c *ChunkedStream) rekey() error {
+	if err := c.writeControl(controlRekey, nil); err != nil {
+		return err
+	}
+
+	c.wcipher.EncryptRekey()
+	c.resetRekey()
+	return nil
+}
+
+func (c *ChunkedStream) resetRekey() {
+	c.rekeyed = time.Now()
+	c.nbytes = 0
+	c.nchunks = 0
+}
+
+// writeControl writes an empty chunk followed by the given control message.
+func (c *ChunkedStream) writeControl(kind byte, payload []byte) error {
+	if _, err := c.write(nil); err != nil {
+		return err
+	}
+
+	_, err := c.write(append([]byte{kind}, payload...))
+	return err
+}
+
 // write a chunk
 func (c *ChunkedStream) write(p []byte) (n int, err error) {
 	c.iw++
 	if c.iw&nrekey == 0 {
-		c.cipher.EncryptRekey()
+		c.wcipher.EncryptRekey()
+	}
+
+	if c.options.Obfuscation.Enabled {
+		return c.writeObfuscated(p)
 	}
 
 	//
@@ -126,7 +265,7 @@ func (c *ChunkedStream) write(p []byte) (n int, err error) {
 	n = len(p)
 	chunk := c.bufw[:SizePrefixLength]
 
-	p, err = c.cipher.Encrypt(chunk[SizePrefixLength:], nil, p)
+	p, err = c.wcipher.Encrypt(chunk[SizePrefixLength:], nil, p)
 	if err != nil {
 		return 0, err
 	}
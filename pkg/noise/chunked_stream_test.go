@@ -3,7 +3,9 @@ package noise_test
 import (
 	"bytes"
 	"crypto/rand"
+	"io"
 	mrand "math/rand"
+	"sync"
 	"testing"
 	"time"
 
@@ -95,3 +97,306 @@ func TestChunkedStream(t *testing.T) {
 
 	<-next
 }
+
+func TestChunkedStream_Rekey(t *testing.T) {
+	policies := []noise.RekeyPolicy{
+		{Chunks: 1},
+		{Bytes: 1000},
+		{Interval: time.Nanosecond},
+		{Interval: time.Millisecond, Bytes: 100 << 10, Chunks: 7},
+	}
+
+	for _, policy := range policies {
+		exchange(t, noise.StreamOptions{Rekey: policy}, func(bool) noise.HandshakeOptions {
+			return noise.HandshakeOptions{Pattern: noise.PatternIK}
+		})
+	}
+}
+
+func TestChunkedStream_Rehandshake(t *testing.T) {
+	psk := make([]byte, noise.PresharedKeySize)
+	psk[0] = 42
+
+	patterns := []noise.HandshakeOptions{
+		{Pattern: noise.PatternIK},
+		{Pattern: noise.PatternXX},
+		{Pattern: noise.PatternIKpsk2, PresharedKey: psk, Hybrid: true},
+		{Pattern: noise.PatternNNpsk0, PresharedKey: psk},
+	}
+
+	for _, pattern := range patterns {
+		options := noise.StreamOptions{
+			Rekey:       noise.RekeyPolicy{Chunks: 3},
+			Rehandshake: time.Nanosecond,
+		}
+
+		s1, c1, s2, c2 := exchange(t, options, func(initiator bool) noise.HandshakeOptions {
+			return pattern
+		})
+		assert.NotSame(t, c1, noise.WriteCipher(s1), "alice")
+		assert.NotSame(t, c2, noise.WriteCipher(s2), "bob")
+	}
+}
+
+func TestChunkedStream_Obfuscation(t *testing.T) {
+	obfuscations := []noise.Obfuscation{
+		{Enabled: true},
+		{Enabled: true, Padding: noise.PaddingRandom},
+		{Enabled: true, Padding: noise.PaddingBucket, Cover: time.Millisecond},
+	}
+
+	for _, obfuscation := range obfuscations {
+		options := noise.StreamOptions{
+			Rekey:       noise.RekeyPolicy{Chunks: 5},
+			Rehandshake: time.Millisecond,
+			Obfuscation: obfuscation,
+		}
+
+		exchange(t, options, func(bool) noise.HandshakeOptions {
+			return noise.HandshakeOptions{Pattern: noise.PatternIK}
+		})
+	}
+}
+
+func TestChunkedStream_ObfuscationSizes(t *testing.T) {
+	c1, c2 := ciphers(t)
+	options := noise.StreamOptions{
+		Obfuscation: noise.Obfuscation{Enabled: true, Padding: noise.PaddingBucket},
+	}
+
+	wire := new(recorder)
+	w := noise.NewChunkedStreamWithOptions(wire, c1, options)
+	r := noise.NewChunkedStreamWithOptions(wire, c2, options)
+
+	for _, size := range []int{1, 10, 254, 255, 1000, 0xFFFF} {
+		expected := make([]byte, size)
+		_, err := rand.Read(expected)
+		assert.NoError(t, err)
+
+		_, err = w.Write(expected)
+		assert.NoError(t, err)
+
+		actual := make([]byte, size)
+		_, err = io.ReadFull(r, actual)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	// Encrypted size (2+16) and encrypted payload rounded to the bucket (+16)
+	assert.Equal(t, []int{
+		18 + 256 + 16,
+		18 + 256 + 16,
+		18 + 256 + 16,
+		18 + 512 + 16,
+		18 + 1024 + 16,
+		18 + 0xFFFF,   // Full chunk
+		18 + 256 + 16, // Remaining bytes
+	}, wire.sizes)
+}
+
+func TestChunkedStream_ObfuscationTampered(t *testing.T) {
+	for _, obfuscated := range []bool{false, true} {
+		for _, offset := range []int{0, 1, 20, 40} {
+			c1, c2 := ciphers(t)
+			options := noise.StreamOptions{
+				Obfuscation: noise.Obfuscation{Enabled: obfuscated, Padding: noise.PaddingRandom},
+			}
+
+			wire := new(recorder)
+			w := noise.NewChunkedStreamWithOptions(wire, c1, options)
+			r := noise.NewChunkedStreamWithOptions(wire, c2, options)
+
+			_, err := w.Write(make([]byte, 64))
+			assert.NoError(t, err)
+
+			wire.Bytes()[offset] ^= 0x01
+
+			_, err = io.ReadFull(r, make([]byte, 64))
+			assert.Error(t, err, "obfuscated=%v offset=%d", obfuscated, offset)
+		}
+	}
+}
+
+// ciphers returns the ciphers of both sides of a handshake.
+func ciphers(t *testing.T) (noise.Cipher, noise.Cipher) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+
+	conn := stream.NewBidirectional()
+	defer conn.Close()
+
+	options := func(sender, recipient *noise.X25519Identity) noise.HandshakeOptions {
+		public := recipient.PublicKey()
+		return noise.HandshakeOptions{
+			Pattern:   noise.PatternIK,
+			Hash:      noise.HashBlake2b,
+			Cipher:    noise.CipherChaCha20Poly1305,
+			Sender:    sender,
+			Recipient: &public,
+		}
+	}
+
+	cipherc := make(chan noise.Cipher, 1)
+	go func() {
+		c, err := noise.Handshake(conn.C1, options(alice, bob), false)
+		assert.NoError(t, err)
+		cipherc <- c
+	}()
+
+	c2, err := noise.Handshake(conn.C2, options(bob, alice), true)
+	assert.NoError(t, err)
+
+	return <-cipherc, c2
+}
+
+// A recorder is a buffer recording the size of each write.
+type recorder struct {
+	bytes.Buffer
+	sizes []int
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return r.Buffer.Write(p)
+}
+
+// exchange sends random messages in both directions over chunked streams using the given options.
+// It returns the streams and the ciphers of the initial handshake.
+func exchange(t *testing.T, options noise.StreamOptions, pattern func(initiator bool) noise.HandshakeOptions) (io.ReadWriter, noise.Cipher, io.ReadWriter, noise.Cipher) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+
+	conn := stream.NewBidirectional()
+	defer conn.Close()
+
+	handshake := func(c io.ReadWriter, sender, recipient *noise.X25519Identity, initiator bool) noise.Cipher {
+		ho := pattern(initiator)
+		ho.Hash = noise.HashBlake2b
+		ho.Cipher = noise.CipherChaCha20Poly1305
+		ho.Sender = sender
+		public := recipient.PublicKey()
+		ho.Recipient = &public
+
+		cipher, err := noise.Handshake(c, ho, initiator != (ho.Pattern == noise.PatternXX))
+		assert.NoError(t, err)
+		return cipher
+	}
+
+	cipherc := make(chan noise.Cipher, 1)
+	go func() {
+		cipherc <- handshake(conn.C1, alice, bob, false)
+	}()
+	c2 := handshake(conn.C2, bob, alice, true)
+	c1 := <-cipherc
+
+	s1 := noise.NewChunkedStreamWithOptions(conn.C1, c1, options)
+	s2 := noise.NewChunkedStreamWithOptions(conn.C2, c2, options)
+
+	//
+
+	// Both peers keep reading in order to handle the control messages of the re-handshakes.
+	transfer := func(w, r io.ReadWriter, wg *sync.WaitGroup) {
+		var expected []byte
+		for range 100 {
+			message := make([]byte, 1+mrand.Intn(5000))
+			_, err := rand.Read(message)
+			assert.NoError(t, err)
+			expected = append(expected, message...)
+		}
+
+		wg.Go(func() {
+			for p := expected; len(p) > 0; {
+				n := min(len(p), 1+mrand.Intn(5000))
+				_, err := w.Write(p[:n])
+				assert.NoError(t, err)
+				p = p[n:]
+
+				time.Sleep(100 * time.Microsecond)
+			}
+		})
+
+		wg.Add(1)
+		go func() {
+			actual := make([]byte, len(expected))
+			_, err := io.ReadFull(r, actual)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+			wg.Done()
+
+			io.Copy(io.Discard, r) // Until closed
+		}()
+	}
+
+	var wg sync.WaitGroup
+	transfer(s1, s2, &wg)
+	transfer(s2, s1, &wg)
+	wg.Wait()
+
+	return s1, c1, s2, c2
+}
+
+func BenchmarkChunkedStream(b *testing.B) {
+	suites := []struct {
+		name   string
+		cipher noise.CipherFunction
+		hash   noise.HashFunction
+	}{
+		{name: "ChaCha20Poly1305_BLAKE2b", cipher: noise.CipherChaCha20Poly1305, hash: noise.HashBlake2b},
+		{name: "ChaCha20Poly1305_BLAKE2s", cipher: noise.CipherChaCha20Poly1305, hash: noise.HashBlake2s},
+		{name: "AES256GCM_BLAKE2b", cipher: noise.CipherAES256GCM, hash: noise.HashBlake2b},
+		{name: "AES256GCM_BLAKE2s", cipher: noise.CipherAES256GCM, hash: noise.HashBlake2s},
+	}
+
+	for _, suite := range suites {
+		b.Run(suite.name, func(b *testing.B) {
+			alice := noise.GenerateX25519Identity()
+			bob := noise.GenerateX25519Identity()
+
+			conn := stream.NewBidirectional()
+			defer conn.Close()
+
+			options := func(sender *noise.X25519Identity, recipient noise.X25519Recipient) noise.HandshakeOptions {
+				return noise.HandshakeOptions{
+					Pattern:   noise.PatternIK,
+					Hash:      suite.hash,
+					Cipher:    suite.cipher,
+					Sender:    sender,
+					Recipient: &recipient,
+				}
+			}
+
+			cipherc := make(chan noise.Cipher, 1)
+			go func() {
+				c, err := noise.Handshake(conn.C1, options(alice, bob.PublicKey()), false)
+				assert.NoError(b, err, "alice")
+				cipherc <- c
+			}()
+
+			c, err := noise.Handshake(conn.C2, options(bob, alice.PublicKey()), true)
+			assert.NoError(b, err, "bob")
+
+			s1 := noise.NewChunkedStream(conn.C1, <-cipherc)
+			s2 := noise.NewChunkedStream(conn.C2, c)
+
+			payload := make([]byte, 32<<10)
+			_, err = rand.Read(payload)
+			assert.NoError(b, err)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := io.CopyN(io.Discard, s2, int64(b.N*len(payload)))
+				done <- err
+			}()
+
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+
+			for range b.N {
+				if _, err := s1.Write(payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+			assert.NoError(b, <-done)
+		})
+	}
+}
@@ -16,6 +16,9 @@ type (
 		overhead int
 		tx       *noise.CipherState
 		tr       *noise.CipherState
+		// next holds the options of a re-handshake with the same peer.
+		next      *HandshakeOptions
+		initiator bool
 	}
 )
 
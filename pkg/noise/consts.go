@@ -5,9 +5,16 @@ type HandshakePattern uint8
 
 // Supported patterns.
 const (
-	PatternIK HandshakePattern = 0x01
+	PatternIK     HandshakePattern = 0x01
+	PatternXX     HandshakePattern = 0x02
+	PatternIKpsk2 HandshakePattern = 0x03
+	// PatternNNpsk0 authenticates both peers with the pre-shared key only (e.g. a session resumption).
+	PatternNNpsk0 HandshakePattern = 0x04
 )
 
+// PresharedKeySize is the size of a pre-shared symmetric key.
+const PresharedKeySize = 32
+
 // An HashFunction is a cryptographic hash function.
 type HashFunction uint8
 
@@ -0,0 +1,12 @@
+package noise
+
+import "io"
+
+// WriteCipher for test purpose.
+func WriteCipher(s io.ReadWriter) Cipher {
+	c := s.(*ChunkedStream)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	return c.wcipher
+}
@@ -1,6 +1,7 @@
 package noise
 
 import (
+	"crypto/subtle"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -24,8 +25,32 @@ type HandshakeOptions struct {
 
 	//
 
-	Sender    *X25519Identity
+	Sender *X25519Identity
+	// Recipient is the known static key of the peer.
+	// It is optional when VerifyPeer is provided and the peer sends its static key during the handshake
+	// (XX pattern or IK responder).
 	Recipient *X25519Recipient
+	// VerifyPeer is called with the static key received from the peer, before sending anything else.
+	// The handshake fails if it returns an error.
+	VerifyPeer func(peer X25519PublicKey) error
+	// PresharedKey is the symmetric key shared by both peers, required by the IKpsk2 and NNpsk0 patterns.
+	PresharedKey []byte
+	// PresharedKeyOf returns the pre-shared key of the peer once its static key is received and verified.
+	// It replaces PresharedKey for an IKpsk2 responder that does not know its peer before the handshake.
+	PresharedKeyOf func(peer X25519PublicKey) ([]byte, error)
+	// Hybrid combines the X25519 key exchange with an ML-KEM-768 encapsulation (IK and IKpsk2 patterns only).
+	// Both peers must use the same mode.
+	Hybrid bool
+
+	// ChannelBinding is mixed into the prologue.
+	// The handshake fails if both peers do not share the same underlying secure channel.
+	ChannelBinding []byte
+
+	// Payload is sent encrypted to the peer in the last handshake message written by the sender.
+	Payload []byte
+	// ReceivePayload is called with the payload of the last handshake message written by the peer (empty if none).
+	// The handshake fails if it returns an error.
+	ReceivePayload func(payload []byte) error
 }
 
 // Validate checks if the options are valid.
@@ -33,10 +58,26 @@ func (o *HandshakeOptions) Validate() error {
 	switch o.Pattern {
 	case PatternIK:
 		o.pattern = noise.HandshakeIK
+	case PatternXX:
+		o.pattern = noise.HandshakeXX
+	case PatternIKpsk2:
+		o.pattern = noise.HandshakeIK
+		if o.PresharedKeyOf == nil && len(o.PresharedKey) != PresharedKeySize {
+			return errors.New("invalid preshared key")
+		}
+	case PatternNNpsk0:
+		o.pattern = noise.HandshakeNN
+		if len(o.PresharedKey) != PresharedKeySize {
+			return errors.New("invalid preshared key")
+		}
 	default:
 		return errors.New("unsupported pattern")
 	}
 
+	if o.Hybrid && o.Pattern != PatternIK && o.Pattern != PatternIKpsk2 {
+		return errors.New("hybrid mode requires the IK pattern")
+	}
+
 	//
 
 	switch o.Hash {
@@ -63,6 +104,10 @@ func (o *HandshakeOptions) Validate() error {
 
 	//
 
+	if o.Pattern == PatternNNpsk0 {
+		return nil // No static keys
+	}
+
 	if o.Sender == nil {
 		return errors.New("sender not provided")
 	}
@@ -78,6 +123,9 @@ func (o *HandshakeOptions) Validate() error {
 	//
 
 	if o.Recipient == nil {
+		if o.VerifyPeer != nil {
+			return nil
+		}
 		return errors.New("recipient not provided")
 	}
 
@@ -102,6 +150,12 @@ type handshake struct {
 	stream    io.ReadWriter
 	overhead  int
 	buf       []byte
+	verify    func(peer []byte) error
+	resolve   func(peer []byte) ([]byte, error)
+	psk       []byte
+	hybrid    *hybrid
+	payload   []byte
+	receive   func(payload []byte) error
 }
 
 // Handshake performs the handshake for X25519Identity sender and recipient using given stream.
@@ -119,20 +173,45 @@ func Handshake(stream io.ReadWriter, options HandshakeOptions, initiator bool) (
 		return nil, err
 	}
 
-	dhKey := noise.DHKey{
-		Private: options.Sender.PrivateKey(),
-		Public:  options.Sender.PublicKey(),
+	var dhKey noise.DHKey
+	if options.Sender != nil {
+		dhKey.Private = options.Sender.PrivateKey()
+		dhKey.Public = options.Sender.PublicKey()
 	}
 
-	prePeerStatic := (initiator && options.pattern.InitiatorPreMessages == nil) || (!initiator && options.pattern.ResponderPreMessages == nil)
+	// The peer static key is known before the handshake or received during it.
+	prePeerStatic := (initiator && options.pattern.ResponderPreMessages != nil) || (!initiator && options.pattern.InitiatorPreMessages != nil)
+	if prePeerStatic && options.Recipient == nil {
+		return nil, errors.New("recipient not provided")
+	}
+	// The pre-shared key is resolved once the peer static key is received.
+	resolve := options.Pattern == PatternIKpsk2 && options.PresharedKey == nil && !prePeerStatic
+
+	prologue := []byte("seikan/1.0")
+	if options.Hybrid {
+		prologue = append(prologue, hybridPrologue...)
+	}
 
 	config := noise.Config{
 		CipherSuite:   noise.NewCipherSuite(noise.DH25519, options.cipher, options.hash),
 		Pattern:       options.pattern,
 		Initiator:     initiator,
-		Prologue:      []byte("seikan/1.0"),
+		Prologue:      append(prologue, options.ChannelBinding...),
 		StaticKeypair: dhKey,
 	}
+	switch options.Pattern {
+	case PatternIKpsk2:
+		config.PresharedKey = options.PresharedKey
+		config.PresharedKeyPlacement = 2
+	case PatternNNpsk0:
+		config.PresharedKey = options.PresharedKey
+		config.PresharedKeyPlacement = 0
+	}
+	if options.Hybrid {
+		// The pre-shared key is set once encapsulated.
+		config.PresharedKey = nil
+		config.PresharedKeyPlacement = 2
+	}
 	if prePeerStatic {
 		config.PeerStatic = *options.Recipient
 	}
@@ -149,35 +228,86 @@ func Handshake(stream io.ReadWriter, options HandshakeOptions, initiator bool) (
 		stream:    stream,
 		overhead:  options.overhead,
 		buf:       make([]byte, SizePrefixLength+noise.MaxMsgLen),
+		psk:       options.PresharedKey,
+		payload:   options.Payload,
+		receive:   options.ReceivePayload,
+	}
+	if resolve {
+		h.resolve = func(peer []byte) ([]byte, error) {
+			psk, err := options.PresharedKeyOf(X25519PublicKey(peer))
+			if err != nil {
+				return nil, err
+			}
+			if len(psk) != PresharedKeySize {
+				return nil, errors.New("invalid preshared key")
+			}
+			return psk, nil
+		}
 	}
+	if options.Hybrid {
+		var psk []byte
+		if options.Pattern == PatternIKpsk2 {
+			psk = options.PresharedKey
+		}
 
-	var cipher Cipher
+		h.hybrid, err = newHybrid(initiator, psk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !prePeerStatic {
+		h.verify = func(peer []byte) error {
+			if options.Recipient != nil && subtle.ConstantTimeCompare(peer, *options.Recipient) != 1 {
+				return errors.New("invalid peer")
+			}
+			if options.VerifyPeer != nil {
+				return options.VerifyPeer(X25519PublicKey(peer))
+			}
+			return nil
+		}
+	}
+
+	var c *cipher
 	if h.initiator {
-		cipher, err = h.begin(stream)
+		c, err = h.begin(stream)
 	} else {
-		cipher, err = h.wait(stream)
+		c, err = h.wait(stream)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	if !prePeerStatic {
-		err := errors.New("invalid peer")
-		peer := h.state.PeerStatic()
+	// The peer static key is known by both sides, following handshakes use the IK pattern.
+	// Without static keys (NNpsk0), they use the same pre-shared key.
+	next := options
+	if next.Pattern == PatternXX {
+		next.Pattern = PatternIK
+	}
+	if next.Pattern != PatternNNpsk0 {
+		peer := X25519Recipient(state.PeerStatic())
+		next.Recipient = &peer
+	}
+	next.VerifyPeer = nil
+	next.PresharedKey = h.psk
+	next.PresharedKeyOf = nil
+	next.ChannelBinding = state.ChannelBinding()
+	next.Payload = nil
+	next.ReceivePayload = nil
 
-		if len(peer) != len(*options.Recipient) {
-			return nil, err
-		}
+	c.next = &next
+	c.initiator = initiator
 
-		for i, b := range *options.Recipient {
-			if peer[i] != b {
-				return nil, err
-			}
-		}
-	}
+	return c, nil
+}
 
-	return cipher, nil
+// lastMessage returns the index of the last message written by the initiator or the responder of the given pattern.
+func lastMessage(pattern noise.HandshakePattern, initiator bool) int {
+	i := len(pattern.Messages) - 1
+	if (i%2 == 0) != initiator {
+		i--
+	}
+	return i
 }
 
 // Finished indicate whether handshake is completed.
@@ -185,7 +315,7 @@ func (h *handshake) Finished() bool {
 	return h.state.MessageIndex() == len(h.pattern.Messages)
 }
 
-func (h *handshake) begin(stream io.ReadWriter) (Cipher, error) {
+func (h *handshake) begin(stream io.ReadWriter) (*cipher, error) {
 	var err error
 	cipher := &cipher{
 		overhead: h.overhead,
@@ -210,7 +340,7 @@ func (h *handshake) begin(stream io.ReadWriter) (Cipher, error) {
 	}
 }
 
-func (h *handshake) wait(stream io.ReadWriter) (Cipher, error) {
+func (h *handshake) wait(stream io.ReadWriter) (*cipher, error) {
 	var err error
 	cipher := &cipher{
 		overhead: h.overhead,
@@ -239,27 +369,87 @@ func (h *handshake) read() (*noise.CipherState, *noise.CipherState, error) {
 	buf := h.buf[:]
 
 	// Read message length
-	_, err := h.stream.Read(buf[:SizePrefixLength])
+	_, err := io.ReadFull(h.stream, buf[:SizePrefixLength])
 	if err != nil {
 		return nil, nil, err
 	}
 	n := binary.BigEndian.Uint16(buf[:SizePrefixLength])
 
 	// Read message
-	_, err = h.stream.Read(buf[:n])
+	_, err = io.ReadFull(h.stream, buf[:n])
 	if err != nil {
 		return nil, nil, err
 	}
+	message := buf[:n]
 
-	_, cs0, cs1, err := h.state.ReadMessage(nil, buf[:n])
-	return cs0, cs1, err
+	index := h.state.MessageIndex()
+	if h.hybrid != nil && h.initiator && index == 1 {
+		message, err = h.hybrid.decapsulate(h.state, message)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	payload, cs0, cs1, err := h.state.ReadMessage(nil, message)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Verify the peer as soon as its static key is received.
+	if h.verify != nil && len(h.state.PeerStatic()) > 0 {
+		verify := h.verify
+		h.verify = nil
+		if err = verify(h.state.PeerStatic()); err != nil {
+			return nil, nil, err
+		}
+
+		if h.resolve != nil {
+			if h.psk, err = h.resolve(h.state.PeerStatic()); err != nil {
+				return nil, nil, err
+			}
+			if h.hybrid != nil {
+				h.hybrid.psk = h.psk
+			} else if err = h.state.SetPresharedKey(h.psk); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if h.hybrid != nil && !h.initiator && index == 0 {
+		if payload, err = h.hybrid.encapsulate(h.state, payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if h.receive != nil && index == lastMessage(h.pattern, !h.initiator) {
+		if err = h.receive(payload); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return cs0, cs1, nil
 }
 
 func (h *handshake) write() (*noise.CipherState, *noise.CipherState, error) {
 	buf := h.buf[:SizePrefixLength]
 
+	index := h.state.MessageIndex()
+
+	var prefix, payload []byte
+	if h.hybrid != nil {
+		switch index {
+		case 0:
+			payload = h.hybrid.payload()
+		case 1:
+			prefix = h.hybrid.ciphertext
+		}
+	}
+	if index == lastMessage(h.pattern, h.initiator) {
+		payload = append(payload, h.payload...)
+	}
+
 	// Generate message
-	message, cs0, cs1, err := h.state.WriteMessage(buf[SizePrefixLength:], nil)
+	message, cs0, cs1, err := h.state.WriteMessage(append(buf[SizePrefixLength:], prefix...), payload)
 	if err != nil {
 		return cs0, cs1, err
 	}
@@ -1,6 +1,7 @@
 package noise_test
 
 import (
+	"errors"
 	"io"
 	"testing"
 
@@ -32,6 +33,49 @@ func TestHandshakeOptions_Validate(t *testing.T) {
 	options.Hash = noise.HashBlake2s
 	options.Cipher = noise.CipherAES256GCM
 	assert.NoError(t, options.Validate())
+
+	//
+
+	options.Pattern = noise.PatternXX
+	options.Recipient = nil
+	assert.EqualError(t, options.Validate(), "recipient not provided")
+
+	options.VerifyPeer = func(noise.X25519PublicKey) error { return nil }
+	assert.NoError(t, options.Validate())
+
+	//
+
+	options.Pattern = noise.PatternIKpsk2
+	options.Recipient = &public
+	assert.EqualError(t, options.Validate(), "invalid preshared key")
+
+	options.PresharedKey = make([]byte, noise.PresharedKeySize)
+	assert.NoError(t, options.Validate())
+
+	options.PresharedKey = nil
+	options.PresharedKeyOf = func(noise.X25519PublicKey) ([]byte, error) { return nil, nil }
+	options.Recipient = nil
+	assert.NoError(t, options.Validate())
+
+	options.PresharedKey = make([]byte, noise.PresharedKeySize)
+	options.PresharedKeyOf = nil
+	options.Recipient = &public
+
+	//
+
+	options.Hybrid = true
+	assert.NoError(t, options.Validate())
+
+	options.Pattern = noise.PatternXX
+	assert.EqualError(t, options.Validate(), "hybrid mode requires the IK pattern")
+
+	//
+
+	options = noise.HandshakeOptions{Pattern: noise.PatternNNpsk0, Hash: noise.HashBlake2b, Cipher: noise.CipherChaCha20Poly1305}
+	assert.EqualError(t, options.Validate(), "invalid preshared key")
+
+	options.PresharedKey = make([]byte, noise.PresharedKeySize)
+	assert.NoError(t, options.Validate())
 }
 
 func TestHandshake(t *testing.T) {
@@ -86,6 +130,296 @@ func TestHandshake(t *testing.T) {
 	assert.Equal(t, alice2bob, message)
 }
 
+func TestHandshake_XX(t *testing.T) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+
+	conn := stream.NewBidirectional()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		recipient := bob.PublicKey()
+		options := noise.HandshakeOptions{
+			Pattern:   noise.PatternXX,
+			Hash:      noise.HashBlake2b,
+			Cipher:    noise.CipherChaCha20Poly1305,
+			Sender:    alice,
+			Recipient: &recipient,
+		}
+
+		c, err := noise.Handshake(conn.C1, options, false)
+		assert.NoError(t, err, "alice")
+
+		err = send(conn.C1, c, "popo!")
+		assert.NoError(t, err, "alice")
+	}()
+
+	//
+
+	var peer noise.X25519PublicKey
+	options := noise.HandshakeOptions{
+		Pattern: noise.PatternXX,
+		Hash:    noise.HashBlake2b,
+		Cipher:  noise.CipherChaCha20Poly1305,
+		Sender:  bob,
+		VerifyPeer: func(p noise.X25519PublicKey) error {
+			peer = p
+			return nil
+		},
+	}
+
+	c, err := noise.Handshake(conn.C2, options, true)
+	assert.NoError(t, err, "bob")
+	assert.Equal(t, alice.PublicKey(), peer)
+
+	message, err := receive(conn.C2, c)
+	assert.NoError(t, err, "bob")
+	assert.Equal(t, "popo!", message)
+	<-done
+}
+
+func TestHandshake_XXRejected(t *testing.T) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+
+	conn := stream.NewBidirectional()
+
+	go func() {
+		options := noise.HandshakeOptions{
+			Pattern: noise.PatternXX,
+			Hash:    noise.HashBlake2b,
+			Cipher:  noise.CipherChaCha20Poly1305,
+			Sender:  alice,
+			VerifyPeer: func(noise.X25519PublicKey) error {
+				return nil
+			},
+		}
+
+		noise.Handshake(conn.C1, options, false)
+		conn.C1.Close()
+	}()
+
+	//
+
+	errUnknown := errors.New("unknown peer")
+	options := noise.HandshakeOptions{
+		Pattern: noise.PatternXX,
+		Hash:    noise.HashBlake2b,
+		Cipher:  noise.CipherChaCha20Poly1305,
+		Sender:  bob,
+		VerifyPeer: func(noise.X25519PublicKey) error {
+			return errUnknown
+		},
+	}
+
+	_, err := noise.Handshake(conn.C2, options, true)
+	assert.ErrorIs(t, err, errUnknown)
+}
+
+func TestHandshake_IKpsk2(t *testing.T) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+
+	psk := make([]byte, noise.PresharedKeySize)
+	psk[0] = 42
+
+	handshake := func(alicePSK, bobPSK []byte) (error, error) {
+		conn := stream.NewBidirectional()
+
+		errc := make(chan error, 1)
+		go func() {
+			recipient := bob.PublicKey()
+			options := noise.HandshakeOptions{
+				Pattern:      noise.PatternIKpsk2,
+				Hash:         noise.HashBlake2b,
+				Cipher:       noise.CipherChaCha20Poly1305,
+				Sender:       alice,
+				Recipient:    &recipient,
+				PresharedKey: alicePSK,
+			}
+
+			c, err := noise.Handshake(conn.C1, options, false)
+			if err == nil {
+				err = send(conn.C1, c, "popo!")
+			}
+			conn.C1.Close()
+			errc <- err
+		}()
+
+		recipient := alice.PublicKey()
+		options := noise.HandshakeOptions{
+			Pattern:      noise.PatternIKpsk2,
+			Hash:         noise.HashBlake2b,
+			Cipher:       noise.CipherChaCha20Poly1305,
+			Sender:       bob,
+			Recipient:    &recipient,
+			PresharedKey: bobPSK,
+		}
+
+		c, err := noise.Handshake(conn.C2, options, true)
+		if err == nil {
+			var message string
+			message, err = receive(conn.C2, c)
+			assert.Equal(t, "popo!", message)
+		}
+		conn.C2.Close()
+
+		return err, <-errc
+	}
+
+	errBob, errAlice := handshake(psk, psk)
+	assert.NoError(t, errBob, "bob")
+	assert.NoError(t, errAlice, "alice")
+
+	errBob, errAlice = handshake(psk, make([]byte, noise.PresharedKeySize))
+	assert.Error(t, errBob, "bob")
+	assert.Error(t, errAlice, "alice")
+}
+
+func TestHandshake_NNpsk0(t *testing.T) {
+	psk := make([]byte, noise.PresharedKeySize)
+	psk[0] = 42
+
+	handshake := func(alicePSK, bobPSK []byte) (error, error) {
+		conn := stream.NewBidirectional()
+
+		errc := make(chan error, 1)
+		go func() {
+			options := noise.HandshakeOptions{
+				Pattern:      noise.PatternNNpsk0,
+				Hash:         noise.HashBlake2b,
+				Cipher:       noise.CipherChaCha20Poly1305,
+				PresharedKey: alicePSK,
+				Payload:      []byte("alice"),
+			}
+
+			c, err := noise.Handshake(conn.C1, options, false)
+			if err == nil {
+				err = send(conn.C1, c, "popo!")
+			}
+			conn.C1.Close()
+			errc <- err
+		}()
+
+		var payload string
+		options := noise.HandshakeOptions{
+			Pattern:      noise.PatternNNpsk0,
+			Hash:         noise.HashBlake2b,
+			Cipher:       noise.CipherChaCha20Poly1305,
+			PresharedKey: bobPSK,
+			ReceivePayload: func(p []byte) error {
+				payload = string(p)
+				return nil
+			},
+		}
+
+		c, err := noise.Handshake(conn.C2, options, true)
+		if err == nil {
+			var message string
+			message, err = receive(conn.C2, c)
+			assert.Equal(t, "popo!", message)
+			assert.Equal(t, "alice", payload)
+		}
+		conn.C2.Close()
+
+		return err, <-errc
+	}
+
+	errBob, errAlice := handshake(psk, psk)
+	assert.NoError(t, errBob, "bob")
+	assert.NoError(t, errAlice, "alice")
+
+	errBob, errAlice = handshake(psk, make([]byte, noise.PresharedKeySize))
+	assert.Error(t, errBob, "bob")
+	assert.Error(t, errAlice, "alice")
+}
+
+func TestHandshake_Hybrid(t *testing.T) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+
+	psk := make([]byte, noise.PresharedKeySize)
+	psk[0] = 42
+
+	handshake := func(aliceHybrid, bobHybrid bool, psk []byte) (error, error) {
+		conn := stream.NewBidirectional()
+
+		pattern := noise.PatternIK
+		if psk != nil {
+			pattern = noise.PatternIKpsk2
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			recipient := bob.PublicKey()
+			options := noise.HandshakeOptions{
+				Pattern:      pattern,
+				Hash:         noise.HashBlake2b,
+				Cipher:       noise.CipherChaCha20Poly1305,
+				Sender:       alice,
+				Recipient:    &recipient,
+				PresharedKey: psk,
+				Hybrid:       aliceHybrid,
+			}
+
+			c, err := noise.Handshake(conn.C1, options, false)
+			if err == nil {
+				err = send(conn.C1, c, "popo!")
+			}
+			conn.C1.Close()
+			errc <- err
+		}()
+
+		recipient := alice.PublicKey()
+		options := noise.HandshakeOptions{
+			Pattern:      pattern,
+			Hash:         noise.HashBlake2b,
+			Cipher:       noise.CipherChaCha20Poly1305,
+			Sender:       bob,
+			Recipient:    &recipient,
+			PresharedKey: psk,
+			Hybrid:       bobHybrid,
+		}
+
+		c, err := noise.Handshake(conn.C2, options, true)
+		if err == nil {
+			var message string
+			message, err = receive(conn.C2, c)
+			assert.Equal(t, "popo!", message)
+		}
+		conn.C2.Close()
+
+		return err, <-errc
+	}
+
+	errBob, errAlice := handshake(true, true, nil)
+	assert.NoError(t, errBob, "bob")
+	assert.NoError(t, errAlice, "alice")
+
+	errBob, errAlice = handshake(true, true, psk)
+	assert.NoError(t, errBob, "bob")
+	assert.NoError(t, errAlice, "alice")
+
+	errBob, errAlice = handshake(false, false, nil)
+	assert.NoError(t, errBob, "bob")
+	assert.NoError(t, errAlice, "alice")
+
+	// Mixing hybrid and classic peers
+	errBob, errAlice = handshake(false, true, nil)
+	assert.Error(t, errBob, "bob")
+	assert.Error(t, errAlice, "alice")
+
+	errBob, errAlice = handshake(true, false, nil)
+	assert.Error(t, errBob, "bob")
+	assert.Error(t, errAlice, "alice")
+
+	errBob, errAlice = handshake(true, false, psk)
+	assert.Error(t, errBob, "bob")
+	assert.Error(t, errAlice, "alice")
+}
+
 func send(c io.ReadWriter, cipher noise.Cipher, message string) error {
 	ciphertext, err := cipher.Encrypt(nil, nil, []byte(message))
 	if err != nil {
@@ -106,3 +440,88 @@ func receive(c io.ReadWriter, cipher noise.Cipher) (string, error) {
 	message, err := cipher.Decrypt(nil, nil, ciphertext[:n])
 	return string(message), err
 }
+
+func TestHandshake_ResolvedPeer(t *testing.T) {
+	alice := noise.GenerateX25519Identity()
+	bob := noise.GenerateX25519Identity()
+	mallory := noise.GenerateX25519Identity()
+
+	psk := make([]byte, noise.PresharedKeySize)
+	psk[0] = 42
+
+	// Alice is the responder and learns Bob's static key from the first message.
+	handshake := func(initiator *noise.X25519Identity, hybrid bool, initiatorPSK []byte) (error, error) {
+		conn := stream.NewBidirectional()
+
+		pattern := noise.PatternIK
+		if initiatorPSK != nil {
+			pattern = noise.PatternIKpsk2
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			options := noise.HandshakeOptions{
+				Pattern: pattern,
+				Hash:    noise.HashBlake2b,
+				Cipher:  noise.CipherChaCha20Poly1305,
+				Sender:  alice,
+				VerifyPeer: func(peer noise.X25519PublicKey) error {
+					if string(peer) != string(bob.PublicKey()) {
+						return errors.New("unknown peer")
+					}
+					return nil
+				},
+				PresharedKeyOf: func(noise.X25519PublicKey) ([]byte, error) {
+					return psk, nil
+				},
+				Hybrid: hybrid,
+			}
+
+			c, err := noise.Handshake(conn.C1, options, false)
+			if err == nil {
+				err = send(conn.C1, c, "popo!")
+			}
+			conn.C1.Close()
+			errc <- err
+		}()
+
+		recipient := alice.PublicKey()
+		options := noise.HandshakeOptions{
+			Pattern:      pattern,
+			Hash:         noise.HashBlake2b,
+			Cipher:       noise.CipherChaCha20Poly1305,
+			Sender:       initiator,
+			Recipient:    &recipient,
+			PresharedKey: initiatorPSK,
+			Hybrid:       hybrid,
+		}
+
+		c, err := noise.Handshake(conn.C2, options, true)
+		if err == nil {
+			var message string
+			message, err = receive(conn.C2, c)
+			assert.Equal(t, "popo!", message)
+		}
+		conn.C2.Close()
+
+		return err, <-errc
+	}
+
+	for _, hybrid := range []bool{false, true} {
+		errBob, errAlice := handshake(bob, hybrid, nil)
+		assert.NoError(t, errBob, "bob")
+		assert.NoError(t, errAlice, "alice")
+
+		errBob, errAlice = handshake(bob, hybrid, psk)
+		assert.NoError(t, errBob, "bob")
+		assert.NoError(t, errAlice, "alice")
+
+		errBob, errAlice = handshake(bob, hybrid, make([]byte, noise.PresharedKeySize))
+		assert.Error(t, errBob, "bob")
+		assert.Error(t, errAlice, "alice")
+
+		errMallory, errAlice := handshake(mallory, hybrid, psk)
+		assert.Error(t, errMallory, "mallory")
+		assert.EqualError(t, errAlice, "unknown peer", "alice")
+	}
+}
@@ -0,0 +1,85 @@
+package noise
+
+import (
+	"crypto/mlkem"
+	"errors"
+
+	"github.com/flynn/noise"
+	"golang.org/x/crypto/blake2b"
+)
+
+// hybridPrologue is appended to the prologue of hybrid handshakes,
+// so a peer that does not use the same mode fails the first message.
+const hybridPrologue = "/X25519MLKEM768"
+
+// A hybrid performs the ML-KEM-768 encapsulation alongside the X25519 Noise handshake.
+//
+// The initiator sends an ephemeral encapsulation key at the beginning of the encrypted payload of the first message.
+// The responder prepends the ciphertext to the second message. The encapsulated shared key
+// is mixed as the pre-shared key of the psk2 modifier, so both secrets feed into the transport keys.
+type hybrid struct {
+	dk         *mlkem.DecapsulationKey768
+	ciphertext []byte
+	psk        []byte // Optional pre-shared key of the IKpsk2 pattern
+}
+
+func newHybrid(initiator bool, psk []byte) (*hybrid, error) {
+	h := &hybrid{psk: psk}
+
+	if initiator {
+		var err error
+		h.dk, err = mlkem.GenerateKey768()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// payload returns the payload of the first message, sent by the initiator.
+func (h *hybrid) payload() []byte {
+	return h.dk.EncapsulationKey().Bytes()
+}
+
+// encapsulate encapsulates a shared key to the encapsulation key received in the first message.
+// It returns the remaining payload.
+func (h *hybrid) encapsulate(state *noise.HandshakeState, payload []byte) ([]byte, error) {
+	if len(payload) < mlkem.EncapsulationKeySize768 {
+		return nil, errors.New("hybrid: payload is too short")
+	}
+
+	ek, err := mlkem.NewEncapsulationKey768(payload[:mlkem.EncapsulationKeySize768])
+	if err != nil {
+		return nil, err
+	}
+
+	shared, ciphertext := ek.Encapsulate()
+	h.ciphertext = ciphertext
+	return payload[mlkem.EncapsulationKeySize768:], state.SetPresharedKey(h.mix(shared))
+}
+
+// decapsulate decapsulates the shared key from the ciphertext prepended to the second message.
+// It returns the remaining Noise message.
+func (h *hybrid) decapsulate(state *noise.HandshakeState, message []byte) ([]byte, error) {
+	if len(message) < mlkem.CiphertextSize768 {
+		return nil, errors.New("hybrid: message is too short")
+	}
+
+	shared, err := h.dk.Decapsulate(message[:mlkem.CiphertextSize768])
+	if err != nil {
+		return nil, err
+	}
+
+	return message[mlkem.CiphertextSize768:], state.SetPresharedKey(h.mix(shared))
+}
+
+// mix combines the encapsulated shared key with the optional pre-shared key.
+func (h *hybrid) mix(shared []byte) []byte {
+	if len(h.psk) == 0 {
+		return shared
+	}
+
+	digest := blake2b.Sum256(append(append([]byte(nil), h.psk...), shared...))
+	return digest[:]
+}
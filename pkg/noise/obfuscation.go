@@ -0,0 +1,147 @@
+package noise
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// A Padding is a padding policy of the obfuscated chunks.
+type Padding uint8
+
+// Supported paddings.
+const (
+	// PaddingNone only encrypts the size of the chunks.
+	PaddingNone Padding = 0x00
+	// PaddingRandom adds up to 1024 random bytes to each chunk.
+	PaddingRandom Padding = 0x01
+	// PaddingBucket rounds the size of each chunk up to the next power of 2 (256 bytes minimum).
+	PaddingBucket Padding = 0x02
+)
+
+const (
+	maxRandomPadding = 1024
+	minBucket        = 256
+)
+
+// An Obfuscation describes how a ChunkedStream hides the size of its chunks.
+//
+// Obfuscated chunks are sent in the style of AEAD-2022 length blocks:
+//
+//	[encrypted size (2 bytes + overhead)][encrypted payload: data size (2 bytes) | data | padding]
+//
+// The size and the payload are encrypted with two successive nonces.
+type Obfuscation struct {
+	Enabled bool
+	Padding Padding
+	// Cover is the idle duration before sending a cover chunk (with a random jitter), disabled when zero.
+	Cover time.Duration
+}
+
+// readObfuscated reads an obfuscated chunk by reusing the same underlying array.
+func (c *ChunkedStream) readObfuscated() error {
+	block := SizePrefixLength + c.rcipher.Overhead()
+	c.chunk = c.bufr[:block]
+
+	if _, err := io.ReadFull(c.stream, c.chunk); err != nil {
+		return err
+	}
+
+	size, err := c.rcipher.Decrypt(c.chunk[:0], nil, c.chunk)
+	if err != nil {
+		return err
+	}
+	n := int(binary.BigEndian.Uint16(size))
+	if n < block {
+		return errors.New("invalid chunk size")
+	}
+
+	c.chunk = c.bufr[:n]
+	if _, err = io.ReadFull(c.stream, c.chunk); err != nil {
+		return err
+	}
+
+	payload, err := c.rcipher.Decrypt(c.chunk[:0], nil, c.chunk)
+	if err != nil {
+		return err
+	}
+
+	dn := int(binary.BigEndian.Uint16(payload))
+	if SizePrefixLength+dn > len(payload) {
+		return errors.New("invalid data size")
+	}
+	c.chunk = payload[SizePrefixLength : SizePrefixLength+dn]
+	return nil
+}
+
+// writeObfuscated writes p as an obfuscated chunk.
+func (c *ChunkedStream) writeObfuscated(p []byte) (int, error) {
+	overhead := c.wcipher.Overhead()
+	block := SizePrefixLength + overhead
+
+	n := len(p)
+	pn := SizePrefixLength + n + c.padding(n)
+
+	plaintext := c.bufw[block : block+pn]
+	binary.BigEndian.PutUint16(plaintext, uint16(n))
+	copy(plaintext[SizePrefixLength:], p)
+	clear(plaintext[SizePrefixLength+n:])
+
+	var size [SizePrefixLength]byte
+	binary.BigEndian.PutUint16(size[:], uint16(pn+overhead))
+	if _, err := c.wcipher.Encrypt(c.bufw[:0], nil, size[:]); err != nil {
+		return 0, err
+	}
+
+	payload, err := c.wcipher.Encrypt(plaintext[:0], nil, plaintext)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = c.stream.Write(c.bufw[:block+len(payload)])
+	return n, err
+}
+
+// padding returns the padding size of a chunk of n data bytes.
+func (c *ChunkedStream) padding(n int) int {
+	room := c.maxsize - n
+
+	switch c.options.Obfuscation.Padding {
+	case PaddingRandom:
+		return rand.IntN(min(room, maxRandomPadding) + 1)
+	case PaddingBucket:
+		size := minBucket
+		for size < SizePrefixLength+n {
+			size <<= 1
+		}
+		return min(size-SizePrefixLength-n, room)
+	default:
+		return 0
+	}
+}
+
+// sendCover sends a cover chunk when the stream is idle and schedules the next one.
+// It stops on write failure.
+func (c *ChunkedStream) sendCover() {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	cover := c.options.Obfuscation.Cover
+	if idle := time.Since(c.written); idle < cover {
+		c.cover.Reset(coverDelay(cover - idle))
+		return
+	}
+
+	if err := c.writeControl(controlCover, nil); err != nil {
+		return
+	}
+	c.written = time.Now()
+	c.cover.Reset(coverDelay(cover))
+}
+
+// coverDelay returns d with a random jitter of ±50%.
+func coverDelay(d time.Duration) time.Duration {
+	return d/2 + rand.N(d+1)
+}
@@ -0,0 +1,191 @@
+package noise
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Control messages of a ChunkedStream.
+const (
+	// controlRekey tells the sender rekeyed its cipher after this message.
+	controlRekey byte = 0x01
+	// controlHandshake carries a message of a re-handshake.
+	controlHandshake byte = 0x02
+	// controlSwitch tells the sender uses the cipher of the re-handshake after this message.
+	controlSwitch byte = 0x03
+	// controlRehandshake asks the initiator of the handshake to perform a re-handshake.
+	controlRehandshake byte = 0x04
+	// controlCover is sent by an idle obfuscated stream, it is ignored.
+	controlCover byte = 0x05
+)
+
+// A rehandshake is a full handshake performed over a ChunkedStream, its messages are sent as control messages.
+//
+// Each side keeps using its current cipher until the re-handshake is completed,
+// then it sends a controlSwitch message and encrypts the following chunks with the new cipher.
+// The chunks received after the controlSwitch message of the peer are decrypted with the new cipher.
+type rehandshake struct {
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+	done   chan struct{}
+	cipher Cipher
+	err    error
+}
+
+// A controlWriter writes the messages of a re-handshake as control messages.
+type controlWriter struct {
+	c *ChunkedStream
+}
+
+func (w controlWriter) Write(p []byte) (int, error) {
+	w.c.wmu.Lock()
+	defer w.c.wmu.Unlock()
+
+	return len(p), w.c.writeControl(controlHandshake, p)
+}
+
+// session returns the cipher when it has been returned by Handshake.
+func session(c Cipher) *cipher {
+	s, _ := c.(*cipher)
+	return s
+}
+
+// control handles a received control message.
+func (c *ChunkedStream) control(message []byte) error {
+	if len(message) == 0 {
+		return errors.New("invalid control message")
+	}
+
+	c.hmu.Lock()
+	rh, s := c.rh, c.session
+	c.hmu.Unlock()
+
+	switch message[0] {
+	case controlRekey:
+		c.rcipher.DecryptRekey()
+		return nil
+	case controlHandshake:
+		if rh == nil {
+			if s == nil || s.initiator {
+				return errors.New("unexpected handshake message")
+			}
+
+			rh = c.rehandshake()
+		}
+
+		_, err := rh.pw.Write(message[1:])
+		return err
+	case controlSwitch:
+		if rh == nil {
+			return errors.New("unexpected cipher switch")
+		}
+
+		<-rh.done
+		if rh.err != nil {
+			return rh.err
+		}
+
+		c.rcipher = rh.cipher
+		c.ir = 0
+
+		c.hmu.Lock()
+		c.rh = nil
+		c.hmu.Unlock()
+		return nil
+	case controlRehandshake:
+		if s == nil || !s.initiator {
+			return errors.New("unexpected re-handshake request")
+		}
+
+		c.rehandshake()
+		return nil
+	case controlCover:
+		return nil
+	default:
+		return fmt.Errorf("unsupported control message %#x", message[0])
+	}
+}
+
+// rehandshakeIfDue starts a re-handshake, or asks the peer to start it, once the interval is elapsed.
+// wmu must be held.
+func (c *ChunkedStream) rehandshakeIfDue() error {
+	if c.options.Rehandshake <= 0 || time.Since(c.handshaked) < c.options.Rehandshake {
+		return nil
+	}
+	c.handshaked = time.Now()
+
+	c.hmu.Lock()
+	rh, s := c.rh, c.session
+	c.hmu.Unlock()
+
+	if rh != nil || s == nil {
+		return nil
+	}
+
+	if !s.initiator {
+		return c.writeControl(controlRehandshake, nil)
+	}
+
+	c.rehandshake()
+	return nil
+}
+
+// rehandshake returns the re-handshake in progress or starts a new one.
+// The underlying stream is closed if the re-handshake fails.
+func (c *ChunkedStream) rehandshake() *rehandshake {
+	c.hmu.Lock()
+	defer c.hmu.Unlock()
+
+	if c.rh != nil {
+		return c.rh
+	}
+
+	pr, pw := io.Pipe()
+	rh := &rehandshake{
+		pr:   pr,
+		pw:   pw,
+		done: make(chan struct{}),
+	}
+	c.rh = rh
+
+	s := c.session
+	go func() {
+		defer close(rh.done)
+
+		stream := struct {
+			io.Reader
+			io.Writer
+		}{pr, controlWriter{c: c}}
+
+		cipher, err := Handshake(stream, *s.next, s.initiator)
+		if err == nil {
+			c.wmu.Lock()
+			err = c.writeControl(controlSwitch, nil)
+			c.wcipher = cipher
+			c.iw = 0
+			c.resetRekey()
+			c.handshaked = time.Now()
+			c.wmu.Unlock()
+		}
+
+		if err != nil {
+			err = fmt.Errorf("re-handshake: %w", err)
+			pr.CloseWithError(err)
+			if closer, ok := c.stream.(io.Closer); ok {
+				closer.Close()
+			}
+			rh.err = err
+			return
+		}
+		pr.Close()
+
+		c.hmu.Lock()
+		c.session = session(cipher)
+		c.hmu.Unlock()
+		rh.cipher = cipher
+	}()
+
+	return rh
+}
@@ -0,0 +1,293 @@
+// Package proxyproto implements the HAProxy PROXY protocol versions 1 and 2.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions.
+const (
+	V1 = 1
+	V2 = 2
+)
+
+const (
+	v1Prefix    = "PROXY "
+	v1MaxLength = 107
+
+	v2HeaderLength = 16
+	v2Version      = 0x20
+	v2CmdLocal     = 0x00
+	v2CmdProxy     = 0x01
+
+	v2FamUnspec = 0x00
+	v2FamTCP4   = 0x11
+	v2FamUDP4   = 0x12
+	v2FamTCP6   = 0x21
+	v2FamUDP6   = 0x22
+	v2FamUnix   = 0x31
+
+	v2IPv4Length = 12
+	v2IPv6Length = 36
+	v2UnixLength = 216
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// ErrInvalidHeader is returned when a PROXY protocol header is malformed.
+var ErrInvalidHeader = errors.New("proxyproto: invalid header")
+
+// A Header is a PROXY protocol header.
+type Header struct {
+	Version int
+	// Local is true when the connection was established by the proxy itself (e.g. health checks).
+	// Addresses are not relevant for a local connection.
+	Local bool
+	// Source and Destination are nil when the proxy does not know the original addresses.
+	Source      net.Addr
+	Destination net.Addr
+}
+
+// Read reads the PROXY protocol header at the beginning of r.
+// A nil header and nil error are returned when r does not start by a PROXY protocol header,
+// in that case nothing is consumed.
+//
+// Read waits for the 12 first bytes of the stream to detect the header.
+func Read(r *bufio.Reader) (*Header, error) {
+	p, err := r.Peek(len(v2Signature))
+	if bytes.Equal(p, v2Signature) {
+		return readV2(r)
+	}
+
+	if bytes.HasPrefix(p, []byte(v1Prefix)) {
+		return readV1(r)
+	}
+
+	if err != nil && len(p) < len(v1Prefix) {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, ErrInvalidHeader
+	}
+
+	fields := strings.Split(s, " ")
+	h := &Header{Version: V1}
+
+	switch {
+	case len(fields) >= 2 && fields[1] == "UNKNOWN":
+		return h, nil
+	case len(fields) != 6:
+		return nil, ErrInvalidHeader
+	case fields[1] != "TCP4" && fields[1] != "TCP6":
+		return nil, ErrInvalidHeader
+	}
+
+	src, err := parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	h.Source = src
+	h.Destination = dst
+	return h, nil
+}
+
+func parseV1Addr(protocol, ip, port string) (net.Addr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil || (protocol == "TCP4") != (addr.IP.To4() != nil) {
+		return nil, fmt.Errorf("%w: address %q", ErrInvalidHeader, ip)
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, fmt.Errorf("%w: port %q", ErrInvalidHeader, port)
+	}
+	addr.Port = int(n)
+
+	return addr, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	hdr := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+
+	if hdr[12]&0xF0 != v2Version {
+		return nil, fmt.Errorf("%w: version", ErrInvalidHeader)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	h := &Header{Version: V2}
+
+	switch hdr[12] & 0x0F {
+	case v2CmdLocal:
+		h.Local = true
+		return h, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("%w: command", ErrInvalidHeader)
+	}
+
+	switch fam := hdr[13]; fam {
+	case v2FamUnspec:
+	case v2FamTCP4, v2FamUDP4:
+		if len(payload) < v2IPv4Length {
+			return nil, ErrInvalidHeader
+		}
+
+		h.Source = ipAddr(fam, payload[0:4], payload[8:10])
+		h.Destination = ipAddr(fam, payload[4:8], payload[10:12])
+	case v2FamTCP6, v2FamUDP6:
+		if len(payload) < v2IPv6Length {
+			return nil, ErrInvalidHeader
+		}
+
+		h.Source = ipAddr(fam, payload[0:16], payload[32:34])
+		h.Destination = ipAddr(fam, payload[16:32], payload[34:36])
+	case v2FamUnix:
+		if len(payload) < v2UnixLength {
+			return nil, ErrInvalidHeader
+		}
+
+		h.Source = &net.UnixAddr{Net: "unix", Name: cstring(payload[:108])}
+		h.Destination = &net.UnixAddr{Net: "unix", Name: cstring(payload[108:216])}
+	default:
+		return nil, fmt.Errorf("%w: address family", ErrInvalidHeader)
+	}
+
+	return h, nil
+}
+
+func ipAddr(fam byte, ip, port []byte) net.Addr {
+	addr := net.IP(bytes.Clone(ip))
+	p := int(binary.BigEndian.Uint16(port))
+
+	if fam == v2FamUDP4 || fam == v2FamUDP6 {
+		return &net.UDPAddr{IP: addr, Port: p}
+	}
+	return &net.TCPAddr{IP: addr, Port: p}
+}
+
+func cstring(p []byte) string {
+	if i := bytes.IndexByte(p, 0); i >= 0 {
+		p = p[:i]
+	}
+	return string(p)
+}
+
+// Format returns the header encoded in the given protocol version.
+// Addresses that cannot be represented by the version (e.g. Unix sockets in v1) are sent as unknown.
+func (h *Header) Format(version int) ([]byte, error) {
+	switch version {
+	case V1:
+		return h.formatV1(), nil
+	case V2:
+		return h.formatV2(), nil
+	}
+
+	return nil, fmt.Errorf("proxyproto: unsupported version %d", version)
+}
+
+func (h *Header) formatV1() []byte {
+	src, sok := h.Source.(*net.TCPAddr)
+	dst, dok := h.Destination.(*net.TCPAddr)
+	if h.Local || !sok || !dok || (src.IP.To4() != nil) != (dst.IP.To4() != nil) {
+		return []byte(v1Prefix + "UNKNOWN\r\n")
+	}
+
+	protocol := "TCP6"
+	if src.IP.To4() != nil {
+		protocol = "TCP4"
+	}
+
+	return fmt.Appendf(nil, "%s%s %s %s %d %d\r\n", v1Prefix, protocol, src.IP, dst.IP, src.Port, dst.Port)
+}
+
+func (h *Header) formatV2() []byte {
+	p := append([]byte(nil), v2Signature...)
+	p = append(p, v2Version|v2CmdProxy, v2FamUnspec, 0, 0)
+	if h.Local {
+		p[12] = v2Version | v2CmdLocal
+		return p
+	}
+
+	var payload []byte
+	switch src := h.Source.(type) {
+	case *net.TCPAddr:
+		if dst, ok := h.Destination.(*net.TCPAddr); ok {
+			payload = ipPayload(p, v2FamTCP4, v2FamTCP6, src.IP, dst.IP, src.Port, dst.Port)
+		}
+	case *net.UDPAddr:
+		if dst, ok := h.Destination.(*net.UDPAddr); ok {
+			payload = ipPayload(p, v2FamUDP4, v2FamUDP6, src.IP, dst.IP, src.Port, dst.Port)
+		}
+	case *net.UnixAddr:
+		if dst, ok := h.Destination.(*net.UnixAddr); ok && len(src.Name) < 108 && len(dst.Name) < 108 {
+			p[13] = v2FamUnix
+			payload = make([]byte, v2UnixLength)
+			copy(payload, src.Name)
+			copy(payload[108:], dst.Name)
+		}
+	}
+
+	binary.BigEndian.PutUint16(p[14:], uint16(len(payload)))
+	return append(p, payload...)
+}
+
+// ipPayload sets the address family in the header hdr and returns the address block.
+func ipPayload(hdr []byte, fam4, fam6 byte, src, dst net.IP, sport, dport int) []byte {
+	var payload []byte
+	if src.To4() != nil && dst.To4() != nil {
+		hdr[13] = fam4
+		payload = append(payload, src.To4()...)
+		payload = append(payload, dst.To4()...)
+	} else {
+		hdr[13] = fam6
+		payload = append(payload, src.To16()...)
+		payload = append(payload, dst.To16()...)
+	}
+
+	payload = binary.BigEndian.AppendUint16(payload, uint16(sport))
+	return binary.BigEndian.AppendUint16(payload, uint16(dport))
+}
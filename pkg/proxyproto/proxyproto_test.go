@@ -0,0 +1,185 @@
+package proxyproto_test
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mdouchement/seikan/pkg/proxyproto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadV1(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\npayload"))
+
+	h, err := proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.Equal(t, proxyproto.V1, h.Version)
+	assert.Equal(t, "192.0.2.1:56324", h.Source.String())
+	assert.Equal(t, "198.51.100.1:443", h.Destination.String())
+	assertRemaining(t, r, "payload")
+
+	//
+
+	r = bufio.NewReader(strings.NewReader("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\npayload"))
+
+	h, err = proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", h.Source.String())
+	assert.Equal(t, "[2001:db8::2]:443", h.Destination.String())
+	assertRemaining(t, r, "payload")
+
+	//
+
+	r = bufio.NewReader(strings.NewReader("PROXY UNKNOWN\r\npayload"))
+
+	h, err = proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.Nil(t, h.Source)
+	assertRemaining(t, r, "payload")
+}
+
+func TestReadV1_Invalid(t *testing.T) {
+	for _, header := range []string{
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n",
+		"PROXY TCP4 2001:db8::1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 056324 443\r\n",
+		"PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n",
+		"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n",
+		"PROXY " + strings.Repeat("A", 120) + "\r\n",
+	} {
+		_, err := proxyproto.Read(bufio.NewReader(strings.NewReader(header)))
+		assert.ErrorIs(t, err, proxyproto.ErrInvalidHeader, header)
+	}
+}
+
+func TestReadV2(t *testing.T) {
+	// TCP over IPv4 from 192.0.2.1:56324 to 198.51.100.1:443 with a NOOP TLV.
+	header := "0d0a0d0a000d0a515549540a" + "21" + "11" + "000f" +
+		"c0000201" + "c6336401" + "dc04" + "01bb" + "040000"
+
+	r := bufio.NewReader(strings.NewReader(unhex(t, header) + "payload"))
+
+	h, err := proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.Equal(t, proxyproto.V2, h.Version)
+	assert.False(t, h.Local)
+	assert.Equal(t, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1).To4(), Port: 56324}, h.Source)
+	assert.Equal(t, "198.51.100.1:443", h.Destination.String())
+	assertRemaining(t, r, "payload")
+
+	//
+
+	// TCP over IPv6 from [2001:db8::1]:56324 to [2001:db8::2]:443.
+	header = "0d0a0d0a000d0a515549540a" + "21" + "21" + "0024" +
+		"20010db8000000000000000000000001" + "20010db8000000000000000000000002" + "dc04" + "01bb"
+
+	r = bufio.NewReader(strings.NewReader(unhex(t, header) + "payload"))
+
+	h, err = proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "[2001:db8::1]:56324", h.Source.String())
+	assertRemaining(t, r, "payload")
+
+	//
+
+	// Local command (health check).
+	header = "0d0a0d0a000d0a515549540a" + "20" + "00" + "0000"
+	r = bufio.NewReader(strings.NewReader(unhex(t, header) + "payload"))
+
+	h, err = proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.True(t, h.Local)
+	assertRemaining(t, r, "payload")
+}
+
+func TestReadV2_Invalid(t *testing.T) {
+	for _, header := range []string{
+		"0d0a0d0a000d0a515549540a" + "11" + "11" + "000c" + "c0000201c6336401dc0401bb", // Version 1
+		"0d0a0d0a000d0a515549540a" + "22" + "11" + "000c" + "c0000201c6336401dc0401bb", // Unknown command
+		"0d0a0d0a000d0a515549540a" + "21" + "41" + "000c" + "c0000201c6336401dc0401bb", // Unknown family
+		"0d0a0d0a000d0a515549540a" + "21" + "21" + "000c" + "c0000201c6336401dc0401bb", // IPv6 too short
+	} {
+		_, err := proxyproto.Read(bufio.NewReader(strings.NewReader(unhex(t, header))))
+		assert.ErrorIs(t, err, proxyproto.ErrInvalidHeader, header)
+	}
+
+	_, err := proxyproto.Read(bufio.NewReader(strings.NewReader(unhex(t, "0d0a0d0a000d0a515549540a21110010c0000201"))))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestRead_NoHeader(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n"))
+
+	h, err := proxyproto.Read(r)
+	assert.NoError(t, err)
+	assert.Nil(t, h)
+	assertRemaining(t, r, "GET / HTTP/1.1\r\n\r\n")
+
+	_, err = proxyproto.Read(bufio.NewReader(strings.NewReader("")))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestFormat(t *testing.T) {
+	for _, h := range []*proxyproto.Header{
+		{
+			Source:      &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.IPv4(198, 51, 100, 1), Port: 443},
+		},
+		{
+			Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+		},
+	} {
+		for _, version := range []int{proxyproto.V1, proxyproto.V2} {
+			p, err := h.Format(version)
+			assert.NoError(t, err)
+
+			r := bufio.NewReader(strings.NewReader(string(p) + "payload"))
+			output, err := proxyproto.Read(r)
+			assert.NoError(t, err)
+			assert.Equal(t, version, output.Version)
+			assert.Equal(t, h.Source.String(), output.Source.String())
+			assert.Equal(t, h.Destination.String(), output.Destination.String())
+			assertRemaining(t, r, "payload")
+		}
+	}
+
+	//
+
+	h := &proxyproto.Header{
+		Source:      &net.UnixAddr{Net: "unix", Name: "@client"},
+		Destination: &net.UnixAddr{Net: "unix", Name: "/run/seikan.sock"},
+	}
+
+	p, err := h.Format(proxyproto.V1)
+	assert.NoError(t, err)
+	assert.Equal(t, "PROXY UNKNOWN\r\n", string(p))
+
+	p, err = h.Format(proxyproto.V2)
+	assert.NoError(t, err)
+
+	output, err := proxyproto.Read(bufio.NewReader(strings.NewReader(string(p))))
+	assert.NoError(t, err)
+	assert.Equal(t, h.Source, output.Source)
+	assert.Equal(t, h.Destination, output.Destination)
+
+	_, err = h.Format(3)
+	assert.EqualError(t, err, "proxyproto: unsupported version 3")
+}
+
+func unhex(t *testing.T, s string) string {
+	p, err := hex.DecodeString(s)
+	assert.NoError(t, err)
+	return string(p)
+}
+
+func assertRemaining(t *testing.T, r io.Reader, expected string) {
+	p, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(p))
+}
@@ -0,0 +1,455 @@
+package rudp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Segment commands.
+const (
+	cmdPush uint8 = 0x01
+	cmdAck  uint8 = 0x02
+	cmdAsk  uint8 = 0x03 // Asks the peer window, used as window probe and keepalive.
+	cmdTell uint8 = 0x04 // Tells the local window.
+	cmdFin  uint8 = 0x05 // Ordered end of stream.
+)
+
+const (
+	fastResend = 2
+	fastLimit  = 5 // Maximum transmissions of a segment for a fast retransmit.
+	minRTO     = 30
+	maxRTO     = 60000
+	initialRTO = 200
+	probeInit  = 1000
+	probeLimit = 60000
+)
+
+var errInvalidSegment = errors.New("rudp: invalid segment")
+
+type (
+	segment struct {
+		cmd      uint8
+		ts       uint32
+		sn       uint32
+		data     []byte
+		xmit     uint32
+		rto      uint32
+		resendts uint32
+		fastack  uint32
+	}
+
+	ack struct {
+		sn uint32
+		ts uint32
+	}
+
+	// arq is the automatic repeat request state machine.
+	// It is not safe for concurrent use and does not perform any I/O on its own.
+	arq struct {
+		conv   uint32
+		mss    int
+		mtu    int
+		output func(p []byte)
+
+		interval uint32
+		sndWnd   uint32
+		rcvWnd   uint32
+		rmtWnd   uint32
+
+		sndUna uint32
+		sndNxt uint32
+		rcvNxt uint32
+
+		srtt   int32
+		rttval int32
+		rto    uint32
+
+		sndQueue []*segment
+		sndBuf   []*segment
+		rcvBuf   []*segment
+		rcvQueue []*segment
+		acks     []ack
+
+		ask       bool
+		tell      bool
+		probeWait uint32
+		probeTs   uint32
+
+		eof  bool
+		dead bool
+		buf  []byte
+	}
+)
+
+func newARQ(conv uint32, config Config, output func([]byte)) *arq {
+	mtu := config.MTU - crcSize
+	if config.FEC() {
+		mtu -= fecHeaderSize
+	}
+
+	return &arq{
+		conv:     conv,
+		mss:      config.mss(),
+		mtu:      mtu,
+		output:   output,
+		interval: uint32(config.Interval.Milliseconds()),
+		sndWnd:   uint32(config.Window),
+		rcvWnd:   uint32(config.Window),
+		rmtWnd:   uint32(config.Window),
+		rto:      initialRTO,
+		buf:      make([]byte, 0, mtu),
+	}
+}
+
+func diff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// waitSnd returns the number of segments waiting to be sent or acknowledged.
+func (a *arq) waitSnd() int {
+	return len(a.sndBuf) + len(a.sndQueue)
+}
+
+// send queues p in the stream.
+func (a *arq) send(p []byte) {
+	if n := len(a.sndQueue); n > 0 {
+		// Stream mode: fill up the last queued segment.
+		last := a.sndQueue[n-1]
+		if last.cmd == cmdPush && len(last.data) < a.mss {
+			l := min(a.mss-len(last.data), len(p))
+			last.data = append(last.data, p[:l]...)
+			p = p[l:]
+		}
+	}
+
+	for len(p) > 0 {
+		l := min(a.mss, len(p))
+		a.sndQueue = append(a.sndQueue, &segment{
+			cmd:  cmdPush,
+			data: append(make([]byte, 0, a.mss), p[:l]...),
+		})
+		p = p[l:]
+	}
+}
+
+// fin queues the end of stream.
+func (a *arq) fin() {
+	a.sndQueue = append(a.sndQueue, &segment{cmd: cmdFin})
+}
+
+// recv reads the in-order received data into p.
+func (a *arq) recv(p []byte) int {
+	full := uint32(len(a.rcvQueue)) >= a.rcvWnd
+
+	var n int
+	for len(a.rcvQueue) > 0 && n < len(p) {
+		seg := a.rcvQueue[0]
+		if seg.cmd == cmdFin {
+			if n == 0 {
+				a.eof = true
+			}
+			break
+		}
+
+		c := copy(p[n:], seg.data)
+		n += c
+		if c < len(seg.data) {
+			seg.data = seg.data[c:]
+			break
+		}
+
+		a.rcvQueue[0] = nil
+		a.rcvQueue = a.rcvQueue[1:]
+	}
+
+	a.moveToQueue()
+	if full && uint32(len(a.rcvQueue)) < a.rcvWnd {
+		a.tell = true // The window reopened, the peer must know it as soon as possible.
+	}
+
+	return n
+}
+
+// readable returns true if recv has something to return.
+func (a *arq) readable() bool {
+	return len(a.rcvQueue) > 0
+}
+
+func (a *arq) wndUnused() uint16 {
+	if n := uint32(len(a.rcvQueue)); n < a.rcvWnd {
+		return uint16(a.rcvWnd - n)
+	}
+	return 0
+}
+
+// input processes the segments of a received packet.
+func (a *arq) input(data []byte, now uint32) error {
+	var maxack uint32
+	var acked bool
+
+	for len(data) >= segmentHeader {
+		conv := binary.BigEndian.Uint32(data)
+		cmd := data[4]
+		wnd := binary.BigEndian.Uint16(data[5:])
+		ts := binary.BigEndian.Uint32(data[7:])
+		sn := binary.BigEndian.Uint32(data[11:])
+		una := binary.BigEndian.Uint32(data[15:])
+		l := int(binary.BigEndian.Uint16(data[19:]))
+		data = data[segmentHeader:]
+
+		if conv != a.conv || len(data) < l {
+			return errInvalidSegment
+		}
+
+		a.rmtWnd = uint32(wnd)
+		a.parseUna(una)
+
+		switch cmd {
+		case cmdAck:
+			if rtt := diff(now, ts); rtt >= 0 {
+				a.updateRTT(rtt)
+			}
+			a.parseAck(sn)
+			if !acked || diff(sn, maxack) > 0 {
+				acked = true
+				maxack = sn
+			}
+		case cmdPush, cmdFin:
+			if diff(sn, a.rcvNxt+a.rcvWnd) < 0 {
+				a.acks = append(a.acks, ack{sn: sn, ts: ts})
+				if diff(sn, a.rcvNxt) >= 0 {
+					a.parseData(&segment{
+						cmd:  cmd,
+						sn:   sn,
+						data: append([]byte(nil), data[:l]...),
+					})
+				}
+			}
+		case cmdAsk:
+			a.tell = true
+		case cmdTell:
+		default:
+			return errInvalidSegment
+		}
+
+		data = data[l:]
+	}
+
+	if acked {
+		a.parseFastack(maxack)
+	}
+
+	return nil
+}
+
+func (a *arq) updateRTT(rtt int32) {
+	if a.srtt == 0 {
+		a.srtt = rtt
+		a.rttval = rtt / 2
+	} else {
+		delta := rtt - a.srtt
+		if delta < 0 {
+			delta = -delta
+		}
+		a.rttval = (3*a.rttval + delta) / 4
+		a.srtt = (7*a.srtt + rtt) / 8
+		if a.srtt < 1 {
+			a.srtt = 1
+		}
+	}
+
+	rto := uint32(a.srtt) + max(a.interval, uint32(4*a.rttval))
+	a.rto = min(max(rto, minRTO), maxRTO)
+}
+
+// parseUna removes all the segments acknowledged by the cumulative una.
+func (a *arq) parseUna(una uint32) {
+	var n int
+	for _, seg := range a.sndBuf {
+		if diff(una, seg.sn) <= 0 {
+			break
+		}
+		n++
+	}
+	a.sndBuf = a.sndBuf[n:]
+	a.shrink()
+}
+
+// parseAck removes the selectively acknowledged segment.
+func (a *arq) parseAck(sn uint32) {
+	if diff(sn, a.sndUna) < 0 || diff(sn, a.sndNxt) >= 0 {
+		return
+	}
+
+	for i, seg := range a.sndBuf {
+		if seg.sn == sn {
+			a.sndBuf = append(a.sndBuf[:i], a.sndBuf[i+1:]...)
+			break
+		}
+		if diff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+	a.shrink()
+}
+
+// parseFastack counts the acknowledgements that skipped the in-flight segments.
+func (a *arq) parseFastack(sn uint32) {
+	if diff(sn, a.sndUna) < 0 || diff(sn, a.sndNxt) >= 0 {
+		return
+	}
+
+	for _, seg := range a.sndBuf {
+		if diff(sn, seg.sn) <= 0 {
+			break
+		}
+		seg.fastack++
+	}
+}
+
+func (a *arq) shrink() {
+	if len(a.sndBuf) > 0 {
+		a.sndUna = a.sndBuf[0].sn
+		return
+	}
+	a.sndUna = a.sndNxt
+}
+
+// parseData stores the segment in the receive buffer, ordered by sequence number.
+func (a *arq) parseData(seg *segment) {
+	i := len(a.rcvBuf)
+	for ; i > 0; i-- {
+		d := diff(seg.sn, a.rcvBuf[i-1].sn)
+		if d == 0 {
+			return // Duplicate
+		}
+		if d > 0 {
+			break
+		}
+	}
+
+	a.rcvBuf = append(a.rcvBuf, nil)
+	copy(a.rcvBuf[i+1:], a.rcvBuf[i:])
+	a.rcvBuf[i] = seg
+
+	a.moveToQueue()
+}
+
+func (a *arq) moveToQueue() {
+	var n int
+	for _, seg := range a.rcvBuf {
+		if seg.sn != a.rcvNxt || uint32(len(a.rcvQueue)) >= a.rcvWnd {
+			break
+		}
+		a.rcvQueue = append(a.rcvQueue, seg)
+		a.rcvNxt++
+		n++
+	}
+	a.rcvBuf = a.rcvBuf[n:]
+}
+
+// flush sends pending acknowledgements, probes and segments.
+func (a *arq) flush(now uint32) {
+	wnd := a.wndUnused()
+	buf := a.buf[:0]
+
+	emit := func(seg *segment) {
+		if len(buf)+segmentHeader+len(seg.data) > a.mtu {
+			a.output(buf)
+			buf = a.buf[:0]
+		}
+
+		buf = binary.BigEndian.AppendUint32(buf, a.conv)
+		buf = append(buf, seg.cmd)
+		buf = binary.BigEndian.AppendUint16(buf, wnd)
+		buf = binary.BigEndian.AppendUint32(buf, seg.ts)
+		buf = binary.BigEndian.AppendUint32(buf, seg.sn)
+		buf = binary.BigEndian.AppendUint32(buf, a.rcvNxt)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(seg.data)))
+		buf = append(buf, seg.data...)
+	}
+
+	//
+	// Acknowledgements
+	//
+
+	for _, ack := range a.acks {
+		emit(&segment{cmd: cmdAck, sn: ack.sn, ts: ack.ts})
+	}
+	a.acks = a.acks[:0]
+
+	//
+	// Window probe
+	//
+
+	if a.rmtWnd == 0 {
+		if a.probeWait == 0 {
+			a.probeWait = probeInit
+			a.probeTs = now + a.probeWait
+		} else if diff(now, a.probeTs) >= 0 {
+			a.ask = true
+			a.probeWait = min(a.probeWait+a.probeWait/2, probeLimit)
+			a.probeTs = now + a.probeWait
+		}
+	} else {
+		a.probeWait = 0
+	}
+
+	if a.ask {
+		emit(&segment{cmd: cmdAsk})
+		a.ask = false
+	}
+
+	if a.tell {
+		emit(&segment{cmd: cmdTell})
+		a.tell = false
+	}
+
+	//
+	// Segments
+	//
+
+	cwnd := min(a.sndWnd, a.rmtWnd)
+	for len(a.sndQueue) > 0 && diff(a.sndNxt, a.sndUna+cwnd) < 0 {
+		seg := a.sndQueue[0]
+		a.sndQueue[0] = nil
+		a.sndQueue = a.sndQueue[1:]
+
+		seg.sn = a.sndNxt
+		a.sndNxt++
+		a.sndBuf = append(a.sndBuf, seg)
+	}
+
+	for _, seg := range a.sndBuf {
+		var send bool
+
+		switch {
+		case seg.xmit == 0:
+			send = true
+			seg.rto = a.rto
+			seg.resendts = now + seg.rto
+		case diff(now, seg.resendts) >= 0:
+			send = true
+			seg.rto += a.rto / 2
+			seg.resendts = now + seg.rto
+		case seg.fastack >= fastResend && seg.xmit <= fastLimit:
+			send = true
+			seg.fastack = 0
+			seg.resendts = now + seg.rto
+		}
+
+		if send {
+			seg.xmit++
+			seg.ts = now
+			emit(seg)
+
+			if seg.xmit >= deadLink {
+				a.dead = true
+			}
+		}
+	}
+
+	if len(buf) > 0 {
+		a.output(buf)
+	}
+}
@@ -0,0 +1,400 @@
+package rudp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// epoch is the reference of the ARQ millisecond clock.
+var epoch = time.Now()
+
+func now() uint32 {
+	return uint32(time.Since(epoch).Milliseconds())
+}
+
+// A Conn is a reliable-ordered stream over UDP. It implements net.Conn.
+type Conn struct {
+	mu     sync.Mutex
+	config Config
+	arq    *arq
+	pc     net.PacketConn
+	raddr  net.Addr
+	enc    *fecEncoder
+	dec    *fecDecoder
+	owned  bool        // pc is closed with the connection (dialed connections).
+	detach func(*Conn) // Removes the connection from its listener.
+
+	readEvent  chan struct{}
+	writeEvent chan struct{}
+	die        chan struct{}
+	dieOnce    sync.Once
+
+	rd       time.Time
+	wd       time.Time
+	closing  bool
+	closedAt time.Time
+	lastRecv time.Time
+	lastSend time.Time
+	err      error
+}
+
+// Dial connects to the given UDP address.
+func Dial(address string, config Config) (*Conn, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var p [4]byte
+	if _, err = io.ReadFull(rand.Reader, p[:]); err != nil {
+		pc.Close()
+		return nil, err
+	}
+
+	c, err := newConn(binary.BigEndian.Uint32(p[:]), config, pc, raddr)
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	c.owned = true
+
+	go c.readLoop()
+	go c.updateLoop()
+	return c, nil
+}
+
+func newConn(conv uint32, config Config, pc net.PacketConn, raddr net.Addr) (*Conn, error) {
+	c := &Conn{
+		config:     config,
+		pc:         pc,
+		raddr:      raddr,
+		readEvent:  make(chan struct{}, 1),
+		writeEvent: make(chan struct{}, 1),
+		die:        make(chan struct{}),
+		lastRecv:   time.Now(),
+		lastSend:   time.Now(),
+	}
+	c.arq = newARQ(conv, config, c.output)
+
+	if config.FEC() {
+		var err error
+		if c.enc, err = newFECEncoder(config.DataShards, config.ParityShards); err != nil {
+			return nil, err
+		}
+		if c.dec, err = newFECDecoder(config.DataShards, config.ParityShards); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if c.arq.readable() {
+			n := c.arq.recv(p)
+			if n == 0 && c.arq.eof {
+				c.mu.Unlock()
+				return 0, io.EOF
+			}
+			if c.arq.tell {
+				c.arq.flush(now())
+			}
+			c.mu.Unlock()
+			return n, nil
+		}
+
+		if err := c.failure(); err != nil {
+			c.mu.Unlock()
+			return 0, err
+		}
+
+		timeout, stop := deadline(c.rd)
+		c.mu.Unlock()
+
+		select {
+		case <-c.readEvent:
+		case <-timeout:
+			stop()
+			return 0, timeoutError{}
+		case <-c.die:
+		}
+		stop()
+	}
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(p []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if err := c.failure(); err != nil {
+			c.mu.Unlock()
+			return 0, err
+		}
+
+		if c.arq.waitSnd() < int(c.arq.sndWnd) {
+			c.arq.send(p)
+			c.arq.flush(now())
+			c.mu.Unlock()
+			return len(p), nil
+		}
+
+		timeout, stop := deadline(c.wd)
+		c.mu.Unlock()
+
+		select {
+		case <-c.writeEvent:
+		case <-timeout:
+			stop()
+			return 0, timeoutError{}
+		case <-c.die:
+		}
+		stop()
+	}
+}
+
+// Close implements net.Conn.
+// Pending data is flushed in the background, followed by the end of stream.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing {
+		return net.ErrClosed
+	}
+	c.closing = true
+	c.closedAt = time.Now()
+
+	if c.err == nil {
+		c.arq.fin()
+		c.arq.flush(now())
+	}
+
+	notify(c.readEvent)
+	notify(c.writeEvent)
+	return nil
+}
+
+// LocalAddr implements net.Conn.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.pc.LocalAddr()
+}
+
+// RemoteAddr implements net.Conn.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// SetDeadline implements net.Conn.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rd = t
+	c.wd = t
+	c.mu.Unlock()
+
+	notify(c.readEvent)
+	notify(c.writeEvent)
+	return nil
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.rd = t
+	c.mu.Unlock()
+
+	notify(c.readEvent)
+	return nil
+}
+
+// SetWriteDeadline implements net.Conn.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.wd = t
+	c.mu.Unlock()
+
+	notify(c.writeEvent)
+	return nil
+}
+
+// failure returns the error preventing any I/O. It must be called with the lock held.
+func (c *Conn) failure() error {
+	if c.closing {
+		return net.ErrClosed
+	}
+	return c.err
+}
+
+// input processes a received packet, crc excluded.
+func (c *Conn) input(pkt []byte) {
+	payloads := [][]byte{pkt}
+	if c.dec != nil {
+		var err error
+		if payloads, err = c.dec.decode(pkt); err != nil {
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastRecv = time.Now()
+	for _, p := range payloads {
+		c.arq.input(p, now())
+	}
+	c.arq.flush(now()) // Acknowledges without waiting for the next update.
+
+	if c.arq.readable() {
+		notify(c.readEvent)
+	}
+	if c.arq.waitSnd() < int(c.arq.sndWnd) {
+		notify(c.writeEvent)
+	}
+}
+
+// output sends the ARQ payload p. It is called with the lock held.
+func (c *Conn) output(p []byte) {
+	c.lastSend = time.Now()
+
+	if c.enc == nil {
+		pkt := make([]byte, crcSize+len(p))
+		copy(pkt[crcSize:], p)
+		c.write(pkt)
+		return
+	}
+
+	packets, _ := c.enc.encode(p)
+	for _, pkt := range packets {
+		c.write(pkt)
+	}
+}
+
+func (c *Conn) write(pkt []byte) {
+	binary.BigEndian.PutUint32(pkt, crc32.ChecksumIEEE(pkt[crcSize:]))
+	c.pc.WriteTo(pkt, c.raddr)
+}
+
+// readLoop reads the packets of a dialed connection.
+func (c *Conn) readLoop() {
+	buf := make([]byte, receiveBufSize)
+	for {
+		n, addr, err := c.pc.ReadFrom(buf)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+
+		if addr.String() != c.raddr.String() {
+			continue
+		}
+
+		if pkt, ok := verify(buf[:n]); ok {
+			c.input(pkt)
+		}
+	}
+}
+
+// updateLoop periodically flushes the ARQ and watches the connection liveness.
+func (c *Conn) updateLoop() {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.die:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		if time.Since(c.lastSend) > keepalive {
+			c.arq.ask = true
+		}
+		c.arq.flush(now())
+
+		var err error
+		switch {
+		case c.arq.dead:
+			err = ErrDeadLink
+		case time.Since(c.lastRecv) > c.config.IdleTimeout:
+			err = ErrDeadLink
+		case c.closing && (c.arq.waitSnd() == 0 || time.Since(c.closedAt) > linger):
+			err = net.ErrClosed
+		}
+
+		if c.arq.waitSnd() < int(c.arq.sndWnd) {
+			notify(c.writeEvent)
+		}
+		c.mu.Unlock()
+
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+	}
+}
+
+// shutdown releases the connection resources.
+func (c *Conn) shutdown(err error) {
+	c.dieOnce.Do(func() {
+		c.mu.Lock()
+		if c.err == nil {
+			c.err = err
+		}
+		c.mu.Unlock()
+
+		close(c.die)
+
+		if c.owned {
+			c.pc.Close()
+		}
+		if c.detach != nil {
+			c.detach(c)
+		}
+	})
+}
+
+// verify checks the packet crc and returns the packet without it.
+func verify(pkt []byte) ([]byte, bool) {
+	if len(pkt) < crcSize {
+		return nil, false
+	}
+
+	if binary.BigEndian.Uint32(pkt) != crc32.ChecksumIEEE(pkt[crcSize:]) {
+		return nil, false
+	}
+
+	return pkt[crcSize:], true
+}
+
+func deadline(t time.Time) (<-chan time.Time, func()) {
+	if t.IsZero() {
+		return nil, func() {}
+	}
+
+	timer := time.NewTimer(time.Until(t))
+	return timer.C, func() { timer.Stop() }
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,36 @@
+package rudp
+
+// FEC for test purpose.
+type FEC struct {
+	enc *fecEncoder
+	dec *fecDecoder
+}
+
+// NewFEC for test purpose.
+func NewFEC(data, parity int) (*FEC, error) {
+	enc, err := newFECEncoder(data, parity)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newFECDecoder(data, parity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FEC{enc: enc, dec: dec}, nil
+}
+
+// Encode for test purpose (crc headroom removed).
+func (f *FEC) Encode(payload []byte) ([][]byte, error) {
+	packets, err := f.enc.encode(payload)
+	for i := range packets {
+		packets[i] = packets[i][crcSize:]
+	}
+	return packets, err
+}
+
+// Decode for test purpose.
+func (f *FEC) Decode(packet []byte) ([][]byte, error) {
+	return f.dec.decode(packet)
+}
@@ -0,0 +1,249 @@
+package rudp
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// FEC packet layout:
+//
+//	data:   | seqid (4) | type (2) | size (2) | payload |
+//	parity: | seqid (4) | type (2) | parity shard       |
+//
+// Data shards are `size + payload' padded to the largest shard of their group.
+// A group is made of DataShards consecutive data packets followed by ParityShards parity packets.
+const (
+	fecHeaderSize        = 8
+	fecData       uint16 = 0xF1
+	fecParity     uint16 = 0xF2
+)
+
+var errInvalidFEC = errors.New("rudp: invalid FEC packet")
+
+type fecEncoder struct {
+	data   int
+	parity int
+	limit  uint32
+	codec  reedsolomon.Encoder
+	next   uint32
+	shards [][]byte
+	maxlen int
+}
+
+func newFECEncoder(data, parity int) (*fecEncoder, error) {
+	codec, err := reedsolomon.New(data, parity)
+	if err != nil {
+		return nil, err
+	}
+
+	total := uint32(data + parity)
+	return &fecEncoder{
+		data:   data,
+		parity: parity,
+		limit:  (math.MaxUint32 / total) * total, // Keeps groups aligned when seqid wraps around.
+		codec:  codec,
+	}, nil
+}
+
+// encode returns the packets carrying payload: its data packet followed by the parity packets of the group once completed.
+// Each packet has crcSize bytes of headroom.
+func (e *fecEncoder) encode(payload []byte) ([][]byte, error) {
+	pkt := make([]byte, crcSize+fecHeaderSize+len(payload))
+	h := pkt[crcSize:]
+	binary.BigEndian.PutUint32(h, e.seqid())
+	binary.BigEndian.PutUint16(h[4:], fecData)
+	binary.BigEndian.PutUint16(h[6:], uint16(len(payload)))
+	copy(h[fecHeaderSize:], payload)
+
+	packets := [][]byte{pkt}
+
+	shard := h[6:]
+	e.shards = append(e.shards, shard)
+	e.maxlen = max(e.maxlen, len(shard))
+	if len(e.shards) < e.data {
+		return packets, nil
+	}
+
+	//
+	// Parity
+	//
+
+	shards := make([][]byte, e.data+e.parity)
+	for i, s := range e.shards {
+		shards[i] = make([]byte, e.maxlen)
+		copy(shards[i], s)
+	}
+
+	for i := e.data; i < len(shards); i++ {
+		pkt := make([]byte, crcSize+6+e.maxlen)
+		binary.BigEndian.PutUint32(pkt[crcSize:], e.seqid())
+		binary.BigEndian.PutUint16(pkt[crcSize+4:], fecParity)
+
+		shards[i] = pkt[crcSize+6:]
+		packets = append(packets, pkt)
+	}
+
+	e.shards = e.shards[:0]
+	e.maxlen = 0
+
+	if err := e.codec.Encode(shards); err != nil {
+		return packets[:1], err
+	}
+	return packets, nil
+}
+
+func (e *fecEncoder) seqid() uint32 {
+	id := e.next
+	e.next = (e.next + 1) % e.limit
+	return id
+}
+
+type (
+	fecDecoder struct {
+		data   int
+		parity int
+		codec  reedsolomon.Encoder
+		groups map[uint32]*fecGroup
+		order  []uint32
+	}
+
+	fecGroup struct {
+		shards [][]byte
+		count  int
+		done   bool
+	}
+)
+
+func newFECDecoder(data, parity int) (*fecDecoder, error) {
+	codec, err := reedsolomon.New(data, parity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fecDecoder{
+		data:   data,
+		parity: parity,
+		codec:  codec,
+		groups: make(map[uint32]*fecGroup),
+	}, nil
+}
+
+// decode returns the payloads carried by the packet: its own data and the recovered ones.
+func (d *fecDecoder) decode(pkt []byte) ([][]byte, error) {
+	if len(pkt) < 6 {
+		return nil, errInvalidFEC
+	}
+
+	total := uint32(d.data + d.parity)
+	seqid := binary.BigEndian.Uint32(pkt)
+	gid := seqid / total
+	idx := int(seqid % total)
+
+	var payloads [][]byte
+
+	switch binary.BigEndian.Uint16(pkt[4:]) {
+	case fecData:
+		if idx >= d.data || len(pkt) < fecHeaderSize {
+			return nil, errInvalidFEC
+		}
+
+		size := int(binary.BigEndian.Uint16(pkt[6:]))
+		if fecHeaderSize+size > len(pkt) {
+			return nil, errInvalidFEC
+		}
+		payloads = append(payloads, pkt[fecHeaderSize:fecHeaderSize+size])
+	case fecParity:
+		if idx < d.data {
+			return nil, errInvalidFEC
+		}
+	default:
+		return nil, errInvalidFEC
+	}
+
+	g := d.group(gid)
+	if g.done || g.shards[idx] != nil {
+		return payloads, nil
+	}
+
+	g.shards[idx] = append([]byte(nil), pkt[6:]...)
+	g.count++
+	if g.count < d.data {
+		return payloads, nil
+	}
+
+	//
+	// Recovery
+	//
+
+	g.done = true
+	defer func() {
+		g.shards = nil
+	}()
+
+	var size int
+	var missing []int
+	for i, s := range g.shards {
+		if i >= d.data {
+			if s != nil {
+				size = len(s)
+			}
+			continue
+		}
+
+		if s == nil {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) == 0 {
+		return payloads, nil
+	}
+
+	for i, s := range g.shards {
+		if s != nil && len(s) != size {
+			if len(s) > size {
+				return payloads, errInvalidFEC
+			}
+
+			padded := make([]byte, size)
+			copy(padded, s)
+			g.shards[i] = padded
+		}
+	}
+
+	if err := d.codec.ReconstructData(g.shards); err != nil {
+		return payloads, err
+	}
+
+	for _, i := range missing {
+		s := g.shards[i]
+		size := int(binary.BigEndian.Uint16(s))
+		if 2+size <= len(s) {
+			payloads = append(payloads, s[2:2+size])
+		}
+	}
+
+	return payloads, nil
+}
+
+func (d *fecDecoder) group(gid uint32) *fecGroup {
+	if g, ok := d.groups[gid]; ok {
+		return g
+	}
+
+	g := &fecGroup{
+		shards: make([][]byte, d.data+d.parity),
+	}
+	d.groups[gid] = g
+	d.order = append(d.order, gid)
+
+	if len(d.order) > maxFECGroups {
+		delete(d.groups, d.order[0])
+		d.order = d.order[1:]
+	}
+
+	return g
+}
@@ -0,0 +1,49 @@
+package rudp_test
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/mdouchement/seikan/pkg/rudp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFECRecovery(t *testing.T) {
+	fec, err := rudp.NewFEC(4, 2)
+	assert.NoError(t, err)
+
+	var payloads [][]byte
+	var packets [][]byte
+	for i := range 4 {
+		payload := make([]byte, 100+i*10) // Shards of different sizes
+		_, err = rand.Read(payload)
+		assert.NoError(t, err)
+		payloads = append(payloads, payload)
+
+		p, err := fec.Encode(payload)
+		assert.NoError(t, err)
+		packets = append(packets, p...)
+	}
+	assert.Len(t, packets, 6, "4 data + 2 parity")
+
+	// Drop 2 data packets.
+	var recovered [][]byte
+	for _, i := range []int{0, 2, 4, 5} {
+		p, err := fec.Decode(packets[i])
+		assert.NoError(t, err)
+		recovered = append(recovered, p...)
+	}
+
+	assert.ElementsMatch(t, payloads, recovered)
+}
+
+func TestFECInvalidPacket(t *testing.T) {
+	fec, err := rudp.NewFEC(4, 2)
+	assert.NoError(t, err)
+
+	_, err = fec.Decode([]byte{0x00, 0x01})
+	assert.EqualError(t, err, "rudp: invalid FEC packet")
+
+	_, err = fec.Decode([]byte{0x00, 0x00, 0x00, 0x00, 0xFF, 0xFF, 0x00, 0x00})
+	assert.EqualError(t, err, "rudp: invalid FEC packet")
+}
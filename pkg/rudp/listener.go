@@ -0,0 +1,170 @@
+package rudp
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// A Listener accepts reliable-ordered streams on an UDP socket. It implements net.Listener.
+type Listener struct {
+	config Config
+	pc     net.PacketConn
+	mu     sync.Mutex
+	conns  map[string]*Conn
+	connCh chan *Conn
+	die    chan struct{}
+	once   sync.Once
+}
+
+// Listen announces on the given UDP address.
+func Listen(address string, config Config) (*Listener, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	pc, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewListener(pc, config), nil
+}
+
+// NewListener returns a Listener using the given socket.
+// The config must have been validated.
+func NewListener(pc net.PacketConn, config Config) *Listener {
+	l := &Listener{
+		config: config,
+		pc:     pc,
+		conns:  make(map[string]*Conn),
+		connCh: make(chan *Conn, 128),
+		die:    make(chan struct{}),
+	}
+
+	go l.readLoop()
+	return l
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.connCh:
+		return c, nil
+	case <-l.die:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener.
+// Accepted connections are not closed but stop receiving packets.
+func (l *Listener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.die)
+		err = l.pc.Close()
+	})
+	return err
+}
+
+// Addr implements net.Listener.
+func (l *Listener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+func (l *Listener) readLoop() {
+	buf := make([]byte, receiveBufSize)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			l.Close()
+			return
+		}
+
+		pkt, ok := verify(buf[:n])
+		if !ok {
+			continue
+		}
+
+		c := l.conn(addr, pkt)
+		if c != nil {
+			c.input(pkt)
+		}
+	}
+}
+
+// conn returns the connection of the given remote address, a new one is created when needed.
+func (l *Listener) conn(addr net.Addr, pkt []byte) *Conn {
+	key := addr.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	conv, opening, ok := l.header(pkt)
+	if c, found := l.conns[key]; found {
+		if !ok || conv == c.arq.conv {
+			return c
+		}
+
+		// The peer restarted with the same address.
+		delete(l.conns, key)
+		go c.shutdown(ErrDeadLink)
+	}
+
+	if !opening {
+		return nil // Late packets of a terminated connection.
+	}
+
+	c, err := newConn(conv, l.config, l.pc, addr)
+	if err != nil {
+		return nil
+	}
+	c.detach = func(c *Conn) {
+		l.mu.Lock()
+		if l.conns[key] == c {
+			delete(l.conns, key)
+		}
+		l.mu.Unlock()
+	}
+
+	select {
+	case l.connCh <- c:
+	default:
+		return nil // Backlog is full
+	}
+
+	l.conns[key] = c
+	go c.updateLoop()
+	return c
+}
+
+// header extracts the conversation identifier of the packet
+// and whether it carries the first segment of a new stream.
+func (l *Listener) header(pkt []byte) (conv uint32, opening bool, ok bool) {
+	if l.config.FEC() {
+		if len(pkt) < fecHeaderSize || binary.BigEndian.Uint16(pkt[4:]) != fecData {
+			return 0, false, false
+		}
+		pkt = pkt[fecHeaderSize:]
+	}
+
+	if len(pkt) < segmentHeader {
+		return 0, false, false
+	}
+
+	conv = binary.BigEndian.Uint32(pkt)
+	for len(pkt) >= segmentHeader {
+		if pkt[4] == cmdPush && binary.BigEndian.Uint32(pkt[11:]) == 0 {
+			opening = true
+			break
+		}
+
+		l := int(binary.BigEndian.Uint16(pkt[19:]))
+		if segmentHeader+l > len(pkt) {
+			break
+		}
+		pkt = pkt[segmentHeader+l:]
+	}
+
+	return conv, opening, true
+}
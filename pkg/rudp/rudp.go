@@ -0,0 +1,112 @@
+// Package rudp implements a reliable-ordered stream transport over UDP.
+//
+// It uses a KCP-style ARQ (selective acknowledgements, fast retransmit, no congestion window)
+// tuned for high-latency and lossy links, with optional Reed-Solomon forward error correction.
+//
+// Packet layout:
+//
+//	| crc32 (4) | FEC header (6, optional) | segments... |
+//
+// Segment layout:
+//
+//	| conv (4) | cmd (1) | wnd (2) | ts (4) | sn (4) | una (4) | len (2) | data |
+package rudp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Default configuration values.
+const (
+	DefaultMTU         = 1350
+	DefaultWindow      = 256
+	DefaultInterval    = 10 * time.Millisecond
+	DefaultIdleTimeout = 30 * time.Second
+)
+
+const (
+	crcSize        = 4
+	segmentHeader  = 21
+	keepalive      = 5 * time.Second
+	linger         = 5 * time.Second
+	deadLink       = 20 // Maximum transmissions of a segment.
+	maxFECGroups   = 64 // Number of FEC groups kept for recovery.
+	minMTU         = 128
+	maxMTU         = 9000
+	maxShards      = 128
+	receiveBufSize = 64 << 10
+)
+
+// ErrDeadLink is returned when the peer stopped responding.
+var ErrDeadLink = errors.New("rudp: dead link")
+
+// A Config holds the transport options.
+// Both peers must use the same FEC shards.
+type Config struct {
+	// MTU is the maximum size of an UDP payload.
+	MTU int
+	// Window is the send and receive window in segments.
+	Window int
+	// DataShards and ParityShards configure the forward error correction.
+	// FEC is disabled when one of them is zero.
+	DataShards   int
+	ParityShards int
+	// Interval is the internal update interval.
+	Interval time.Duration
+	// IdleTimeout closes a connection that did not receive anything for this duration.
+	IdleTimeout time.Duration
+}
+
+// FEC returns true if the forward error correction is enabled.
+func (c Config) FEC() bool {
+	return c.DataShards > 0 && c.ParityShards > 0
+}
+
+// Validate checks the configuration and sets default values.
+func (c *Config) Validate() error {
+	if c.MTU == 0 {
+		c.MTU = DefaultMTU
+	}
+	if c.MTU < minMTU || c.MTU > maxMTU {
+		return fmt.Errorf("rudp: mtu must be between %d and %d", minMTU, maxMTU)
+	}
+
+	if c.Window == 0 {
+		c.Window = DefaultWindow
+	}
+	if c.Window < 0 || c.Window > 0xFFFF {
+		return errors.New("rudp: invalid window")
+	}
+
+	if c.DataShards < 0 || c.ParityShards < 0 || c.DataShards+c.ParityShards > maxShards {
+		return errors.New("rudp: invalid FEC shards")
+	}
+
+	if c.Interval == 0 {
+		c.Interval = DefaultInterval
+	}
+
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = DefaultIdleTimeout
+	}
+
+	return nil
+}
+
+// mss returns the maximum segment payload size.
+func (c Config) mss() int {
+	mss := c.MTU - crcSize - segmentHeader
+	if c.FEC() {
+		mss -= fecHeaderSize
+	}
+	return mss
+}
+
+// timeoutError implements net.Error.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "rudp: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
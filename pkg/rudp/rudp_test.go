@@ -0,0 +1,172 @@
+package rudp_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	mrand "math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdouchement/seikan/pkg/rudp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	config := rudp.Config{}
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, rudp.DefaultMTU, config.MTU)
+	assert.Equal(t, rudp.DefaultWindow, config.Window)
+	assert.False(t, config.FEC())
+
+	config = rudp.Config{MTU: 64}
+	assert.EqualError(t, config.Validate(), "rudp: mtu must be between 128 and 9000")
+
+	config = rudp.Config{DataShards: 100, ParityShards: 100}
+	assert.EqualError(t, config.Validate(), "rudp: invalid FEC shards")
+
+	config = rudp.Config{DataShards: 10, ParityShards: 3}
+	assert.NoError(t, config.Validate())
+	assert.True(t, config.FEC())
+}
+
+func TestTransfer(t *testing.T) {
+	transfer(t, rudp.Config{}, 0)
+}
+
+func TestTransferLossy(t *testing.T) {
+	transfer(t, rudp.Config{Window: 128}, 0.1)
+}
+
+func TestTransferLossyFEC(t *testing.T) {
+	transfer(t, rudp.Config{Window: 128, MTU: 1200, DataShards: 10, ParityShards: 3}, 0.1)
+}
+
+func TestEOF(t *testing.T) {
+	l, err := rudp.Listen("127.0.0.1:0", rudp.Config{})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	c, err := rudp.Dial(l.Addr().String(), rudp.Config{})
+	assert.NoError(t, err)
+
+	_, err = c.Write([]byte("bye"))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Close())
+
+	sc, err := l.Accept()
+	assert.NoError(t, err)
+	defer sc.Close()
+
+	p, err := io.ReadAll(sc)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye", string(p))
+
+	_, err = c.Write([]byte("closed"))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestReadDeadline(t *testing.T) {
+	l, err := rudp.Listen("127.0.0.1:0", rudp.Config{})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	c, err := rudp.Dial(l.Addr().String(), rudp.Config{})
+	assert.NoError(t, err)
+	defer c.Close()
+
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = c.Read(make([]byte, 1))
+	if assert.Error(t, err) {
+		nerr, ok := err.(net.Error)
+		assert.True(t, ok)
+		assert.True(t, nerr.Timeout())
+	}
+}
+
+func transfer(t *testing.T, config rudp.Config, loss float64) {
+	l, err := rudp.Listen("127.0.0.1:0", config)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	relay := newLossyRelay(t, l.Addr(), loss)
+	defer relay.Close()
+
+	c, err := rudp.Dial(relay.LocalAddr().String(), config)
+	assert.NoError(t, err)
+	defer c.Close()
+
+	expected := make([]byte, 512<<10)
+	_, err = rand.Read(expected)
+	assert.NoError(t, err)
+
+	go func() {
+		_, err := c.Write(expected)
+		assert.NoError(t, err, "client")
+	}()
+
+	sc, err := l.Accept()
+	assert.NoError(t, err)
+	defer sc.Close()
+
+	// Echo
+	go func() {
+		_, err := io.CopyN(sc, sc, int64(len(expected)))
+		assert.NoError(t, err, "server")
+	}()
+
+	c.SetReadDeadline(time.Now().Add(30 * time.Second))
+	actual := make([]byte, len(expected))
+	_, err = io.ReadFull(c, actual)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(expected, actual))
+}
+
+// A lossyRelay forwards UDP packets between one client and a server, dropping some of them.
+type lossyRelay struct {
+	net.PacketConn
+	mu     sync.Mutex
+	client net.Addr
+}
+
+func newLossyRelay(t *testing.T, server net.Addr, loss float64) *lossyRelay {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	r := &lossyRelay{PacketConn: pc}
+	rng := mrand.New(mrand.NewSource(time.Now().UnixNano()))
+
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			if rng.Float64() < loss {
+				continue
+			}
+
+			if addr.String() == server.String() {
+				r.mu.Lock()
+				client := r.client
+				r.mu.Unlock()
+
+				if client != nil {
+					pc.WriteTo(buf[:n], client)
+				}
+				continue
+			}
+
+			r.mu.Lock()
+			r.client = addr
+			r.mu.Unlock()
+			pc.WriteTo(buf[:n], server)
+		}
+	}()
+
+	return r
+}
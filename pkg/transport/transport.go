@@ -0,0 +1,97 @@
+// Package transport is the registry of the transports carrying the sessions between the client and the server.
+//
+// The built-in transports are registered by seikan, embedders register their own ones for new URL schemes.
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"sync"
+)
+
+var (
+	// ErrUnsupportedScheme is returned when no transport is registered for the address scheme.
+	ErrUnsupportedScheme = errors.New("unsupported protocol scheme")
+	// ErrProxyUnsupported is returned by transports that cannot be dialed through an upstream proxy.
+	ErrProxyUnsupported = errors.New("unsupported protocol scheme through proxy")
+)
+
+// A Transport carries the sessions between the client and the server.
+// It is selected by the scheme of the `Connection.Address' URL,
+// transport-specific options are read from the URL query parameters.
+type Transport interface {
+	// Listen announces on the given URL.
+	Listen(u *url.URL) (net.Listener, error)
+	// Dial connects to the given URL.
+	// d is the upstream proxy dialer, nil for a direct connection.
+	// A transport that cannot be proxied returns ErrProxyUnsupported when d is not nil.
+	Dial(u *url.URL, d ContextDialer) (net.Conn, error)
+}
+
+// A ContextDialer dials the underlying TCP connection of a transport.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+var (
+	mu         sync.RWMutex
+	transports = map[string]Transport{}
+)
+
+// Register makes a transport available for the given URL schemes.
+// It panics if the transport is nil or a scheme is already registered.
+func Register(t Transport, schemes ...string) {
+	if t == nil {
+		panic("transport: Register transport is nil")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, scheme := range schemes {
+		if _, dup := transports[scheme]; dup {
+			panic("transport: Register called twice for scheme " + scheme)
+		}
+		transports[scheme] = t
+	}
+}
+
+// Lookup returns the transport registered for the given URL scheme.
+func Lookup(scheme string) (Transport, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	t, ok := transports[scheme]
+	return t, ok
+}
+
+// Schemes returns a sorted list of the registered URL schemes.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	schemes := make([]string, 0, len(transports))
+	for scheme := range transports {
+		schemes = append(schemes, scheme)
+	}
+	slices.Sort(schemes)
+	return schemes
+}
+
+// Resolve parses netaddr and returns the transport registered for its scheme.
+func Resolve(netaddr string) (Transport, *url.URL, error) {
+	u, err := url.Parse(netaddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t, ok := Lookup(u.Scheme)
+	if !ok {
+		return nil, nil, ErrUnsupportedScheme
+	}
+
+	return t, u, nil
+}
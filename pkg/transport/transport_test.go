@@ -0,0 +1,87 @@
+package transport_test
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mdouchement/seikan/internal/snet"
+	"github.com/mdouchement/seikan/pkg/transport"
+	"github.com/stretchr/testify/assert"
+)
+
+// prefixTransport is a custom transport writing a greeting on TCP connections.
+type prefixTransport struct{}
+
+func (prefixTransport) Listen(u *url.URL) (net.Listener, error) {
+	return net.Listen("tcp", u.Host)
+}
+
+func (prefixTransport) Dial(u *url.URL, d transport.ContextDialer) (net.Conn, error) {
+	if d != nil {
+		return nil, transport.ErrProxyUnsupported
+	}
+
+	c, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.Write([]byte(u.Query().Get("greeting")))
+	return c, err
+}
+
+// runs makes the registered scheme unique for each run of the tests.
+var runs atomic.Int64
+
+func TestRegister(t *testing.T) {
+	scheme := "prefix" + strconv.FormatInt(runs.Add(1), 10)
+
+	transport.Register(prefixTransport{}, scheme)
+	assert.Contains(t, transport.Schemes(), scheme)
+	assert.Contains(t, transport.Schemes(), "tcp") // Registered by seikan
+
+	assert.Panics(t, func() {
+		transport.Register(prefixTransport{}, scheme)
+	})
+	assert.Panics(t, func() {
+		transport.Register(nil, "nil")
+	})
+
+	// The registered transport is used by seikan for the addresses of its scheme.
+	l, err := snet.Listen(scheme + "://127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		assert.NoError(t, err, "server")
+		defer c.Close()
+
+		p := make([]byte, 5)
+		_, err = io.ReadFull(c, p)
+		assert.NoError(t, err, "server")
+		received <- string(p)
+	}()
+
+	c, err := snet.Dial(scheme + "://" + l.Addr().String() + "?greeting=hello")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	assert.Equal(t, "hello", <-received)
+
+	_, err = snet.DialThrough(scheme+"://"+l.Addr().String(), "socks5://127.0.0.1:1080")
+	assert.ErrorIs(t, err, transport.ErrProxyUnsupported)
+}
+
+func TestResolve(t *testing.T) {
+	_, _, err := transport.Resolve("unknown://127.0.0.1:4242")
+	assert.ErrorIs(t, err, transport.ErrUnsupportedScheme)
+
+	_, _, err = transport.Resolve("://127.0.0.1:4242")
+	assert.Error(t, err)
+}